@@ -0,0 +1,238 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/speedtestlogger/stl"
+	"github.com/keep94/speedtestlogger/stl/ingest"
+	"github.com/keep94/speedtestlogger/stl/stldb"
+	"github.com/keep94/speedtestlogger/stl/stldb/for_sqlite"
+	"github.com/keep94/speedtestlogger/stl/stldb/sqlite_setup"
+	"github.com/keep94/toolbox/db"
+	"github.com/keep94/toolbox/db/sqlite3_db"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	kSkip = "skip"
+	kFail = "fail"
+)
+
+var (
+	fDb    string
+	fTz    string
+	fDup   string
+	fProbe string
+)
+
+type Store interface {
+	stldb.AddEntryRunner
+	stldb.EntriesRunner
+}
+
+// counts tallies the results of importing.
+type counts struct {
+	Imported   int
+	Duplicates int
+	Invalid    int
+}
+
+func (c *counts) add(other *counts) {
+	c.Imported += other.Imported
+	c.Duplicates += other.Duplicates
+	c.Invalid += other.Invalid
+}
+
+func (c *counts) String() string {
+	return fmt.Sprintf(
+		"imported %d, skipped %d duplicates, %d invalid",
+		c.Imported,
+		c.Duplicates,
+		c.Invalid)
+}
+
+func main() {
+	flag.Parse()
+	if fDb == "" || flag.NArg() == 0 {
+		fmt.Println("Need to specify -db flag and at least one file.")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if fDup != kSkip && fDup != kFail {
+		fmt.Println("-dup must be skip or fail.")
+		flag.Usage()
+		os.Exit(2)
+	}
+	loc := time.Local
+	if fTz != "" {
+		var err error
+		loc, err = time.LoadLocation(fTz)
+		if err != nil {
+			log.Fatal("Bad time zone: ", fTz)
+		}
+	}
+	dbase := openDb(fDb)
+	defer dbase.Close()
+	store := for_sqlite.New(dbase)
+	var total counts
+	err := sqlite3_db.NewDoer(dbase).Do(func(t db.Transaction) error {
+		return store.Batch(t, func(batch *for_sqlite.Store) error {
+			for _, path := range flag.Args() {
+				fileCounts, err := importFile(
+					t, batch, path, loc, fProbe, fDup == kFail)
+				if err != nil {
+					return fmt.Errorf("%s: %w", path, err)
+				}
+				fmt.Printf("%s: %v\n", path, fileCounts)
+				total.add(fileCounts)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		log.Fatal("Nothing imported: ", err)
+	}
+	fmt.Printf("Total: %v\n", &total)
+}
+
+// importFile imports the entries in the file at path as part of
+// transaction t. Entries in the file without a probe get probe. If
+// failOnDuplicate is true, importFile returns an error on the first
+// duplicate entry; otherwise, it skips duplicates. An entry is a duplicate
+// if an entry with the same probe and timestamp already exists.
+func importFile(
+	t db.Transaction,
+	store Store,
+	path string,
+	loc *time.Location,
+	probe string,
+	failOnDuplicate bool) (*counts, error) {
+	var reader io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		reader = file
+	}
+	imp := &importer{
+		t:               t,
+		store:           store,
+		path:            path,
+		loc:             loc,
+		probe:           probe,
+		failOnDuplicate: failOnDuplicate,
+	}
+	if err := ingest.Read(reader, loc, imp); err != nil {
+		return nil, err
+	}
+	if imp.err != nil {
+		return nil, imp.err
+	}
+	return &imp.counts, nil
+}
+
+// importer consumes records read from a file adding them to the store.
+// importer stops consuming at the first error.
+type importer struct {
+	t               db.Transaction
+	store           Store
+	path            string
+	loc             *time.Location
+	probe           string
+	failOnDuplicate bool
+	counts          counts
+	err             error
+}
+
+func (i *importer) CanConsume() bool {
+	return i.err == nil
+}
+
+func (i *importer) Consume(record ingest.Record) {
+	if record.Err != nil {
+		log.Printf("%s:%d: %v", i.path, record.Row, record.Err)
+		i.counts.Invalid++
+		return
+	}
+	entry := record.Entry
+	if entry.Probe == "" {
+		entry.Probe = i.probe
+	}
+	exists, err := entryExists(i.t, i.store, entry.Probe, entry.Ts)
+	if err != nil {
+		i.err = err
+		return
+	}
+	if exists {
+		if i.failOnDuplicate {
+			i.err = fmt.Errorf(
+				"row %d: duplicate entry at %s",
+				record.Row,
+				time.Unix(entry.Ts, 0).In(i.loc).Format(time.RFC3339))
+			return
+		}
+		i.counts.Duplicates++
+		return
+	}
+	if err := i.store.AddEntry(i.t, &entry); err != nil {
+		i.err = err
+		return
+	}
+	i.counts.Imported++
+}
+
+func entryExists(
+	t db.Transaction, store Store, probe string, ts int64) (bool, error) {
+	var entries []stl.Entry
+	err := store.ProbeEntries(
+		t,
+		probe,
+		ts,
+		ts+1,
+		consume2.Slice(consume2.AppendTo(&entries), 0, 1))
+	return len(entries) > 0, err
+}
+
+func openDb(dbPath string) *sqlite3_db.Db {
+	rawdb, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		log.Fatal("Unable to open database: ", dbPath)
+	}
+	dbase := sqlite3_db.New(rawdb)
+	if err := dbase.Do(sqlite_setup.CheckCurrent); err != nil {
+		log.Fatalf("%v; run stlinit -db %s -migrate", err, dbPath)
+	}
+	return dbase
+}
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintf(
+			flag.CommandLine.Output(),
+			"Usage: %s -db <path> [flags] file...\n",
+			os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.StringVar(&fDb, "db", "", "Path to database file")
+	flag.StringVar(
+		&fTz, "tz", "", "Time zone of timestamps without one; default local")
+	flag.StringVar(
+		&fDup,
+		"dup",
+		kSkip,
+		"skip to skip entries already in the database; fail to abort import")
+	flag.StringVar(
+		&fProbe,
+		"probe",
+		"",
+		"probe for imported entries that don't name one; default none")
+}
@@ -12,7 +12,9 @@ import (
 )
 
 var (
-	fDb string
+	fDb      string
+	fMigrate bool
+	fDryRun  bool
 )
 
 func main() {
@@ -22,9 +24,18 @@ func main() {
 		flag.Usage()
 		os.Exit(2)
 	}
+	if fDryRun && !fMigrate {
+		fmt.Println("-dryrun requires -migrate.")
+		flag.Usage()
+		os.Exit(2)
+	}
 	db := openDb(fDb)
 	defer db.Close()
-	initDb(db)
+	if fMigrate {
+		migrateDb(db, fDryRun)
+	} else {
+		initDb(db)
+	}
 }
 
 func openDb(dbPath string) *sqlite3_db.Db {
@@ -44,6 +55,44 @@ func initDb(dbase *sqlite3_db.Db) {
 	}
 }
 
+func migrateDb(dbase *sqlite3_db.Db, dryRun bool) {
+	var version int
+	var migrations []sqlite_setup.Migration
+	err := dbase.Do(func(tx *sql.Tx) (err error) {
+		version, err = sqlite_setup.CurrentVersion(tx)
+		if err != nil {
+			return
+		}
+		if dryRun {
+			migrations, err = sqlite_setup.Pending(tx)
+		} else {
+			migrations, err = sqlite_setup.Migrate(tx)
+		}
+		return
+	})
+	if err != nil {
+		fmt.Printf("Unable to migrate database - %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Schema version: %d\n", version)
+	if len(migrations) == 0 {
+		fmt.Println("Database is up to date.")
+		return
+	}
+	verb := "Applied"
+	if dryRun {
+		verb = "Pending"
+	}
+	for _, migration := range migrations {
+		fmt.Printf(
+			"%s: %d - %s\n", verb, migration.Version, migration.Description)
+	}
+}
+
 func init() {
 	flag.StringVar(&fDb, "db", "", "Path to database file")
+	flag.BoolVar(
+		&fMigrate, "migrate", false, "Upgrade database to latest schema")
+	flag.BoolVar(
+		&fDryRun, "dryrun", false, "With -migrate, list pending migrations only")
 }
@@ -1,70 +1,224 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	"encoding/csv"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"strconv"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/keep94/speedtestlogger/stl"
+	"github.com/keep94/speedtestlogger/stl/daemon"
+	"github.com/keep94/speedtestlogger/stl/httpspeed"
+	"github.com/keep94/speedtestlogger/stl/iperf"
+	"github.com/keep94/speedtestlogger/stl/ookla"
 	"github.com/keep94/speedtestlogger/stl/stldb"
+	"github.com/keep94/speedtestlogger/stl/stldb/for_ndjson"
 	"github.com/keep94/speedtestlogger/stl/stldb/for_sqlite"
+	"github.com/keep94/speedtestlogger/stl/stldb/sqlite_setup"
 	"github.com/keep94/toolbox/db/sqlite3_db"
 	_ "github.com/mattn/go-sqlite3"
 )
 
-const (
-	kMillionFloat = 1000000.0
-	kEightFloat   = 8.0
-)
-
 var (
-	fDb  string
-	fCsv string
+	fDb       string
+	fFile     string
+	fProbe    string
+	fCsv      string
+	fJson     string
+	fIperf    string
+	fExitCode int
+	fStderr   string
+	fDaemon   bool
+	fInterval time.Duration
+	fJitter   time.Duration
+	fTimeout  time.Duration
+	fCmd      string
+	fHttpURL  string
+	fStreams  int
+	fDuration time.Duration
 )
 
 func main() {
 	flag.Parse()
-	if fDb == "" {
-		fmt.Println("Need to specify at least -db flag.")
+	if countNonEmpty(fDb, fFile) != 1 {
+		fmt.Println("Need to specify exactly one of -db and -file.")
 		flag.Usage()
 		os.Exit(2)
 	}
-	db := openDb(fDb)
-	defer db.Close()
-	store := for_sqlite.New(db)
+	if countNonEmpty(fCsv, fJson, fIperf, fHttpURL) > 1 {
+		fmt.Println("Specify at most one of -csv, -json, -iperf, and -http_url.")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if fDaemon {
+		if countNonEmpty(fCsv, fJson, fIperf, fStderr) > 0 || fExitCode != -1 {
+			fmt.Println("-daemon can't be used with -csv, -json, -iperf, -exitcode, or -stderr.")
+			flag.Usage()
+			os.Exit(2)
+		}
+		if fInterval <= 0 {
+			fmt.Println("-daemon needs a positive -interval.")
+			flag.Usage()
+			os.Exit(2)
+		}
+		runDaemon(newMeasurer())
+		return
+	}
 	entry := stl.Entry{Ts: time.Now().Unix()}
-	var csvrow []string
-	if fCsv != "" {
-		csvrow = readcsv(fCsv)
-	}
-	if fCsv == "" {
-		log.Println("No csv file.")
-	} else if len(csvrow) < 7 {
-		log.Println("Not enough columns in csv:", csvrow)
+	inputPath := fCsv
+	if fJson != "" {
+		inputPath = fJson
+	}
+	if fHttpURL != "" {
+		entry = measure(newMeasurer(), entry.Ts)
+	} else if fIperf != "" {
+		entry = readIperfResult(fIperf).Entry(entry.Ts)
+		log.Println("Speed test status:", entry.Status)
+	} else if inputPath != "" {
+		entry = readResult(inputPath).Entry(entry.Ts)
 	} else {
-		download, _ := strconv.ParseFloat(csvrow[5], 64)
-		upload, _ := strconv.ParseFloat(csvrow[6], 64)
-		entry.DownloadMbps = download * kEightFloat / kMillionFloat
-		entry.UploadMbps = upload * kEightFloat / kMillionFloat
+		log.Println("No csv or json file.")
+		entry.Status = ookla.ClassifyFailure(fExitCode, readStderr(fStderr))
+		log.Println("Speed test status:", entry.Status)
 	}
+	entry.Probe = fProbe
+	store, closer := openStore()
+	defer closer.Close()
 	addEntry(store, &entry)
 }
 
-func readcsv(csvPath string) []string {
-	file, err := os.Open(csvPath)
+// readResult reads speedtest output in csv, tsv, or json format from
+// inputPath. An inputPath of - means stdin. readResult exits the program
+// if the output cannot be parsed so that no entry gets written.
+func readResult(inputPath string) *ookla.Result {
+	var reader io.Reader = os.Stdin
+	if inputPath != "-" {
+		file, err := os.Open(inputPath)
+		if err != nil {
+			log.Fatal("Unable to open speedtest output: ", inputPath)
+		}
+		defer file.Close()
+		reader = file
+	}
+	result, err := ookla.Parse(reader)
 	if err != nil {
-		log.Fatal("Unable to open csv file: ", csvPath)
+		log.Fatal("Unable to read speedtest output: ", err)
 	}
-	defer file.Close()
-	reader := csv.NewReader(file)
-	result, err := reader.Read()
+	return result
+}
+
+// readIperfResult reads iperf3 -J output from inputPath. An inputPath of
+// - means stdin. readIperfResult exits the program if the output cannot be
+// parsed so that no entry gets written.
+func readIperfResult(inputPath string) *iperf.Result {
+	var reader io.Reader = os.Stdin
+	if inputPath != "-" {
+		file, err := os.Open(inputPath)
+		if err != nil {
+			log.Fatal("Unable to open iperf3 output: ", inputPath)
+		}
+		defer file.Close()
+		reader = file
+	}
+	result, err := iperf.ParseJSON(reader)
 	if err != nil {
-		log.Fatal("Unable to read csv file: ", err)
+		log.Fatal("Unable to read iperf3 output: ", err)
+	}
+	if result.Error != "" {
+		log.Println("iperf3 error:", result.Error)
+	}
+	return result
+}
+
+// readStderr returns the contents of the file containing what the
+// speedtest CLI wrote to stderr. If stderrPath is empty, readStderr
+// returns the empty string.
+func readStderr(stderrPath string) string {
+	if stderrPath == "" {
+		return ""
+	}
+	content, err := os.ReadFile(stderrPath)
+	if err != nil {
+		log.Println("Unable to read stderr file: ", err)
+		return ""
+	}
+	return string(content)
+}
+
+// newMeasurer returns the native HTTP tester if -http_url is given or
+// the speed test command given by -cmd otherwise.
+func newMeasurer() daemon.Measurer {
+	if fHttpURL != "" {
+		return &httpspeed.Tester{
+			URL:      fHttpURL,
+			Streams:  fStreams,
+			Duration: fDuration,
+			Timeout:  fTimeout,
+		}
+	}
+	args := strings.Fields(fCmd)
+	if len(args) == 0 {
+		fmt.Println("Need -cmd or -http_url.")
+		flag.Usage()
+		os.Exit(2)
+	}
+	return &daemon.Command{Args: args, Timeout: fTimeout}
+}
+
+// measure measures speed once with measurer and returns the entry.
+func measure(measurer daemon.Measurer, ts int64) stl.Entry {
+	entry, err := measurer.Run(context.Background(), ts)
+	if err != nil {
+		log.Fatal("Speed test interrupted: ", err)
+	}
+	log.Println("Speed test status:", entry.Status)
+	return entry
+}
+
+// runDaemon runs measurer on a schedule and logs each result until it
+// receives SIGTERM or SIGINT.
+func runDaemon(measurer daemon.Measurer) {
+	store, closer := openStore()
+	defer closer.Close()
+	ctx, stop := signal.NotifyContext(
+		context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	scheduler := &daemon.Scheduler{
+		Interval: fInterval,
+		Jitter:   fJitter,
+		Skipped: func(count int) {
+			log.Printf("Skipped %d runs because speed test ran long", count)
+		},
+	}
+	log.Printf("Running speed test every %v", fInterval)
+	scheduler.Run(ctx, func(ctx context.Context) {
+		entry, err := measurer.Run(ctx, time.Now().Unix())
+		if err != nil {
+			log.Print("Speed test interrupted: ", err)
+			return
+		}
+		log.Println("Speed test status:", entry.Status)
+		entry.Probe = fProbe
+		if err := store.AddEntry(nil, &entry); err != nil {
+			log.Print("Error writing to db: ", err)
+		}
+	})
+	log.Println("Shutting down")
+}
+
+func countNonEmpty(values ...string) int {
+	var result int
+	for _, value := range values {
+		if value != "" {
+			result++
+		}
 	}
 	return result
 }
@@ -75,15 +229,104 @@ func addEntry(store stldb.AddEntryRunner, entry *stl.Entry) {
 	}
 }
 
+// openStore opens the sqlite database given by -db or the entries file
+// given by -file.
+func openStore() (stldb.AddEntryRunner, io.Closer) {
+	if fFile != "" {
+		store, err := for_ndjson.Open(fFile)
+		if err != nil {
+			log.Fatal("Unable to open entries file: ", err)
+		}
+		return store, store
+	}
+	db := openDb(fDb)
+	return for_sqlite.New(db), db
+}
+
 func openDb(dbPath string) *sqlite3_db.Db {
 	rawdb, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
 		log.Fatal("Unable to open database: ", dbPath)
 	}
-	return sqlite3_db.New(rawdb)
+	dbase := sqlite3_db.New(rawdb)
+	if err := dbase.Do(sqlite_setup.CheckCurrent); err != nil {
+		log.Fatalf("%v; run stlinit -db %s -migrate", err, dbPath)
+	}
+	return dbase
 }
 
 func init() {
 	flag.StringVar(&fDb, "db", "", "Path to database file")
-	flag.StringVar(&fCsv, "csv", "", "path to csv file")
+	flag.StringVar(
+		&fFile,
+		"file",
+		"",
+		"append entries to this JSON lines file instead of -db; works without sqlite")
+	flag.StringVar(
+		&fProbe,
+		"probe",
+		"",
+		"name of the site or probe taking the measurement; default none")
+	flag.StringVar(
+		&fCsv,
+		"csv",
+		"",
+		"path to output of speedtest -f csv or -f tsv; - means stdin")
+	flag.StringVar(
+		&fJson,
+		"json",
+		"",
+		"path to output of speedtest -f json; - means stdin")
+	flag.StringVar(
+		&fIperf,
+		"iperf",
+		"",
+		"path to output of iperf3 -J for a TCP or UDP test; - means stdin")
+	flag.IntVar(
+		&fExitCode,
+		"exitcode",
+		-1,
+		"exit code of failed speedtest run; -1 means unknown")
+	flag.StringVar(
+		&fStderr,
+		"stderr",
+		"",
+		"path to stderr output of failed speedtest run")
+	flag.BoolVar(
+		&fDaemon,
+		"daemon",
+		false,
+		"run -cmd or -http_url every -interval and log each result until SIGTERM")
+	flag.DurationVar(
+		&fInterval, "interval", 30*time.Minute, "time between runs in -daemon mode")
+	flag.DurationVar(
+		&fJitter,
+		"jitter",
+		time.Minute,
+		"maximum random delay added to each run in -daemon mode")
+	flag.DurationVar(
+		&fTimeout,
+		"timeout",
+		2*time.Minute,
+		"maximum time a run may take in -daemon or -http_url mode; 0 means no limit")
+	flag.StringVar(
+		&fCmd,
+		"cmd",
+		"speedtest -f json --accept-license --accept-gdpr",
+		"speed test command to run in -daemon mode")
+	flag.StringVar(
+		&fHttpURL,
+		"http_url",
+		"",
+		"measure speed against this stlserve-http server instead of running -cmd")
+	flag.IntVar(
+		&fStreams,
+		"streams",
+		httpspeed.DefaultStreams,
+		"parallel streams for -http_url")
+	flag.DurationVar(
+		&fDuration,
+		"duration",
+		httpspeed.DefaultDuration,
+		"how long to measure each direction for -http_url")
 }
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/keep94/speedtestlogger/stl"
+	"github.com/keep94/speedtestlogger/stl/dates"
+	"github.com/keep94/speedtestlogger/stl/format"
+	"github.com/keep94/speedtestlogger/stl/stldb/for_sqlite"
+	"github.com/keep94/speedtestlogger/stl/stldb/sqlite_setup"
+	"github.com/keep94/toolbox/date_util"
+	"github.com/keep94/toolbox/db/sqlite3_db"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var (
+	fDb        string
+	fTz        string
+	fAdd       bool
+	fRemove    int64
+	fName      string
+	fDownload  float64
+	fUpload    float64
+	fEffective string
+)
+
+func main() {
+	flag.Parse()
+	if fDb == "" {
+		fmt.Println("Need to specify at least -db flag.")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if fAdd && fRemove != 0 {
+		fmt.Println("-add and -remove are mutually exclusive.")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if fAdd && (fDownload <= 0.0 || fEffective == "") {
+		fmt.Println("-add requires -download and -effective.")
+		flag.Usage()
+		os.Exit(2)
+	}
+	loc := time.Local
+	if fTz != "" {
+		var err error
+		loc, err = time.LoadLocation(fTz)
+		if err != nil {
+			log.Fatal("Bad time zone: ", fTz)
+		}
+	}
+	dbase := openDb(fDb)
+	defer dbase.Close()
+	store := for_sqlite.New(dbase)
+	switch {
+	case fAdd:
+		effective, err := time.Parse(date_util.YMDFormat, fEffective)
+		if err != nil {
+			log.Fatal("-effective must be yyyyMMdd: ", fEffective)
+		}
+		plan := stl.Plan{
+			Name:         fName,
+			DownloadMbps: fDownload,
+			UploadMbps:   fUpload,
+			Effective:    dates.ToTimestamp(effective, loc),
+		}
+		if err := store.AddPlan(nil, &plan); err != nil {
+			log.Fatal("Error writing to db: ", err)
+		}
+		fmt.Printf("Added plan %d\n", plan.Id)
+	case fRemove != 0:
+		if err := store.RemovePlan(nil, fRemove); err != nil {
+			log.Fatal("Error writing to db: ", err)
+		}
+	default:
+		plans, err := store.Plans(nil)
+		if err != nil {
+			log.Fatal("Error reading db: ", err)
+		}
+		for _, plan := range plans {
+			fmt.Printf(
+				"%d\t%s\t%s\t%s\t%s\n",
+				plan.Id,
+				time.Unix(plan.Effective, 0).In(loc).Format("2006-01-02"),
+				format.Float(plan.DownloadMbps, -1),
+				format.Float(plan.UploadMbps, -1),
+				plan.Name)
+		}
+	}
+}
+
+func openDb(dbPath string) *sqlite3_db.Db {
+	rawdb, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		log.Fatal("Unable to open database: ", dbPath)
+	}
+	dbase := sqlite3_db.New(rawdb)
+	if err := dbase.Do(sqlite_setup.CheckCurrent); err != nil {
+		log.Fatalf("%v; run stlinit -db %s -migrate", err, dbPath)
+	}
+	return dbase
+}
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintf(
+			flag.CommandLine.Output(),
+			"Usage: %s -db <path> [-add -download <mbps> -effective <yyyyMMdd> | -remove <id>]\n"+
+				"Lists plans when neither -add nor -remove is given.\n",
+			os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.StringVar(&fDb, "db", "", "Path to database file")
+	flag.StringVar(&fTz, "tz", "", "Time zone of effective dates; default local")
+	flag.BoolVar(&fAdd, "add", false, "Add a plan")
+	flag.Int64Var(&fRemove, "remove", 0, "Id of plan to remove")
+	flag.StringVar(&fName, "name", "", "Name of plan to add")
+	flag.Float64Var(
+		&fDownload, "download", 0.0, "Advertised download speed in Mbps")
+	flag.Float64Var(
+		&fUpload, "upload", 0.0, "Advertised upload speed in Mbps; 0 if not advertised")
+	flag.StringVar(
+		&fEffective, "effective", "", "Date plan took effect as yyyyMMdd")
+}
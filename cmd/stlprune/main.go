@@ -0,0 +1,98 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/keep94/speedtestlogger/stl/retention"
+	"github.com/keep94/speedtestlogger/stl/stldb/for_sqlite"
+	"github.com/keep94/speedtestlogger/stl/stldb/sqlite_setup"
+	"github.com/keep94/toolbox/db"
+	"github.com/keep94/toolbox/db/sqlite3_db"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var (
+	fDb       string
+	fKeepDays int
+	fDryRun   bool
+)
+
+// errDryRun rolls back the transaction in -dryrun mode.
+var errDryRun = errors.New("dry run")
+
+func main() {
+	flag.Parse()
+	if fDb == "" {
+		fmt.Println("Need to specify at least -db flag.")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if fKeepDays < 0 {
+		fmt.Println("-keep_days can't be negative.")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Days begin at midnight local time as they do in stlview.
+	policy := retention.Policy{KeepDays: fKeepDays, Location: time.Local}
+	now := time.Now().Unix()
+	dbase := openDb(fDb)
+	defer dbase.Close()
+	store := for_sqlite.New(dbase)
+	var result *retention.Result
+	err := sqlite3_db.NewDoer(dbase).Do(func(t db.Transaction) error {
+		err := store.Batch(t, func(batch *for_sqlite.Store) (err error) {
+			result, err = policy.Prune(t, batch, now)
+			return
+		})
+		if err == nil && fDryRun {
+			err = errDryRun
+		}
+		return err
+	})
+	if err != nil && err != errDryRun {
+		log.Fatal("Nothing pruned: ", err)
+	}
+	verb := "Pruned"
+	if fDryRun {
+		verb = "Would prune"
+	}
+	fmt.Printf(
+		"%s %d entries before %s into %d day summaries\n",
+		verb,
+		result.Entries,
+		time.Unix(policy.Cutoff(now), 0).Format("2006-01-02"),
+		result.DaySummaries)
+}
+
+func openDb(dbPath string) *sqlite3_db.Db {
+	rawdb, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		log.Fatal("Unable to open database: ", dbPath)
+	}
+	dbase := sqlite3_db.New(rawdb)
+	if err := dbase.Do(sqlite_setup.CheckCurrent); err != nil {
+		log.Fatalf("%v; run stlinit -db %s -migrate", err, dbPath)
+	}
+	return dbase
+}
+
+func init() {
+	flag.StringVar(&fDb, "db", "", "Path to database file")
+	flag.IntVar(
+		&fKeepDays,
+		"keep_days",
+		90,
+		"days of raw entries to keep before today; older entries become day summaries")
+	flag.BoolVar(
+		&fDryRun,
+		"dryrun",
+		false,
+		"report what would be pruned without changing anything")
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/keep94/speedtestlogger/stl/httpspeed"
+)
+
+var (
+	fPort string
+)
+
+func main() {
+	flag.Parse()
+	fmt.Println("Starting speed server on", fPort)
+	if err := http.ListenAndServe(fPort, httpspeed.Handler()); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func init() {
+	flag.StringVar(&fPort, "http", ":8098", "Port to bind")
+}
@@ -0,0 +1,380 @@
+// Package api contains the handlers for the stlview JSON API.
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/speedtestlogger/cmd/stlview/common"
+	"github.com/keep94/speedtestlogger/stl"
+	"github.com/keep94/speedtestlogger/stl/aggregators"
+	"github.com/keep94/speedtestlogger/stl/dates"
+	"github.com/keep94/speedtestlogger/stl/stldb"
+	"github.com/keep94/toolbox/date_util"
+	"github.com/keep94/toolbox/http_util"
+)
+
+const (
+	kDefaultPageSize = 100
+	kMaxPageSize     = 1000
+)
+
+const (
+	kStart    = "start"
+	kEnd      = "end"
+	kTz       = "tz"
+	kPage     = "page"
+	kPageSize = "pagesize"
+)
+
+// EntriesHandler serves the entries within a time range as JSON.
+// The start and end parameters are either dates of the form yyyyMMdd or
+// RFC 3339 timestamps. start is inclusive; end is exclusive. If start is
+// missing, it defaults to the beginning of today. If end is missing,
+// it defaults to one day after start. The tz parameter is the time zone
+// for dates and for the returned timestamps. The page and pagesize
+// parameters select a zero based page of entries. The probe parameter
+// selects the entries of one probe; without it, entries of all probes
+// are returned.
+type EntriesHandler struct {
+	Store    stldb.EntriesRunner
+	Clock    date_util.Clock
+	Location *time.Location
+}
+
+func (h *EntriesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	loc, err := location(r.Form.Get(kTz), h.Location)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	start, err := parseTime(
+		r.Form.Get(kStart), today(h.Clock.Now(), loc), loc)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	end, err := parseTime(r.Form.Get(kEnd), start.AddDate(0, 0, 1), loc)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	page, err := intParam(r.Form.Get(kPage), 0, 0, -1)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	pageSize, err := intParam(
+		r.Form.Get(kPageSize), kDefaultPageSize, 1, kMaxPageSize)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	pageBuilder := consume2.NewPageBuilder[stl.Entry](page, pageSize)
+	err = common.ParseProbeParam(r.Form).Entries(
+		h.Store, start.Unix(), end.Unix(), pageBuilder)
+	if err != nil {
+		http_util.ReportError(w, "Error reading database", err)
+		return
+	}
+	entries, morePages := pageBuilder.Build()
+	response := entriesResponse{
+		Start:     start.Format(time.RFC3339),
+		End:       end.Format(time.RFC3339),
+		Page:      page,
+		PageSize:  pageSize,
+		MorePages: morePages,
+		Entries:   make([]*Entry, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		response.Entries = append(response.Entries, NewEntry(entry, loc))
+	}
+	writeJSON(w, &response)
+}
+
+// SummaryHandler serves summaries as JSON. The date parameter is of the
+// form yyyy, yyyyMM, or yyyyMMdd as on the summary and day pages and
+// defaults to the current month. The tz parameter is the time zone used
+// to group entries into periods. The probe parameter works as it does
+// for EntriesHandler. Summaries report how often tests met the
+// advertised plan in effect. Summaries include the day summaries of
+// pruned entries, which are grouped by the day they were summarised for
+// regardless of tz.
+type SummaryHandler struct {
+	Store    SummaryStore
+	Clock    date_util.Clock
+	Location *time.Location
+
+	// Percent of advertised speed a test must reach to meet the plan.
+	SLAPercent float64
+}
+
+// SummaryStore is what SummaryHandler needs from the store.
+type SummaryStore interface {
+	stldb.EntriesRunner
+	stldb.DaySummariesRunner
+	stldb.PlansRunner
+}
+
+func (h *SummaryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	loc, err := location(r.Form.Get(kTz), h.Location)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	current, handler := common.ParseDateParam(
+		r.Form.Get(common.Date),
+		h.Clock.Now().Unix(),
+		loc,
+		common.Month())
+	end := handler.End(current)
+	plans, err := h.Store.Plans(nil)
+	if err != nil {
+		http_util.ReportError(w, "Error reading database", err)
+		return
+	}
+	sla := aggregators.NewSLA(plans, h.SLAPercent)
+	var summary aggregators.Summary
+	consumers := []consume2.Consumer[stl.Entry]{
+		consume2.Call(summary.Add),
+		consume2.Call(func(entry stl.Entry) {
+			sla.Add(&summary.Compliance, entry)
+		}),
+	}
+	var totaler *aggregators.ByPeriodTotaler
+	if handler.Recurring() != nil {
+		totaler = aggregators.NewByPeriodTotaler(
+			current, end, handler.Recurring(), loc)
+		totaler.SetSLA(sla)
+		consumers = append(consumers, consume2.Call(totaler.Add))
+	}
+	probe := common.ParseProbeParam(r.Form)
+	err = probe.Entries(
+		h.Store,
+		dates.ToTimestamp(current, loc),
+		dates.ToTimestamp(end, loc),
+		consume2.Compose(consumers...))
+	if err != nil {
+		http_util.ReportError(w, "Error reading database", err)
+		return
+	}
+	err = probe.DaySummaries(
+		h.Store,
+		current,
+		end,
+		consume2.Call(func(day stl.DaySummary) {
+			summary.AddDaySummary(&day)
+			if totaler != nil {
+				totaler.AddDaySummary(day)
+			}
+		}))
+	if err != nil {
+		http_util.ReportError(w, "Error reading database", err)
+		return
+	}
+	response := summaryResponse{
+		Start:      toTime(current, loc).Format(time.RFC3339),
+		End:        toTime(end, loc).Format(time.RFC3339),
+		SLAPercent: sla.Percent(),
+		Summary:    toJSONSummary(&summary),
+		Periods:    []jsonDatedSummary{},
+	}
+	if totaler != nil {
+		for _, datedSummary := range totaler.DatedSummaries() {
+			response.Periods = append(
+				response.Periods,
+				jsonDatedSummary{
+					Start:       toTime(datedSummary.Date, loc).Format(time.RFC3339),
+					jsonSummary: toJSONSummary(&datedSummary.Summary),
+				})
+		}
+	}
+	writeJSON(w, &response)
+}
+
+// Entry is the JSON form of stl.Entry.
+type Entry struct {
+	Id                int64    `json:"id"`
+	Probe             string   `json:"probe,omitempty"`
+	Ts                string   `json:"ts"`
+	DownloadMbps      float64  `json:"downloadMbps"`
+	UploadMbps        float64  `json:"uploadMbps"`
+	PingMs            float64  `json:"pingMs"`
+	JitterMs          float64  `json:"jitterMs"`
+	PacketLossPercent float64  `json:"packetLossPercent"`
+	Retransmits       int64    `json:"retransmits"`
+	Status            string   `json:"status"`
+	Unmeasured        []string `json:"unmeasured,omitempty"`
+}
+
+// NewEntry converts entry to its JSON form. loc is the time zone for the
+// timestamp.
+func NewEntry(entry stl.Entry, loc *time.Location) *Entry {
+	return &Entry{
+		Id:                entry.Id,
+		Probe:             entry.Probe,
+		Ts:                time.Unix(entry.Ts, 0).In(loc).Format(time.RFC3339),
+		DownloadMbps:      entry.DownloadMbps,
+		UploadMbps:        entry.UploadMbps,
+		PingMs:            entry.PingMs,
+		JitterMs:          entry.JitterMs,
+		PacketLossPercent: entry.PacketLossPercent,
+		Retransmits:       entry.Retransmits,
+		Status:            entry.Status.String(),
+		Unmeasured:        entry.Unmeasured.Names(),
+	}
+}
+
+type entriesResponse struct {
+	Start     string   `json:"start"`
+	End       string   `json:"end"`
+	Page      int      `json:"page"`
+	PageSize  int      `json:"pageSize"`
+	MorePages bool     `json:"morePages"`
+	Entries   []*Entry `json:"entries"`
+}
+
+// jsonSummary is the JSON form of aggregators.Summary. Averages that
+// don't exist are null.
+type jsonSummary struct {
+	Samples           int      `json:"samples"`
+	DownloadMbps      *float64 `json:"downloadMbps"`
+	UploadMbps        *float64 `json:"uploadMbps"`
+	PingMs            *float64 `json:"pingMs"`
+	JitterMs          *float64 `json:"jitterMs"`
+	PacketLossPercent *float64 `json:"packetLossPercent"`
+	PercentUptime     *float64 `json:"percentUptime"`
+	PercentTimeUp     *float64 `json:"percentTimeUp"`
+	DowntimeSeconds   int64    `json:"downtimeSeconds"`
+	OutageCount       int      `json:"outageCount"`
+	LongestOutageSecs int64    `json:"longestOutageSeconds"`
+	ServiceLapse      bool     `json:"serviceLapse"`
+	FailedRuns        int      `json:"failedRuns"`
+	DownloadMeetsPlan *float64 `json:"percentDownloadMeetsPlan"`
+	UploadMeetsPlan   *float64 `json:"percentUploadMeetsPlan"`
+}
+
+func toJSONSummary(summary *aggregators.Summary) jsonSummary {
+	return jsonSummary{
+		Samples:           summary.PercentUptime.N,
+		DownloadMbps:      average(&summary.DownloadMbps),
+		UploadMbps:        average(&summary.UploadMbps),
+		PingMs:            average(&summary.PingMs),
+		JitterMs:          average(&summary.JitterMs),
+		PacketLossPercent: average(&summary.PacketLossPercent),
+		PercentUptime:     average(&summary.PercentUptime),
+		PercentTimeUp:     percentTimeUp(&summary.TimeUptime),
+		DowntimeSeconds:   summary.TimeUptime.DownSeconds,
+		OutageCount:       summary.OutageCount,
+		LongestOutageSecs: int64(summary.LongestOutage / time.Second),
+		ServiceLapse:      summary.ServiceLapse,
+		FailedRuns:        summary.FailedRuns,
+		DownloadMeetsPlan: average(&summary.Compliance.Download),
+		UploadMeetsPlan:   average(&summary.Compliance.Upload),
+	}
+}
+
+type jsonDatedSummary struct {
+	Start string `json:"start"`
+	jsonSummary
+}
+
+type summaryResponse struct {
+	Start      string             `json:"start"`
+	End        string             `json:"end"`
+	SLAPercent float64            `json:"slaPercent"`
+	Summary    jsonSummary        `json:"summary"`
+	Periods    []jsonDatedSummary `json:"periods"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func average(a *aggregators.Average) *float64 {
+	if !a.Exists() {
+		return nil
+	}
+	result := a.Avg()
+	return &result
+}
+
+func percentTimeUp(u *aggregators.Uptime) *float64 {
+	if !u.Exists() {
+		return nil
+	}
+	result := u.Percent()
+	return &result
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&errorResponse{Error: err.Error()})
+}
+
+// location returns the time zone named tz or defaultLoc if tz is empty.
+func location(tz string, defaultLoc *time.Location) (*time.Location, error) {
+	if tz == "" {
+		return defaultLoc, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, errors.New("bad tz: " + tz)
+	}
+	return loc, nil
+}
+
+// parseTime parses s as yyyyMMdd in loc or as an RFC 3339 timestamp.
+// If s is empty, parseTime returns defaultTime.
+func parseTime(
+	s string, defaultTime time.Time, loc *time.Location) (time.Time, error) {
+	if s == "" {
+		return defaultTime, nil
+	}
+	if len(s) == len(date_util.YMDFormat) {
+		date, err := time.ParseInLocation(date_util.YMDFormat, s, loc)
+		if err == nil {
+			return date, nil
+		}
+	}
+	result, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, errors.New("bad time: " + s)
+	}
+	return result, nil
+}
+
+// intParam parses s as an int between min and max inclusive. max of -1
+// means no maximum. If s is empty, intParam returns defaultValue.
+func intParam(s string, defaultValue, min, max int) (int, error) {
+	if s == "" {
+		return defaultValue, nil
+	}
+	result, err := strconv.Atoi(s)
+	if err != nil || result < min || (max != -1 && result > max) {
+		return 0, errors.New("bad number: " + s)
+	}
+	return result, nil
+}
+
+// today returns midnight of now's date in loc.
+func today(now time.Time, loc *time.Location) time.Time {
+	return toTime(dates.DatePart(now.Unix(), loc), loc)
+}
+
+// toTime converts a date to midnight in loc.
+func toTime(date time.Time, loc *time.Location) time.Time {
+	return time.Unix(dates.ToTimestamp(date, loc), 0).In(loc)
+}
@@ -0,0 +1,301 @@
+// Package chart renders simple inline SVG charts for the stlview pages.
+package chart
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"strings"
+
+	"github.com/keep94/speedtestlogger/stl/format"
+)
+
+const (
+	kMarginLeft   = 60
+	kMarginRight  = 20
+	kMarginTop    = 30
+	kMarginBottom = 40
+	kGridLines    = 5
+	kFontSize     = 14
+)
+
+const (
+	DownloadColor = "#1f77b4"
+	UploadColor   = "#ff7f0e"
+	UptimeColor   = "#2ca02c"
+)
+
+// Point is a single point in a line chart.
+type Point struct {
+	X float64
+	Y float64
+}
+
+// Series is a named series of points in a line chart.
+type Series struct {
+	Name   string
+	Color  string
+	Points []Point
+}
+
+// Label is a label on the x axis of a line chart.
+type Label struct {
+	X    float64
+	Text string
+}
+
+// LineChart is a line chart. The zero value of YMax means compute the
+// maximum y value from the data.
+type LineChart struct {
+	Width   int
+	Height  int
+	XMin    float64
+	XMax    float64
+	YMax    float64
+	YLabel  string
+	XLabels []Label
+	Series  []Series
+}
+
+// SVG returns this chart as inline SVG.
+func (c *LineChart) SVG() template.HTML {
+	yMax := c.YMax
+	if yMax == 0.0 {
+		for _, series := range c.Series {
+			for _, point := range series.Points {
+				yMax = math.Max(yMax, point.Y)
+			}
+		}
+		yMax = niceCeil(yMax)
+	}
+	p := newPlot(c.Width, c.Height, yMax)
+	var b strings.Builder
+	p.begin(&b, c.YLabel)
+	xScale := func(x float64) float64 {
+		if c.XMax == c.XMin {
+			return p.left
+		}
+		return p.left + (x-c.XMin)/(c.XMax-c.XMin)*p.width
+	}
+	for _, label := range c.XLabels {
+		p.xLabel(&b, xScale(label.X), label.Text)
+	}
+	for _, series := range c.Series {
+		if len(series.Points) == 0 {
+			continue
+		}
+		fmt.Fprintf(
+			&b,
+			`<polyline fill="none" stroke="%s" stroke-width="2" points="`,
+			series.Color)
+		for i, point := range series.Points {
+			if i > 0 {
+				b.WriteString(" ")
+			}
+			fmt.Fprintf(
+				&b, "%.1f,%.1f", xScale(point.X), p.yScale(point.Y))
+		}
+		b.WriteString(`"/>`)
+		for _, point := range series.Points {
+			fmt.Fprintf(
+				&b,
+				`<circle cx="%.1f" cy="%.1f" r="3" fill="%s"/>`,
+				xScale(point.X),
+				p.yScale(point.Y),
+				series.Color)
+		}
+	}
+	p.end(&b, legend(c.Series))
+	return template.HTML(b.String())
+}
+
+// BarSeries is a named series of bars in a bar chart. Exists[i] is false
+// if there is no value for the ith bar.
+type BarSeries struct {
+	Name   string
+	Color  string
+	Values []float64
+	Exists []bool
+}
+
+// BarChart is a grouped bar chart. Labels has one label for each group
+// of bars. The zero value of YMax means compute the maximum y value from
+// the data.
+type BarChart struct {
+	Width  int
+	Height int
+	YMax   float64
+	YLabel string
+	Labels []string
+	Series []BarSeries
+}
+
+// SVG returns this chart as inline SVG.
+func (c *BarChart) SVG() template.HTML {
+	yMax := c.YMax
+	if yMax == 0.0 {
+		for _, series := range c.Series {
+			for i, value := range series.Values {
+				if series.Exists[i] {
+					yMax = math.Max(yMax, value)
+				}
+			}
+		}
+		yMax = niceCeil(yMax)
+	}
+	p := newPlot(c.Width, c.Height, yMax)
+	var b strings.Builder
+	p.begin(&b, c.YLabel)
+	if len(c.Labels) > 0 && len(c.Series) > 0 {
+		groupWidth := p.width / float64(len(c.Labels))
+		barWidth := groupWidth * 0.8 / float64(len(c.Series))
+
+		// Skip labels so that they don't overlap
+		labelEvery := int(math.Ceil(float64(len(c.Labels)) * 40.0 / p.width))
+		for i, label := range c.Labels {
+			groupLeft := p.left + float64(i)*groupWidth
+			if i%labelEvery == 0 {
+				p.xLabel(&b, groupLeft+groupWidth/2.0, label)
+			}
+			for j, series := range c.Series {
+				if !series.Exists[i] {
+					continue
+				}
+				y := p.yScale(series.Values[i])
+				fmt.Fprintf(
+					&b,
+					`<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"><title>%s %s: %s</title></rect>`,
+					groupLeft+groupWidth*0.1+float64(j)*barWidth,
+					y,
+					barWidth,
+					p.bottom-y,
+					series.Color,
+					template.HTMLEscapeString(label),
+					template.HTMLEscapeString(series.Name),
+					format.Float(series.Values[i], 2))
+			}
+		}
+	}
+	var legendSeries []Series
+	for _, series := range c.Series {
+		legendSeries = append(
+			legendSeries, Series{Name: series.Name, Color: series.Color})
+	}
+	p.end(&b, legend(legendSeries))
+	return template.HTML(b.String())
+}
+
+type plot struct {
+	svgWidth  int
+	svgHeight int
+	left      float64
+	bottom    float64
+	width     float64
+	height    float64
+	yMax      float64
+}
+
+func newPlot(width, height int, yMax float64) *plot {
+	if yMax <= 0.0 {
+		yMax = 1.0
+	}
+	return &plot{
+		svgWidth:  width,
+		svgHeight: height,
+		left:      kMarginLeft,
+		bottom:    float64(height - kMarginBottom),
+		width:     float64(width - kMarginLeft - kMarginRight),
+		height:    float64(height - kMarginTop - kMarginBottom),
+		yMax:      yMax,
+	}
+}
+
+func (p *plot) yScale(y float64) float64 {
+	return p.bottom - y/p.yMax*p.height
+}
+
+func (p *plot) begin(b *strings.Builder, yLabel string) {
+	fmt.Fprintf(
+		b,
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="%d">`,
+		p.svgWidth,
+		p.svgHeight,
+		kFontSize)
+	for i := 0; i <= kGridLines; i++ {
+		value := p.yMax * float64(i) / kGridLines
+		y := p.yScale(value)
+		fmt.Fprintf(
+			b,
+			`<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#ddd"/>`,
+			p.left,
+			y,
+			p.left+p.width,
+			y)
+		fmt.Fprintf(
+			b,
+			`<text x="%.1f" y="%.1f" text-anchor="end">%s</text>`,
+			p.left-5,
+			y+5,
+			format.Float(value, 0))
+	}
+	fmt.Fprintf(
+		b,
+		`<text x="%.1f" y="%d">%s</text>`,
+		p.left,
+		kMarginTop-10,
+		template.HTMLEscapeString(yLabel))
+}
+
+func (p *plot) xLabel(b *strings.Builder, x float64, text string) {
+	fmt.Fprintf(
+		b,
+		`<text x="%.1f" y="%.1f" text-anchor="middle">%s</text>`,
+		x,
+		p.bottom+20,
+		template.HTMLEscapeString(text))
+}
+
+func (p *plot) end(b *strings.Builder, legendSVG string) {
+	fmt.Fprintf(
+		b,
+		`<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="black"/>`,
+		p.left,
+		p.bottom,
+		p.left+p.width,
+		p.bottom)
+	fmt.Fprintf(
+		b,
+		`<g transform="translate(%.1f,%d)">%s</g>`,
+		p.left+p.width-200,
+		kMarginTop-20,
+		legendSVG)
+	b.WriteString("</svg>")
+}
+
+func legend(series []Series) string {
+	var b strings.Builder
+	for i, s := range series {
+		fmt.Fprintf(
+			&b,
+			`<rect x="%d" y="0" width="12" height="12" fill="%s"/><text x="%d" y="11">%s</text>`,
+			i*100,
+			s.Color,
+			i*100+16,
+			template.HTMLEscapeString(s.Name))
+	}
+	return b.String()
+}
+
+// niceCeil rounds x up to 1, 2, 2.5 or 5 times a power of 10.
+func niceCeil(x float64) float64 {
+	if x <= 0.0 {
+		return 1.0
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(x)))
+	for _, step := range []float64{1.0, 2.0, 2.5, 5.0, 10.0} {
+		if x <= step*magnitude {
+			return step * magnitude
+		}
+	}
+	return 10.0 * magnitude
+}
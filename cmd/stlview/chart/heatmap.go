@@ -0,0 +1,194 @@
+package chart
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/keep94/speedtestlogger/stl/aggregators"
+	"github.com/keep94/speedtestlogger/stl/format"
+)
+
+const (
+	kCellWidth   = 36
+	kCellHeight  = 30
+	kHeatmapLeft = 50
+	kHeatmapTop  = 50
+	kEmptyColor  = "#eeeeee"
+)
+
+// HeatmapRow is one row of a heatmap. Exists[i] is false if there is no
+// value for the ith column.
+type HeatmapRow struct {
+	Label  string
+	Values []float64
+	Exists []bool
+}
+
+// Heatmap is a grid of cells colored from red to green. When HighIsGood
+// is true, the highest value is green and the lowest value is red;
+// otherwise the lowest value is green and the highest value is red. When
+// ZeroBased is true, the color scale starts at zero rather than the lowest
+// value. Places is the number of decimal places shown in each cell.
+type Heatmap struct {
+	Title      string
+	Labels     []string
+	Rows       []HeatmapRow
+	Places     int
+	HighIsGood bool
+	ZeroBased  bool
+}
+
+// SVG returns this heatmap as inline SVG.
+func (h *Heatmap) SVG() template.HTML {
+	low, high := math.Inf(1), math.Inf(-1)
+	if h.ZeroBased {
+		low = 0.0
+	}
+	for _, row := range h.Rows {
+		for i, value := range row.Values {
+			if row.Exists[i] {
+				low = math.Min(low, value)
+				high = math.Max(high, value)
+			}
+		}
+	}
+	width := kHeatmapLeft + kCellWidth*len(h.Labels) + kMarginRight
+	height := kHeatmapTop + kCellHeight*len(h.Rows) + kMarginRight
+	var b strings.Builder
+	fmt.Fprintf(
+		&b,
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="%d">`,
+		width,
+		height,
+		kFontSize)
+	fmt.Fprintf(
+		&b,
+		`<text x="%d" y="%d">%s</text>`,
+		kHeatmapLeft,
+		kMarginTop-10,
+		template.HTMLEscapeString(h.Title))
+	for i, label := range h.Labels {
+		fmt.Fprintf(
+			&b,
+			`<text x="%d" y="%d" text-anchor="middle">%s</text>`,
+			kHeatmapLeft+kCellWidth*i+kCellWidth/2,
+			kHeatmapTop-5,
+			template.HTMLEscapeString(label))
+	}
+	for r, row := range h.Rows {
+		y := kHeatmapTop + kCellHeight*r
+		fmt.Fprintf(
+			&b,
+			`<text x="%d" y="%d" text-anchor="end">%s</text>`,
+			kHeatmapLeft-5,
+			y+kCellHeight/2+5,
+			template.HTMLEscapeString(row.Label))
+		for i, value := range row.Values {
+			x := kHeatmapLeft + kCellWidth*i
+			color := kEmptyColor
+			text := ""
+			if row.Exists[i] {
+				color = h.color(value, low, high)
+				text = format.Float(value, h.Places)
+			}
+			fmt.Fprintf(
+				&b,
+				`<rect x="%d" y="%d" width="%d" height="%d" fill="%s" stroke="white"><title>%s %s: %s</title></rect>`,
+				x,
+				y,
+				kCellWidth,
+				kCellHeight,
+				color,
+				template.HTMLEscapeString(row.Label),
+				template.HTMLEscapeString(h.Labels[i]),
+				text)
+			fmt.Fprintf(
+				&b,
+				`<text x="%d" y="%d" text-anchor="middle" font-size="10">%s</text>`,
+				x+kCellWidth/2,
+				y+kCellHeight/2+4,
+				text)
+		}
+	}
+	b.WriteString("</svg>")
+	return template.HTML(b.String())
+}
+
+// color returns a color from red to green for value. When there is no
+// range of values to compare against, every value is green.
+func (h *Heatmap) color(value, low, high float64) string {
+	fraction := 1.0
+	if high > low {
+		fraction = (value - low) / (high - low)
+		if !h.HighIsGood {
+			fraction = 1.0 - fraction
+		}
+	}
+	return fmt.Sprintf("hsl(%.0f,70%%,55%%)", 120.0*fraction)
+}
+
+// HeatmapSpeeds returns a heatmap of average download speeds by day of
+// the week and hour of the day. weekStart is the day of the week in the
+// first row.
+func HeatmapSpeeds(
+	heatmap *aggregators.Heatmap, weekStart time.Weekday) *Heatmap {
+	return newHeatmap(
+		"Average Download (Mbps)",
+		heatmap,
+		weekStart,
+		func(cell *aggregators.HeatmapCell) *aggregators.Average {
+			return &cell.DownloadMbps
+		},
+		true)
+}
+
+// HeatmapLapses returns a heatmap of the percent of tests that were
+// outages by day of the week and hour of the day. weekStart is the day of
+// the week in the first row.
+func HeatmapLapses(
+	heatmap *aggregators.Heatmap, weekStart time.Weekday) *Heatmap {
+	return newHeatmap(
+		"Lapse Rate (%)",
+		heatmap,
+		weekStart,
+		func(cell *aggregators.HeatmapCell) *aggregators.Average {
+			return &cell.LapsePercent
+		},
+		false)
+}
+
+func newHeatmap(
+	title string,
+	heatmap *aggregators.Heatmap,
+	weekStart time.Weekday,
+	average func(cell *aggregators.HeatmapCell) *aggregators.Average,
+	highIsGood bool) *Heatmap {
+	result := &Heatmap{
+		Title:      title,
+		HighIsGood: highIsGood,
+		ZeroBased:  !highIsGood,
+	}
+	for hour := 0; hour < 24; hour++ {
+		result.Labels = append(result.Labels, fmt.Sprintf("%02d", hour))
+	}
+	for i := 0; i < 7; i++ {
+		weekday := (weekStart + time.Weekday(i)) % 7
+		row := HeatmapRow{Label: weekday.String()[:3]}
+		for hour := 0; hour < 24; hour++ {
+			cell := heatmap.Cell(weekday, hour)
+			avg := average(&cell)
+			if avg.Exists() {
+				row.Values = append(row.Values, avg.Avg())
+				row.Exists = append(row.Exists, true)
+			} else {
+				row.Values = append(row.Values, 0.0)
+				row.Exists = append(row.Exists, false)
+			}
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result
+}
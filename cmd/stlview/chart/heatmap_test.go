@@ -0,0 +1,43 @@
+package chart_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/keep94/speedtestlogger/cmd/stlview/chart"
+	"github.com/keep94/speedtestlogger/stl"
+	"github.com/keep94/speedtestlogger/stl/aggregators"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	kGreen = "hsl(120,70%,55%)"
+	kRed   = "hsl(0,70%,55%)"
+)
+
+func TestHeatmapLapsesNoLapses(t *testing.T) {
+	heatmap := aggregators.NewHeatmap(time.UTC)
+	heatmap.Add(stl.Entry{Ts: 1741600800, DownloadMbps: 90.0, UploadMbps: 9.0})
+	heatmap.Add(stl.Entry{Ts: 1741690800, DownloadMbps: 80.0, UploadMbps: 8.0})
+	svg := string(chart.HeatmapLapses(heatmap, time.Sunday).SVG())
+	assert.Contains(t, svg, kGreen)
+	assert.NotContains(t, svg, kRed)
+}
+
+func TestHeatmapSpeedsSameSpeed(t *testing.T) {
+	heatmap := aggregators.NewHeatmap(time.UTC)
+	heatmap.Add(stl.Entry{Ts: 1741600800, DownloadMbps: 90.0, UploadMbps: 9.0})
+	heatmap.Add(stl.Entry{Ts: 1741690800, DownloadMbps: 90.0, UploadMbps: 9.0})
+	svg := string(chart.HeatmapSpeeds(heatmap, time.Sunday).SVG())
+	assert.Contains(t, svg, kGreen)
+	assert.NotContains(t, svg, kRed)
+}
+
+func TestHeatmapLapses(t *testing.T) {
+	heatmap := aggregators.NewHeatmap(time.UTC)
+	heatmap.Add(stl.Entry{Ts: 1741600800, DownloadMbps: 90.0, UploadMbps: 9.0})
+	heatmap.Add(stl.Entry{Ts: 1741690800, Status: stl.StatusOutage})
+	svg := string(chart.HeatmapLapses(heatmap, time.Sunday).SVG())
+	assert.Contains(t, svg, kGreen)
+	assert.Contains(t, svg, kRed)
+}
@@ -0,0 +1,132 @@
+package chart
+
+import (
+	"time"
+
+	"github.com/keep94/speedtestlogger/stl"
+	"github.com/keep94/speedtestlogger/stl/aggregators"
+	"github.com/keep94/speedtestlogger/stl/dates"
+)
+
+const (
+	kWidth      = 900
+	kHeight     = 300
+	kHoursApart = 3
+)
+
+// EntrySpeeds returns a line chart of download and upload speeds for
+// entries between start inclusive and end exclusive. start and end are
+// dates; the x axis runs from midnight of start to midnight of end in
+// loc. entries are ordered most recent to least recent. Failed test runs
+// are not plotted.
+func EntrySpeeds(
+	entries []*stl.Entry, start, end time.Time, loc *time.Location) *LineChart {
+	download := Series{Name: "Download", Color: DownloadColor}
+	upload := Series{Name: "Upload", Color: UploadColor}
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if entry.Status == stl.StatusToolError || entry.Status == stl.StatusTimeout {
+			continue
+		}
+		x := float64(entry.Ts)
+		download.Points = append(
+			download.Points, Point{X: x, Y: entry.DownloadMbps})
+		upload.Points = append(upload.Points, Point{X: x, Y: entry.UploadMbps})
+	}
+	startTs := dates.ToTimestamp(start, loc)
+	endTs := dates.ToTimestamp(end, loc)
+	var labels []Label
+	for hour := 0; hour < 24; hour += kHoursApart {
+		labelTime := time.Date(
+			start.Year(), start.Month(), start.Day(), hour, 0, 0, 0, loc)
+		if labelTime.Unix() >= endTs {
+			break
+		}
+		labels = append(
+			labels,
+			Label{X: float64(labelTime.Unix()), Text: labelTime.Format("15:04")})
+	}
+	return &LineChart{
+		Width:   kWidth,
+		Height:  kHeight,
+		XMin:    float64(startTs),
+		XMax:    float64(endTs),
+		YLabel:  "Mbps",
+		XLabels: labels,
+		Series:  []Series{download, upload},
+	}
+}
+
+// SummarySpeeds returns a bar chart of average download and upload speeds
+// for each summary. summaries are ordered most recent to least recent.
+// label returns the label for each summary date.
+func SummarySpeeds(
+	summaries []*aggregators.DatedSummary,
+	label func(time.Time) string) *BarChart {
+	download := BarSeries{Name: "Download", Color: DownloadColor}
+	upload := BarSeries{Name: "Upload", Color: UploadColor}
+	labels := forEachChronological(summaries, label, func(s *aggregators.DatedSummary) {
+		download.add(&s.DownloadMbps)
+		upload.add(&s.UploadMbps)
+	})
+	return &BarChart{
+		Width:  kWidth,
+		Height: kHeight,
+		YLabel: "Average Mbps",
+		Labels: labels,
+		Series: []BarSeries{download, upload},
+	}
+}
+
+// SummaryUptime returns a bar chart of time weighted percent uptime for
+// each summary.
+// summaries are ordered most recent to least recent. label returns the
+// label for each summary date.
+func SummaryUptime(
+	summaries []*aggregators.DatedSummary,
+	label func(time.Time) string) *BarChart {
+	uptime := BarSeries{Name: "Uptime", Color: UptimeColor}
+	labels := forEachChronological(summaries, label, func(s *aggregators.DatedSummary) {
+		uptime.addUptime(&s.TimeUptime)
+	})
+	return &BarChart{
+		Width:  kWidth,
+		Height: kHeight,
+		YMax:   100.0,
+		YLabel: "% Uptime",
+		Labels: labels,
+		Series: []BarSeries{uptime},
+	}
+}
+
+func (b *BarSeries) add(average *aggregators.Average) {
+	if average.Exists() {
+		b.Values = append(b.Values, average.Avg())
+		b.Exists = append(b.Exists, true)
+	} else {
+		b.Values = append(b.Values, 0.0)
+		b.Exists = append(b.Exists, false)
+	}
+}
+
+func (b *BarSeries) addUptime(uptime *aggregators.Uptime) {
+	if uptime.Exists() {
+		b.Values = append(b.Values, uptime.Percent())
+		b.Exists = append(b.Exists, true)
+	} else {
+		b.Values = append(b.Values, 0.0)
+		b.Exists = append(b.Exists, false)
+	}
+}
+
+func forEachChronological(
+	summaries []*aggregators.DatedSummary,
+	label func(time.Time) string,
+	f func(s *aggregators.DatedSummary)) []string {
+	var labels []string
+	for i := len(summaries) - 1; i >= 0; i-- {
+		labels = append(labels, label(summaries[i].Date))
+		f(summaries[i])
+	}
+	return labels
+}
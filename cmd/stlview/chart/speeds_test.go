@@ -0,0 +1,48 @@
+package chart_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/keep94/speedtestlogger/cmd/stlview/chart"
+	"github.com/keep94/speedtestlogger/stl"
+	"github.com/keep94/toolbox/date_util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEntrySpeedsInLocation(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("Error loading location: %v", err)
+	}
+	evening := time.Date(2025, 3, 12, 21, 30, 0, 0, loc).Unix()
+	morning := time.Date(2025, 3, 12, 0, 30, 0, 0, loc).Unix()
+	entries := []*stl.Entry{
+		{Ts: evening, DownloadMbps: 90.0, UploadMbps: 9.0},
+		{Ts: morning, DownloadMbps: 80.0, UploadMbps: 8.0},
+	}
+	lineChart := chart.EntrySpeeds(
+		entries,
+		date_util.YMD(2025, 3, 12),
+		date_util.YMD(2025, 3, 13),
+		loc)
+	assert.Equal(
+		t,
+		float64(time.Date(2025, 3, 12, 0, 0, 0, 0, loc).Unix()),
+		lineChart.XMin)
+	assert.Equal(
+		t,
+		float64(time.Date(2025, 3, 13, 0, 0, 0, 0, loc).Unix()),
+		lineChart.XMax)
+	for _, series := range lineChart.Series {
+		for _, point := range series.Points {
+			assert.GreaterOrEqual(t, point.X, lineChart.XMin)
+			assert.Less(t, point.X, lineChart.XMax)
+		}
+	}
+	if assert.Len(t, lineChart.XLabels, 8) {
+		assert.Equal(t, "00:00", lineChart.XLabels[0].Text)
+		assert.Equal(t, lineChart.XMin, lineChart.XLabels[0].X)
+		assert.Equal(t, "21:00", lineChart.XLabels[7].Text)
+	}
+}
@@ -6,9 +6,12 @@ import (
 	"net/url"
 	"time"
 
+	"github.com/keep94/consume2"
+	"github.com/keep94/speedtestlogger/stl"
 	"github.com/keep94/speedtestlogger/stl/aggregators"
 	"github.com/keep94/speedtestlogger/stl/dates"
 	"github.com/keep94/speedtestlogger/stl/format"
+	"github.com/keep94/speedtestlogger/stl/stldb"
 	"github.com/keep94/toolbox/date_util"
 	"github.com/keep94/toolbox/http_util"
 )
@@ -17,6 +20,20 @@ const (
 	Date        = "date"
 	DayPage     = "/day"
 	SummaryPage = "/summary"
+	EntriesApi  = "/api/v1/entries"
+	SummaryApi  = "/api/v1/summary"
+	MetricsPage = "/metrics"
+	ExportPage  = "/export"
+	OutagesPage = "/outages"
+	HeatmapPage = "/heatmap"
+	ProbesPage  = "/probes"
+	Format      = "format"
+	Probe       = "probe"
+)
+
+const (
+	kWeekPrefix = 'w'
+	kWeekFormat = "w20060102"
 )
 
 // NewTemplate returns a new template instance. name is the name
@@ -46,6 +63,24 @@ func (s *SpeedFormatter) FormatSpeed(mbps float64) string {
 	return format.Float(mbps, 2)
 }
 
+// LatencyFormatter formats latencies.
+type LatencyFormatter struct {
+}
+
+// FormatLatency formats a latency in milliseconds.
+func (l *LatencyFormatter) FormatLatency(ms float64) string {
+	return format.Float(ms, 1)
+}
+
+// DurationFormatter formats durations.
+type DurationFormatter struct {
+}
+
+// FormatDuration formats a duration.
+func (d *DurationFormatter) FormatDuration(duration time.Duration) string {
+	return format.Duration(duration)
+}
+
 // PercentFormat formats percents.
 type PercentFormatter struct {
 }
@@ -61,6 +96,9 @@ func (p *PercentFormatter) FormatPercent(percent float64) string {
 // then ParseDateParam returns the year and month with the month
 // DateHandler. If the date parameter is of the form yyyyMMdd, then
 // ParseDateParam returns the year, month, and day with the day DateHandler.
+// If the date parameter is of the form wyyyyMMdd, then ParseDateParam
+// returns the year, month, and day with a week DateHandler for the week
+// starting on that day.
 // If there is an error parsing the date, ParseDateParam returns the
 // current date according to the now and loc parameter normalized with the
 // defaultHandler along with the defaultHandler.
@@ -70,7 +108,12 @@ func ParseDateParam(
 	loc *time.Location,
 	defaultHandler DateHandler) (time.Time, DateHandler) {
 	var returnedHandler DateHandler
-	if len(dateParam) == 4 {
+	if len(dateParam) == 9 && dateParam[0] == kWeekPrefix {
+		result, err := time.Parse(date_util.YMDFormat, dateParam[1:])
+		if err == nil {
+			return result, Week(result.Weekday())
+		}
+	} else if len(dateParam) == 4 {
 		returnedHandler = Year()
 		dateParam += "0101"
 	} else if len(dateParam) == 6 {
@@ -96,6 +139,9 @@ type DateHandler interface {
 	// DrillDownFormat returns the date in the summary table properly formatted
 	DrillDownFormat(date time.Time) string
 
+	// ChartFormat returns the date in the summary chart properly formatted
+	ChartFormat(date time.Time) string
+
 	// DrillUp returns the link to the page one level up.
 	DrillUp(current time.Time) *url.URL
 
@@ -116,6 +162,167 @@ type DateHandler interface {
 
 	// Normalize normalizes the current date
 	Normalize(current time.Time) time.Time
+
+	// Param returns the current date as a date parameter value.
+	Param(current time.Time) string
+
+	// Self returns the link to the current page.
+	Self(current time.Time) *url.URL
+}
+
+// OnPage returns a copy of u with the path changed to page. OnPage
+// returns nil if u is nil.
+func OnPage(u *url.URL, page string) *url.URL {
+	if u == nil {
+		return nil
+	}
+	result := *u
+	result.Path = page
+	return &result
+}
+
+// ExportUrl returns the link to export the entries for the current page.
+// format is either "csv" or "ndjson".
+func ExportUrl(handler DateHandler, current time.Time, format string) *url.URL {
+	result := OnPage(handler.Self(current), ExportPage)
+	values := result.Query()
+	values.Set(Format, format)
+	result.RawQuery = values.Encode()
+	return result
+}
+
+// ProbeFilter selects the entries of one probe or of all probes.
+type ProbeFilter struct {
+
+	// The selected probe. "" means the default probe.
+	Name string
+
+	// True means all probes are selected, and Name is ignored.
+	All bool
+}
+
+// ParseProbeParam returns the probe selected by the probe parameter in
+// values. If there is no probe parameter, all probes are selected. An
+// empty probe parameter selects the default probe.
+func ParseProbeParam(values url.Values) ProbeFilter {
+	names, ok := values[Probe]
+	if !ok {
+		return ProbeFilter{All: true}
+	}
+	return ProbeFilter{Name: names[0]}
+}
+
+// Entries sends the selected entries between startTime and endTime to
+// consumer, most recent first.
+func (p ProbeFilter) Entries(
+	store stldb.EntriesRunner,
+	startTime,
+	endTime int64,
+	consumer consume2.Consumer[stl.Entry]) error {
+	if p.All {
+		return store.Entries(nil, startTime, endTime, consumer)
+	}
+	return store.ProbeEntries(nil, p.Name, startTime, endTime, consumer)
+}
+
+// DaySummaries sends the selected day summaries for the days from start
+// up to but not including end to consumer, most recent first. start and
+// end are dates like those ParseDateParam returns.
+func (p ProbeFilter) DaySummaries(
+	store stldb.DaySummariesRunner,
+	start,
+	end time.Time,
+	consumer consume2.Consumer[stl.DaySummary]) error {
+	if p.All {
+		return store.DaySummaries(nil, start.Unix(), end.Unix(), consumer)
+	}
+	return store.ProbeDaySummaries(
+		nil, p.Name, start.Unix(), end.Unix(), consumer)
+}
+
+// DatedSummaries returns the stored summaries of the selected probes for
+// each period from start up to but not including end, most recent first.
+// See stldb.DatedSummariesRunner.
+func (p ProbeFilter) DatedSummaries(
+	store stldb.DatedSummariesRunner,
+	recurring aggregators.Recurring,
+	start,
+	end time.Time) ([]*aggregators.DatedSummary, error) {
+	if p.All {
+		return store.DatedSummaries(nil, recurring, start, end)
+	}
+	return store.ProbeDatedSummaries(nil, p.Name, recurring, start, end)
+}
+
+// Apply returns a copy of u with the probe parameter set to select the
+// same probes as p. Apply returns nil if u is nil.
+func (p ProbeFilter) Apply(u *url.URL) *url.URL {
+	if u == nil {
+		return nil
+	}
+	result := *u
+	values := result.Query()
+	if p.All {
+		values.Del(Probe)
+	} else {
+		values.Set(Probe, p.Name)
+	}
+	result.RawQuery = values.Encode()
+	return &result
+}
+
+// String returns the name of the selected probe for display.
+func (p ProbeFilter) String() string {
+	switch {
+	case p.All:
+		return "all probes"
+	case p.Name == "":
+		return "default"
+	default:
+		return p.Name
+	}
+}
+
+// ProbeLink is a choice in the probe selector.
+type ProbeLink struct {
+	ProbeFilter
+
+	// The link that selects the probe. nil if the probe is already
+	// selected.
+	Link *url.URL
+}
+
+// ProbeLinks returns the choices for the probe selector on the page at
+// self. selected is the probe currently selected; probes is the names of
+// all the probes. The first choice selects all probes. ProbeLinks returns
+// nil if the default probe is the only probe as there is nothing to
+// choose.
+func ProbeLinks(
+	self *url.URL, selected ProbeFilter, probes []string) []ProbeLink {
+	if len(probes) == 0 || (len(probes) == 1 && probes[0] == "") {
+		return nil
+	}
+	filters := []ProbeFilter{{All: true}}
+	for _, probe := range probes {
+		filters = append(filters, ProbeFilter{Name: probe})
+	}
+	result := make([]ProbeLink, len(filters))
+	for i, filter := range filters {
+		result[i].ProbeFilter = filter
+		if filter != selected {
+			result[i].Link = filter.Apply(self)
+		}
+	}
+	return result
+}
+
+// ForProbe returns a DateHandler that works like handler except that the
+// links it returns keep the probe that p selects.
+func ForProbe(handler DateHandler, p ProbeFilter) DateHandler {
+	if p.All {
+		return handler
+	}
+	return probeHandler{DateHandler: handler, probe: p}
 }
 
 func Day() DateHandler {
@@ -130,6 +337,19 @@ func Year() DateHandler {
 	return yearHandler{}
 }
 
+// Week returns the DateHandler for weeks starting on start. Weeks show
+// daily summaries.
+func Week(start time.Weekday) DateHandler {
+	return weekHandler{start: start}
+}
+
+// Hours returns the DateHandler that shows hourly summaries for a day.
+// loc is the time zone of the hours; weekStart is the first day of the
+// week that DrillUp links to.
+func Hours(loc *time.Location, weekStart time.Weekday) DateHandler {
+	return hoursHandler{loc: loc, weekStart: weekStart}
+}
+
 type dayHandler struct {
 }
 
@@ -141,6 +361,10 @@ func (d dayHandler) DrillDownFormat(date time.Time) string {
 	return ""
 }
 
+func (d dayHandler) ChartFormat(date time.Time) string {
+	return ""
+}
+
 func (d dayHandler) DrillUp(current time.Time) *url.URL {
 	month := aggregators.Monthly().Normalize(current)
 	return http_util.NewUrl(SummaryPage, Date, month.Format("200601"))
@@ -172,6 +396,14 @@ func (d dayHandler) Normalize(current time.Time) time.Time {
 	return aggregators.Daily().Normalize(current)
 }
 
+func (d dayHandler) Param(current time.Time) string {
+	return current.Format("20060102")
+}
+
+func (d dayHandler) Self(current time.Time) *url.URL {
+	return http_util.NewUrl(DayPage, Date, d.Param(current))
+}
+
 type monthHandler struct {
 }
 
@@ -183,6 +415,10 @@ func (m monthHandler) DrillDownFormat(date time.Time) string {
 	return date.Format("Mon 01/02/2006")
 }
 
+func (m monthHandler) ChartFormat(date time.Time) string {
+	return date.Format("2")
+}
+
 func (m monthHandler) DrillUp(current time.Time) *url.URL {
 	year := aggregators.Yearly().Normalize(current)
 	return http_util.NewUrl(SummaryPage, Date, year.Format("2006"))
@@ -214,6 +450,14 @@ func (m monthHandler) Normalize(current time.Time) time.Time {
 	return aggregators.Monthly().Normalize(current)
 }
 
+func (m monthHandler) Param(current time.Time) string {
+	return current.Format("200601")
+}
+
+func (m monthHandler) Self(current time.Time) *url.URL {
+	return http_util.NewUrl(SummaryPage, Date, m.Param(current))
+}
+
 type yearHandler struct {
 }
 
@@ -225,6 +469,10 @@ func (y yearHandler) DrillDownFormat(date time.Time) string {
 	return date.Format("01/2006")
 }
 
+func (y yearHandler) ChartFormat(date time.Time) string {
+	return date.Format("Jan")
+}
+
 func (y yearHandler) DrillUp(current time.Time) *url.URL {
 	return nil
 }
@@ -254,3 +502,147 @@ func (y yearHandler) End(current time.Time) time.Time {
 func (y yearHandler) Normalize(current time.Time) time.Time {
 	return aggregators.Yearly().Normalize(current)
 }
+
+func (y yearHandler) Param(current time.Time) string {
+	return current.Format("2006")
+}
+
+func (y yearHandler) Self(current time.Time) *url.URL {
+	return http_util.NewUrl(SummaryPage, Date, y.Param(current))
+}
+
+type weekHandler struct {
+	start time.Weekday
+}
+
+func (w weekHandler) DrillDown(date time.Time) *url.URL {
+	return http_util.NewUrl(SummaryPage, Date, date.Format("20060102"))
+}
+
+func (w weekHandler) DrillDownFormat(date time.Time) string {
+	return date.Format("Mon 01/02/2006")
+}
+
+func (w weekHandler) ChartFormat(date time.Time) string {
+	return date.Format("Mon")
+}
+
+func (w weekHandler) DrillUp(current time.Time) *url.URL {
+	month := aggregators.Monthly().Normalize(current)
+	return http_util.NewUrl(SummaryPage, Date, month.Format("200601"))
+}
+
+func (w weekHandler) Format(current time.Time) string {
+	return current.Format("week of Mon 01/02/2006")
+}
+
+func (w weekHandler) Prev(current time.Time) *url.URL {
+	prev := aggregators.Weekly(w.start).Add(current, -1)
+	return http_util.NewUrl(SummaryPage, Date, prev.Format(kWeekFormat))
+}
+
+func (w weekHandler) Next(current time.Time) *url.URL {
+	next := aggregators.Weekly(w.start).Add(current, 1)
+	return http_util.NewUrl(SummaryPage, Date, next.Format(kWeekFormat))
+}
+
+func (w weekHandler) Recurring() aggregators.Recurring {
+	return aggregators.Daily()
+}
+
+func (w weekHandler) End(current time.Time) time.Time {
+	return aggregators.Weekly(w.start).Add(current, 1)
+}
+
+func (w weekHandler) Normalize(current time.Time) time.Time {
+	return aggregators.Weekly(w.start).Normalize(current)
+}
+
+func (w weekHandler) Param(current time.Time) string {
+	return current.Format(kWeekFormat)
+}
+
+func (w weekHandler) Self(current time.Time) *url.URL {
+	return http_util.NewUrl(SummaryPage, Date, w.Param(current))
+}
+
+type hoursHandler struct {
+	loc       *time.Location
+	weekStart time.Weekday
+}
+
+func (h hoursHandler) DrillDown(hour time.Time) *url.URL {
+	return http_util.NewUrl(DayPage, Date, hour.Format("20060102"))
+}
+
+func (h hoursHandler) DrillDownFormat(hour time.Time) string {
+	return hour.Format("15:04 MST")
+}
+
+func (h hoursHandler) ChartFormat(hour time.Time) string {
+	return hour.Format("15")
+}
+
+func (h hoursHandler) DrillUp(current time.Time) *url.URL {
+	week := aggregators.Weekly(h.weekStart).Normalize(current)
+	return http_util.NewUrl(SummaryPage, Date, week.Format(kWeekFormat))
+}
+
+func (h hoursHandler) Format(current time.Time) string {
+	return current.Format("Mon 01/02/2006")
+}
+
+func (h hoursHandler) Prev(current time.Time) *url.URL {
+	prev := aggregators.Daily().Add(current, -1)
+	return http_util.NewUrl(SummaryPage, Date, prev.Format("20060102"))
+}
+
+func (h hoursHandler) Next(current time.Time) *url.URL {
+	next := aggregators.Daily().Add(current, 1)
+	return http_util.NewUrl(SummaryPage, Date, next.Format("20060102"))
+}
+
+func (h hoursHandler) Recurring() aggregators.Recurring {
+	return aggregators.Hourly(h.loc)
+}
+
+func (h hoursHandler) End(current time.Time) time.Time {
+	return aggregators.Daily().Add(current, 1)
+}
+
+func (h hoursHandler) Normalize(current time.Time) time.Time {
+	return aggregators.Daily().Normalize(current)
+}
+
+func (h hoursHandler) Param(current time.Time) string {
+	return current.Format("20060102")
+}
+
+func (h hoursHandler) Self(current time.Time) *url.URL {
+	return http_util.NewUrl(SummaryPage, Date, h.Param(current))
+}
+
+type probeHandler struct {
+	DateHandler
+	probe ProbeFilter
+}
+
+func (p probeHandler) DrillDown(date time.Time) *url.URL {
+	return p.probe.Apply(p.DateHandler.DrillDown(date))
+}
+
+func (p probeHandler) DrillUp(current time.Time) *url.URL {
+	return p.probe.Apply(p.DateHandler.DrillUp(current))
+}
+
+func (p probeHandler) Prev(current time.Time) *url.URL {
+	return p.probe.Apply(p.DateHandler.Prev(current))
+}
+
+func (p probeHandler) Next(current time.Time) *url.URL {
+	return p.probe.Apply(p.DateHandler.Next(current))
+}
+
+func (p probeHandler) Self(current time.Time) *url.URL {
+	return p.probe.Apply(p.DateHandler.Self(current))
+}
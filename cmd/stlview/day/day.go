@@ -3,10 +3,13 @@ package day
 import (
 	"html/template"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/keep94/consume2"
+	"github.com/keep94/speedtestlogger/cmd/stlview/chart"
 	"github.com/keep94/speedtestlogger/cmd/stlview/common"
+	"github.com/keep94/speedtestlogger/cmd/stlview/export"
 	"github.com/keep94/speedtestlogger/stl"
 	"github.com/keep94/speedtestlogger/stl/aggregators"
 	"github.com/keep94/speedtestlogger/stl/dates"
@@ -36,22 +39,43 @@ var (
   </style>
 </head>
 <body>
-  <h1>Speeds for {{.Format .Current}} &nbsp; &nbsp; Build: {{.BuildId}}</h1>
-  <a href="{{.Prev .Current}}">prev</a> &nbsp; <a href="{{.Next .Current}}">next</a> &nbsp; <a href="{{.DrillUp .Current}}">up</a>
+  <h1>Speeds for {{.Format .Current}}{{if not .Probe.All}} at {{.Probe}}{{end}} &nbsp; &nbsp; Build: {{.BuildId}}</h1>
+  <a href="{{.Prev .Current}}">prev</a> &nbsp; <a href="{{.Next .Current}}">next</a> &nbsp; <a href="{{.DrillUp .Current}}">up</a> &nbsp; <a href="{{.HoursLink}}">hours</a> &nbsp; <a href="{{.OutagesLink}}">outages</a> &nbsp; Export: <a href="{{.ExportCSV}}">csv</a> <a href="{{.ExportNDJSON}}">ndjson</a>
+  {{if .ProbeLinks}}
+  <br><br>
+  Probe: {{range .ProbeLinks}}{{if .Link}}<a href="{{.Link}}">{{.String}}</a>{{else}}<b>{{.String}}</b>{{end}} &nbsp; {{end}}<a href="{{.CompareLink}}">side by side</a>
+  {{end}}
   <br><br>
   <span class="normal">
   {{with $top := .}}
   Download Average (Mbps): {{with .Summary.DownloadMbps}}{{if .Exists}}{{$top.FormatSpeed .Avg}}{{else}}--{{end}}{{end}}
   <br>
   Upload Average (Mbps): {{with .Summary.UploadMbps}}{{if .Exists}}{{$top.FormatSpeed .Avg}}{{else}}--{{end}}{{end}}
+  <br>
+  Ping Average (ms): {{with .Summary.PingMs}}{{if .Exists}}{{$top.FormatLatency .Avg}}{{else}}--{{end}}{{end}}
+  <br>
+  Jitter Average (ms): {{with .Summary.JitterMs}}{{if .Exists}}{{$top.FormatLatency .Avg}}{{else}}--{{end}}{{end}}
+  <br>
+  Packet Loss Average (%): {{with .Summary.PacketLossPercent}}{{if .Exists}}{{$top.FormatPercent .Avg}}{{else}}--{{end}}{{end}}
+  <br>
+  Failed Test Runs: {{.Summary.FailedRuns}}
   {{end}}
   </span>
   <br><br>
+  {{.SpeedChart.SVG}}
+  <br><br>
   <table border=1>
     <tr>
       <th>Timestamp</th>
       <th>Download (Mbps)</th>
       <th>Upload (Mbps)</th>
+      <th>Ping (ms)</th>
+      <th>Jitter (ms)</th>
+      <th>Loss (%)</th>
+      <th>Status</th>
+      {{if .ProbeLinks}}
+      <th>Probe</th>
+      {{end}}
     </tr>
     {{with $top := .}}
     {{range .Entries}}
@@ -59,6 +83,13 @@ var (
       <td>{{$top.FormatTimestamp .Ts}}</td>
       <td align="right">{{$top.FormatSpeed .DownloadMbps}}</td>
       <td align="right">{{$top.FormatSpeed .UploadMbps}}</td>
+      <td align="right">{{if .HasLatency}}{{$top.FormatLatency .PingMs}}{{else}}--{{end}}</td>
+      <td align="right">{{if .HasJitter}}{{$top.FormatLatency .JitterMs}}{{else}}--{{end}}</td>
+      <td align="right">{{if .HasPacketLoss}}{{$top.FormatPercent .PacketLossPercent}}{{else}}--{{end}}</td>
+      <td>{{if .Status}}{{.Status}}{{else}}&nbsp;{{end}}</td>
+      {{if $top.ProbeLinks}}
+      <td>{{if .Probe}}{{.Probe}}{{else}}default{{end}}</td>
+      {{end}}
     </tr>
     {{end}}
     {{end}}
@@ -72,12 +103,18 @@ var (
 )
 
 type Handler struct {
-	Store    stldb.EntriesRunner
+	Store    Store
 	BuildId  string
 	Clock    date_util.Clock
 	Location *time.Location
 }
 
+// Store is what Handler needs from the store.
+type Store interface {
+	stldb.EntriesRunner
+	stldb.ProbesRunner
+}
+
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 	current, _ := common.ParseDateParam(
@@ -85,11 +122,17 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h.Clock.Now().Unix(),
 		h.Location,
 		common.Day())
-	handler := common.Day()
+	probe := common.ParseProbeParam(r.Form)
+	handler := common.ForProbe(common.Day(), probe)
+	probes, err := h.Store.Probes(nil)
+	if err != nil {
+		http_util.ReportError(w, "Error reading database", err)
+		return
+	}
 	var entries []*stl.Entry
 	var summary aggregators.Summary
-	err := h.Store.Entries(
-		nil,
+	err = probe.Entries(
+		h.Store,
 		dates.ToTimestamp(current, h.Location),
 		dates.ToTimestamp(handler.End(current), h.Location),
 		consume2.Compose(
@@ -105,24 +148,45 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		kTemplate,
 		&view{
 			common.SpeedFormatter{},
+			common.LatencyFormatter{},
+			common.PercentFormatter{},
 			common.TimestampFormatter{Location: h.Location},
 			handler,
 			current,
 			h.BuildId,
 			entries,
 			summary,
+			chart.EntrySpeeds(
+				entries, current, handler.End(current), h.Location),
+			common.ExportUrl(handler, current, export.CSV),
+			common.ExportUrl(handler, current, export.NDJSON),
+			common.OnPage(handler.Self(current), common.OutagesPage),
+			common.OnPage(handler.Self(current), common.SummaryPage),
+			probe,
+			common.ProbeLinks(common.Day().Self(current), probe, probes),
+			common.OnPage(common.Day().Self(current), common.ProbesPage),
 		},
 	)
 }
 
 type view struct {
 	common.SpeedFormatter
+	common.LatencyFormatter
+	common.PercentFormatter
 	common.TimestampFormatter
 	common.DateHandler
-	Current time.Time
-	BuildId string
-	Entries []*stl.Entry
-	Summary aggregators.Summary
+	Current      time.Time
+	BuildId      string
+	Entries      []*stl.Entry
+	Summary      aggregators.Summary
+	SpeedChart   *chart.LineChart
+	ExportCSV    *url.URL
+	ExportNDJSON *url.URL
+	OutagesLink  *url.URL
+	HoursLink    *url.URL
+	Probe        common.ProbeFilter
+	ProbeLinks   []common.ProbeLink
+	CompareLink  *url.URL
 }
 
 func init() {
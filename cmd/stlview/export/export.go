@@ -0,0 +1,158 @@
+// Package export contains the handler that exports entries as csv or
+// newline delimited json.
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/speedtestlogger/cmd/stlview/api"
+	"github.com/keep94/speedtestlogger/cmd/stlview/common"
+	"github.com/keep94/speedtestlogger/stl"
+	"github.com/keep94/speedtestlogger/stl/dates"
+	"github.com/keep94/speedtestlogger/stl/format"
+	"github.com/keep94/speedtestlogger/stl/stldb"
+	"github.com/keep94/toolbox/date_util"
+	"github.com/keep94/toolbox/http_util"
+)
+
+const (
+	CSV    = "csv"
+	NDJSON = "ndjson"
+)
+
+var (
+	kCSVHeader = []string{
+		"timestamp",
+		"download_mbps",
+		"upload_mbps",
+		"ping_ms",
+		"jitter_ms",
+		"packet_loss_percent",
+		"status",
+		"probe",
+	}
+)
+
+// Handler streams the entries for a day, month, or year as a file
+// download. The date parameter works as it does on the day and summary
+// pages. The format parameter is either csv or ndjson. Entries are
+// written as they are read from the store rather than being buffered.
+type Handler struct {
+	Store    stldb.EntriesRunner
+	Clock    date_util.Clock
+	Location *time.Location
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	current, handler := common.ParseDateParam(
+		r.Form.Get(common.Date),
+		h.Clock.Now().Unix(),
+		h.Location,
+		common.Day())
+	probe := common.ParseProbeParam(r.Form)
+	exportFormat := r.Form.Get(common.Format)
+	var contentType string
+	var newWriter func(w http.ResponseWriter) entryWriter
+	switch exportFormat {
+	case CSV:
+		contentType = "text/csv"
+		newWriter = h.newCSVWriter
+	case NDJSON:
+		contentType = "application/x-ndjson"
+		newWriter = h.newNDJSONWriter
+	default:
+		http_util.Error(w, http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set(
+		"Content-Disposition",
+		fmt.Sprintf(
+			"attachment; filename=\"speeds-%s.%s\"",
+			handler.Param(current),
+			exportFormat))
+	writer := newWriter(w)
+	err := probe.Entries(
+		h.Store,
+		dates.ToTimestamp(current, h.Location),
+		dates.ToTimestamp(handler.End(current), h.Location),
+		consume2.Call(writer.Write))
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		// Response may already be partially written
+		http_util.ReportError(w, "Error exporting entries", err)
+	}
+}
+
+type entryWriter interface {
+	Write(entry stl.Entry)
+	Flush() error
+}
+
+func (h *Handler) newCSVWriter(w http.ResponseWriter) entryWriter {
+	writer := csv.NewWriter(w)
+	writer.Write(kCSVHeader)
+	return &csvWriter{writer: writer, loc: h.Location}
+}
+
+func (h *Handler) newNDJSONWriter(w http.ResponseWriter) entryWriter {
+	return &ndjsonWriter{encoder: json.NewEncoder(w), loc: h.Location}
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+	loc    *time.Location
+}
+
+func (c *csvWriter) Write(entry stl.Entry) {
+	c.writer.Write([]string{
+		time.Unix(entry.Ts, 0).In(c.loc).Format(time.RFC3339),
+		format.Float(entry.DownloadMbps, -1),
+		format.Float(entry.UploadMbps, -1),
+		measuredFloat(&entry, entry.PingMs, stl.MeasureLatency),
+		measuredFloat(&entry, entry.JitterMs, stl.MeasureJitter),
+		measuredFloat(
+			&entry, entry.PacketLossPercent, stl.MeasurePacketLoss),
+		entry.Status.String(),
+		entry.Probe,
+	})
+}
+
+// measuredFloat formats value or returns the empty string if entry did
+// not measure it so that the ingest package reads it back as not measured.
+func measuredFloat(
+	entry *stl.Entry, value float64, measurement stl.Measurement) string {
+	if entry.Unmeasured&measurement != 0 {
+		return ""
+	}
+	return format.Float(value, -1)
+}
+
+func (c *csvWriter) Flush() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+type ndjsonWriter struct {
+	encoder *json.Encoder
+	loc     *time.Location
+	err     error
+}
+
+func (n *ndjsonWriter) Write(entry stl.Entry) {
+	if n.err == nil {
+		n.err = n.encoder.Encode(api.NewEntry(entry, n.loc))
+	}
+}
+
+func (n *ndjsonWriter) Flush() error {
+	return n.err
+}
@@ -0,0 +1,132 @@
+package heatmap
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/speedtestlogger/cmd/stlview/chart"
+	"github.com/keep94/speedtestlogger/cmd/stlview/common"
+	"github.com/keep94/speedtestlogger/stl/aggregators"
+	"github.com/keep94/speedtestlogger/stl/dates"
+	"github.com/keep94/speedtestlogger/stl/stldb"
+	"github.com/keep94/toolbox/date_util"
+	"github.com/keep94/toolbox/http_util"
+)
+
+var (
+	kTemplateSpec = `
+<html>
+<head>
+  <title>Internet Speeds by Hour</title>
+  <style>
+  h1 {
+    font-size: 40px;
+  }
+  .normal {
+    font-size: 30px;
+  }
+  </style>
+</head>
+<body>
+  <h1>Speeds by Hour for {{.Format .Current}}{{if not .Probe.All}} at {{.Probe}}{{end}} &nbsp; &nbsp; Build: {{.BuildId}}</h1>
+  <span class="normal">
+  <a href="{{.Prev}}">prev</a> &nbsp; <a href="{{.Next}}">next</a> &nbsp; {{if .DrillUp}}<a href="{{.DrillUp}}">up</a>{{end}} &nbsp; <a href="{{.Speeds}}">speeds</a>
+  </span>
+  <br><br>
+  {{.SpeedMap.SVG}}
+  <br><br>
+  {{.LapseMap.SVG}}
+</body>
+</html>`
+)
+
+var (
+	kTemplate *template.Template
+)
+
+// Handler shows average download speed and lapse rate by day of the week
+// and hour of the day. The date parameter works as it does on the
+// summary page.
+type Handler struct {
+	Store    stldb.EntriesRunner
+	BuildId  string
+	Clock    date_util.Clock
+	Location *time.Location
+
+	// The day of the week in the first row.
+	WeekStart time.Weekday
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	current, handler := common.ParseDateParam(
+		r.Form.Get(common.Date),
+		h.Clock.Now().Unix(),
+		h.Location,
+		common.Month())
+	probe := common.ParseProbeParam(r.Form)
+	handler = common.ForProbe(handler, probe)
+	heatmap := aggregators.NewHeatmap(h.Location)
+	err := probe.Entries(
+		h.Store,
+		dates.ToTimestamp(current, h.Location),
+		dates.ToTimestamp(handler.End(current), h.Location),
+		consume2.Call(heatmap.Add))
+	if err != nil {
+		http_util.ReportError(w, "Error reading database", err)
+		return
+	}
+	http_util.WriteTemplate(
+		w,
+		kTemplate,
+		&view{
+			handler:  handler,
+			Probe:    probe,
+			Current:  current,
+			BuildId:  h.BuildId,
+			SpeedMap: chart.HeatmapSpeeds(heatmap, h.WeekStart),
+			LapseMap: chart.HeatmapLapses(heatmap, h.WeekStart),
+		},
+	)
+}
+
+type view struct {
+	handler  common.DateHandler
+	Probe    common.ProbeFilter
+	Current  time.Time
+	BuildId  string
+	SpeedMap *chart.Heatmap
+	LapseMap *chart.Heatmap
+}
+
+// Format formats the current date for the page.
+func (v *view) Format(current time.Time) string {
+	return v.handler.Format(current)
+}
+
+// Prev returns the link to the heatmap for the previous period.
+func (v *view) Prev() *url.URL {
+	return common.OnPage(v.handler.Prev(v.Current), common.HeatmapPage)
+}
+
+// Next returns the link to the heatmap for the next period.
+func (v *view) Next() *url.URL {
+	return common.OnPage(v.handler.Next(v.Current), common.HeatmapPage)
+}
+
+// DrillUp returns the link to the heatmap for the enclosing period.
+func (v *view) DrillUp() *url.URL {
+	return common.OnPage(v.handler.DrillUp(v.Current), common.HeatmapPage)
+}
+
+// Speeds returns the link to the speeds for the current period.
+func (v *view) Speeds() *url.URL {
+	return v.handler.Self(v.Current)
+}
+
+func init() {
+	kTemplate = common.NewTemplate("heatmap", kTemplateSpec)
+}
@@ -0,0 +1,241 @@
+// Package metrics exposes stlview metrics in the Prometheus text
+// exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/speedtestlogger/stl"
+	"github.com/keep94/speedtestlogger/stl/aggregators"
+	"github.com/keep94/speedtestlogger/stl/stldb"
+	"github.com/keep94/toolbox/date_util"
+	"github.com/keep94/toolbox/http_util"
+)
+
+var (
+	// Upper bounds of the latency histogram buckets in seconds.
+	kBuckets = []float64{
+		0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+)
+
+// Latencies records HTTP handler latencies. The zero value is ready to
+// use. Latencies instances are safe to use with multiple goroutines.
+type Latencies struct {
+	mu         sync.Mutex
+	histograms map[string]*histogram
+}
+
+// Instrument returns a handler that records the latency of each request
+// to handler under name.
+func (l *Latencies) Instrument(name string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		handler.ServeHTTP(w, r)
+		l.observe(name, time.Since(start).Seconds())
+	})
+}
+
+func (l *Latencies) observe(name string, seconds float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.histograms == nil {
+		l.histograms = make(map[string]*histogram)
+	}
+	h := l.histograms[name]
+	if h == nil {
+		h = &histogram{counts: make([]int64, len(kBuckets))}
+		l.histograms[name] = h
+	}
+	h.observe(seconds)
+}
+
+func (l *Latencies) write(w io.Writer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	names := make([]string, 0, len(l.histograms))
+	for name := range l.histograms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	writeHeader(
+		w,
+		"stl_http_request_duration_seconds",
+		"histogram",
+		"Latency of stlview HTTP handlers.")
+	for _, name := range names {
+		l.histograms[name].write(
+			w, "stl_http_request_duration_seconds", "handler", name)
+	}
+}
+
+type histogram struct {
+	counts []int64
+	count  int64
+	sum    float64
+}
+
+func (h *histogram) observe(value float64) {
+	for i, bound := range kBuckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+func (h *histogram) write(w io.Writer, name, labelName, labelValue string) {
+	for i, bound := range kBuckets {
+		fmt.Fprintf(
+			w,
+			"%s_bucket{%s=%q,le=%q} %d\n",
+			name,
+			labelName,
+			labelValue,
+			formatFloat(bound),
+			h.counts[i])
+	}
+	fmt.Fprintf(
+		w, "%s_bucket{%s=%q,le=\"+Inf\"} %d\n", name, labelName, labelValue, h.count)
+	fmt.Fprintf(
+		w, "%s_sum{%s=%q} %s\n", name, labelName, labelValue, formatFloat(h.sum))
+	fmt.Fprintf(
+		w, "%s_count{%s=%q} %d\n", name, labelName, labelValue, h.count)
+}
+
+// Handler serves the /metrics page. Speed and uptime metrics are
+// computed from the entries within Window of the current time.
+type Handler struct {
+	Store     stldb.EntriesRunner
+	Clock     date_util.Clock
+	Window    time.Duration
+	Latencies *Latencies
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	now := h.Clock.Now()
+	var latest []stl.Entry
+	var summary aggregators.Summary
+	statusCounts := make(map[stl.Status]int)
+	lapses := 0
+	err := h.Store.Entries(
+		nil,
+		now.Add(-h.Window).Unix(),
+		now.Unix()+1,
+		consume2.Compose(
+			consume2.Slice(consume2.AppendTo(&latest), 0, 1),
+			consume2.Call(summary.Add),
+			consume2.Call(func(entry stl.Entry) {
+				statusCounts[entry.Status]++
+				if entry.IsOutage() {
+					lapses++
+				}
+			}),
+		))
+	if err != nil {
+		http_util.ReportError(w, "Error reading database", err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	window := h.Window.String()
+	if len(latest) > 0 {
+		writeGauge(
+			w,
+			"stl_latest_download_mbps",
+			"Download speed of the most recent entry in Mbps.",
+			latest[0].DownloadMbps)
+		writeGauge(
+			w,
+			"stl_latest_upload_mbps",
+			"Upload speed of the most recent entry in Mbps.",
+			latest[0].UploadMbps)
+		writeGauge(
+			w,
+			"stl_latest_timestamp_seconds",
+			"Timestamp of the most recent entry in seconds since the epoch.",
+			float64(latest[0].Ts))
+	}
+	writeHeader(
+		w,
+		"stl_entries",
+		"gauge",
+		"Number of entries within the window by status.")
+	for i := stl.StatusOk; i <= stl.StatusPartial; i++ {
+		fmt.Fprintf(
+			w,
+			"stl_entries{window=%q,status=%q} %d\n",
+			window,
+			i.String(),
+			statusCounts[i])
+	}
+	if summary.PercentUptime.Exists() {
+		writeHeader(
+			w,
+			"stl_uptime_percent",
+			"gauge",
+			"Percent uptime within the window.")
+		fmt.Fprintf(
+			w,
+			"stl_uptime_percent{window=%q} %s\n",
+			window,
+			formatFloat(summary.PercentUptime.Avg()))
+	}
+	if summary.TimeUptime.Exists() {
+		writeHeader(
+			w,
+			"stl_time_uptime_percent",
+			"gauge",
+			"Percent of time up within the window weighting each sample by the time until the next sample.")
+		fmt.Fprintf(
+			w,
+			"stl_time_uptime_percent{window=%q} %s\n",
+			window,
+			formatFloat(summary.TimeUptime.Percent()))
+	}
+	writeHeader(
+		w,
+		"stl_downtime_seconds",
+		"gauge",
+		"Seconds of downtime within the window.")
+	fmt.Fprintf(
+		w,
+		"stl_downtime_seconds{window=%q} %d\n",
+		window,
+		summary.TimeUptime.DownSeconds)
+	writeHeader(
+		w,
+		"stl_outages",
+		"gauge",
+		"Number of outages within the window.")
+	fmt.Fprintf(w, "stl_outages{window=%q} %d\n", window, summary.OutageCount)
+	writeHeader(
+		w,
+		"stl_service_lapses",
+		"gauge",
+		"Number of entries within the window that were service lapses.")
+	fmt.Fprintf(w, "stl_service_lapses{window=%q} %d\n", window, lapses)
+	if h.Latencies != nil {
+		h.Latencies.write(w)
+	}
+}
+
+func writeHeader(w io.Writer, name, metricType, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+}
+
+func writeGauge(w io.Writer, name, help string, value float64) {
+	writeHeader(w, name, "gauge", help)
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(value))
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
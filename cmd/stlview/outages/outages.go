@@ -0,0 +1,154 @@
+package outages
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/speedtestlogger/cmd/stlview/common"
+	"github.com/keep94/speedtestlogger/stl/aggregators"
+	"github.com/keep94/speedtestlogger/stl/dates"
+	"github.com/keep94/speedtestlogger/stl/stldb"
+	"github.com/keep94/toolbox/date_util"
+	"github.com/keep94/toolbox/http_util"
+)
+
+var (
+	kTemplateSpec = `
+<html>
+<head>
+  <title>Internet Outages</title>
+  <style>
+  h1 {
+    font-size: 40px;
+  }
+  th {
+    font-size: 30px;
+  }
+  td, .normal {
+    font-size: 30px;
+  }
+  </style>
+</head>
+<body>
+  <h1>Outages for {{.Format .Current}}{{if not .Probe.All}} at {{.Probe}}{{end}} &nbsp; &nbsp; Build: {{.BuildId}}</h1>
+  <a href="{{.Prev}}">prev</a> &nbsp; <a href="{{.Next}}">next</a> &nbsp; {{if .DrillUp}}<a href="{{.DrillUp}}">up</a>{{end}} &nbsp; <a href="{{.Speeds}}">speeds</a>
+  <br><br>
+  <span class="normal">
+  Outages: {{len .Outages}}
+  </span>
+  <br><br>
+  <table border=1>
+    <tr>
+      <th>Start</th>
+      <th>End</th>
+      <th>Duration</th>
+      <th>Failed Samples</th>
+    </tr>
+    {{with $top := .}}
+    {{range .Outages}}
+    <tr>
+      <td><a href="{{$top.DayLink .Start}}">{{$top.FormatTimestamp .Start}}</a></td>
+      <td>{{$top.FormatTimestamp .End}}{{if not .Restored}} (not restored){{end}}</td>
+      <td align="right">{{$top.FormatDuration .Duration}}</td>
+      <td align="right">{{.FailedSamples}}</td>
+    </tr>
+    {{end}}
+    {{end}}
+  </table>
+</body>
+</html>`
+)
+
+var (
+	kTemplate *template.Template
+)
+
+// Handler shows the outages for a day, month, or year. The date parameter
+// works as it does on the day and summary pages.
+type Handler struct {
+	Store    stldb.EntriesRunner
+	BuildId  string
+	Clock    date_util.Clock
+	Location *time.Location
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	current, handler := common.ParseDateParam(
+		r.Form.Get(common.Date),
+		h.Clock.Now().Unix(),
+		h.Location,
+		common.Month())
+	probe := common.ParseProbeParam(r.Form)
+	handler = common.ForProbe(handler, probe)
+	var outages aggregators.Outages
+	err := probe.Entries(
+		h.Store,
+		dates.ToTimestamp(current, h.Location),
+		dates.ToTimestamp(handler.End(current), h.Location),
+		consume2.Call(outages.Add))
+	if err != nil {
+		http_util.ReportError(w, "Error reading database", err)
+		return
+	}
+	http_util.WriteTemplate(
+		w,
+		kTemplate,
+		&view{
+			TimestampFormatter: common.TimestampFormatter{Location: h.Location},
+			handler:            handler,
+			Probe:              probe,
+			Current:            current,
+			BuildId:            h.BuildId,
+			Outages:            outages.Outages(),
+		},
+	)
+}
+
+type view struct {
+	common.TimestampFormatter
+	common.DurationFormatter
+	handler common.DateHandler
+	Probe   common.ProbeFilter
+	Current time.Time
+	BuildId string
+	Outages []aggregators.Outage
+}
+
+// Format formats the current date for the page.
+func (v *view) Format(current time.Time) string {
+	return v.handler.Format(current)
+}
+
+// Prev returns the link to the outages for the previous period.
+func (v *view) Prev() *url.URL {
+	return common.OnPage(v.handler.Prev(v.Current), common.OutagesPage)
+}
+
+// Next returns the link to the outages for the next period.
+func (v *view) Next() *url.URL {
+	return common.OnPage(v.handler.Next(v.Current), common.OutagesPage)
+}
+
+// DrillUp returns the link to the outages for the enclosing period.
+func (v *view) DrillUp() *url.URL {
+	return common.OnPage(v.handler.DrillUp(v.Current), common.OutagesPage)
+}
+
+// Speeds returns the link to the speeds for the current period.
+func (v *view) Speeds() *url.URL {
+	return v.handler.Self(v.Current)
+}
+
+// DayLink returns the link to the day page for the day of ts.
+func (v *view) DayLink(ts int64) *url.URL {
+	return common.ForProbe(common.Day(), v.Probe).Self(
+		dates.DatePart(ts, v.Location))
+}
+
+func init() {
+	kTemplate = common.NewTemplate("outages", kTemplateSpec)
+}
@@ -0,0 +1,195 @@
+package probes
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/speedtestlogger/cmd/stlview/common"
+	"github.com/keep94/speedtestlogger/stl"
+	"github.com/keep94/speedtestlogger/stl/aggregators"
+	"github.com/keep94/speedtestlogger/stl/dates"
+	"github.com/keep94/speedtestlogger/stl/stldb"
+	"github.com/keep94/toolbox/date_util"
+	"github.com/keep94/toolbox/http_util"
+)
+
+var (
+	kTemplateSpec = `
+<html>
+<head>
+  <title>Internet Speeds by Probe</title>
+  <style>
+  h1 {
+    font-size: 40px;
+  }
+  th {
+    font-size: 30px;
+  }
+  td, .normal {
+    font-size: 30px;
+  }
+  </style>
+</head>
+<body>
+  <h1>Probes for {{.Format .Current}} &nbsp; &nbsp; Build: {{.BuildId}}</h1>
+  <a href="{{.Prev}}">prev</a> &nbsp; <a href="{{.Next}}">next</a> &nbsp; {{if .DrillUp}}<a href="{{.DrillUp}}">up</a>{{end}} &nbsp; <a href="{{.Speeds}}">all probes</a>
+  <br><br>
+  <table border=1>
+    <tr>
+      <th>Probe</th>
+      <th>Avg Download</th>
+      <th>Avg Upload</th>
+      <th>Avg Ping</th>
+      <th>Avg Jitter</th>
+      <th>Avg Loss</th>
+      <th>% Uptime</th>
+      <th>Outages</th>
+      <th>Downtime</th>
+      <th>Failed Runs</th>
+    </tr>
+    {{with $top := .}}
+    {{range .Rows}}
+    <tr>
+      <td><a href="{{$top.ProbeLink .Probe}}">{{.Probe}}</a></td>
+      <td align="right">{{with .DownloadMbps}}{{if .Exists}}{{$top.FormatSpeed .Avg}}{{else}}--{{end}}{{end}}</td>
+      <td align="right">{{with .UploadMbps}}{{if .Exists}}{{$top.FormatSpeed .Avg}}{{else}}--{{end}}{{end}}</td>
+      <td align="right">{{with .PingMs}}{{if .Exists}}{{$top.FormatLatency .Avg}}{{else}}--{{end}}{{end}}</td>
+      <td align="right">{{with .JitterMs}}{{if .Exists}}{{$top.FormatLatency .Avg}}{{else}}--{{end}}{{end}}</td>
+      <td align="right">{{with .PacketLossPercent}}{{if .Exists}}{{$top.FormatPercent .Avg}}{{else}}--{{end}}{{end}}</td>
+      <td align="right">{{with .TimeUptime}}{{if .Exists}}{{$top.FormatPercent .Percent}}{{else}}--{{end}}{{end}}</td>
+      <td align="right">{{.OutageCount}}</td>
+      <td align="right">{{$top.FormatDuration .TimeUptime.Downtime}}</td>
+      <td align="right">{{.FailedRuns}}</td>
+    </tr>
+    {{end}}
+    {{end}}
+  </table>
+</body>
+</html>`
+)
+
+var (
+	kTemplate *template.Template
+)
+
+// Handler shows the summaries of each probe side by side for a day,
+// week, month, or year. The date parameter works as it does on the day
+// and summary pages.
+type Handler struct {
+	Store    Store
+	BuildId  string
+	Clock    date_util.Clock
+	Location *time.Location
+}
+
+// Store is what Handler needs from the store.
+type Store interface {
+	stldb.EntriesRunner
+	stldb.DaySummariesRunner
+	stldb.ProbesRunner
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	current, handler := common.ParseDateParam(
+		r.Form.Get(common.Date),
+		h.Clock.Now().Unix(),
+		h.Location,
+		common.Month())
+	probes, err := h.Store.Probes(nil)
+	if err != nil {
+		http_util.ReportError(w, "Error reading database", err)
+		return
+	}
+	rows := make([]*row, len(probes))
+	for i, probe := range probes {
+		rows[i] = &row{Probe: common.ProbeFilter{Name: probe}}
+		err := rows[i].Probe.Entries(
+			h.Store,
+			dates.ToTimestamp(current, h.Location),
+			dates.ToTimestamp(handler.End(current), h.Location),
+			consume2.Call(rows[i].Summary.Add))
+		if err != nil {
+			http_util.ReportError(w, "Error reading database", err)
+			return
+		}
+
+		// Day summaries stand in for entries that stlprune removed.
+		err = rows[i].Probe.DaySummaries(
+			h.Store,
+			current,
+			handler.End(current),
+			consume2.Call(func(day stl.DaySummary) {
+				rows[i].Summary.AddDaySummary(&day)
+			}))
+		if err != nil {
+			http_util.ReportError(w, "Error reading database", err)
+			return
+		}
+	}
+	http_util.WriteTemplate(
+		w,
+		kTemplate,
+		&view{
+			handler: handler,
+			Current: current,
+			BuildId: h.BuildId,
+			Rows:    rows,
+		},
+	)
+}
+
+type row struct {
+	Probe common.ProbeFilter
+	aggregators.Summary
+}
+
+type view struct {
+	common.SpeedFormatter
+	common.LatencyFormatter
+	common.PercentFormatter
+	common.DurationFormatter
+	handler common.DateHandler
+	Current time.Time
+	BuildId string
+	Rows    []*row
+}
+
+// Format formats the current date for the page.
+func (v *view) Format(current time.Time) string {
+	return v.handler.Format(current)
+}
+
+// Prev returns the link to the probes for the previous period.
+func (v *view) Prev() *url.URL {
+	return common.OnPage(v.handler.Prev(v.Current), common.ProbesPage)
+}
+
+// Next returns the link to the probes for the next period.
+func (v *view) Next() *url.URL {
+	return common.OnPage(v.handler.Next(v.Current), common.ProbesPage)
+}
+
+// DrillUp returns the link to the probes for the enclosing period.
+func (v *view) DrillUp() *url.URL {
+	return common.OnPage(v.handler.DrillUp(v.Current), common.ProbesPage)
+}
+
+// Speeds returns the link to the speeds of all probes for the current
+// period.
+func (v *view) Speeds() *url.URL {
+	return v.handler.Self(v.Current)
+}
+
+// ProbeLink returns the link to the speeds of probe for the current
+// period.
+func (v *view) ProbeLink(probe common.ProbeFilter) *url.URL {
+	return common.ForProbe(v.handler, probe).Self(v.Current)
+}
+
+func init() {
+	kTemplate = common.NewTemplate("probes", kTemplateSpec)
+}
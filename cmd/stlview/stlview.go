@@ -6,13 +6,21 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/keep94/context"
+	"github.com/keep94/speedtestlogger/cmd/stlview/api"
 	"github.com/keep94/speedtestlogger/cmd/stlview/common"
 	"github.com/keep94/speedtestlogger/cmd/stlview/day"
+	"github.com/keep94/speedtestlogger/cmd/stlview/export"
+	"github.com/keep94/speedtestlogger/cmd/stlview/heatmap"
+	"github.com/keep94/speedtestlogger/cmd/stlview/metrics"
+	"github.com/keep94/speedtestlogger/cmd/stlview/outages"
+	"github.com/keep94/speedtestlogger/cmd/stlview/probes"
 	"github.com/keep94/speedtestlogger/cmd/stlview/summary"
 	"github.com/keep94/speedtestlogger/stl/stldb/for_sqlite"
+	"github.com/keep94/speedtestlogger/stl/stldb/sqlite_setup"
 	"github.com/keep94/toolbox/build"
 	"github.com/keep94/toolbox/date_util"
 	"github.com/keep94/toolbox/db"
@@ -28,13 +36,17 @@ var (
 )
 
 var (
-	fDb   string
-	fPort string
+	fDb            string
+	fPort          string
+	fMetricsWindow time.Duration
+	fWeekStart     string
+	fSLAPercent    float64
 )
 
 var (
-	kDoer  db.Doer
-	kStore *for_sqlite.Store
+	kDoer      db.Doer
+	kStore     *for_sqlite.Store
+	kLatencies metrics.Latencies
 )
 
 func main() {
@@ -44,23 +56,79 @@ func main() {
 		flag.Usage()
 		os.Exit(1)
 	}
+	weekStart, ok := parseWeekday(fWeekStart)
+	if !ok {
+		fmt.Printf("Unrecognized -week_start: %s\n", fWeekStart)
+		flag.Usage()
+		os.Exit(1)
+	}
 	setupDb(fDb)
 	http.HandleFunc("/", rootRedirect)
 	version, _ := build.MainVersion()
 	http.Handle(
 		common.DayPage,
-		&day.Handler{
+		kLatencies.Instrument(common.DayPage, &day.Handler{
 			Store:    kStore,
 			BuildId:  build.BuildId(version),
 			Clock:    kClock,
-			Location: time.Local})
+			Location: time.Local}))
 	http.Handle(
 		common.SummaryPage,
-		&summary.Handler{
+		kLatencies.Instrument(common.SummaryPage, &summary.Handler{
+			Store:      kStore,
+			BuildId:    build.BuildId(version),
+			Clock:      kClock,
+			Location:   time.Local,
+			WeekStart:  weekStart,
+			SLAPercent: fSLAPercent}))
+	http.Handle(
+		common.EntriesApi,
+		kLatencies.Instrument(common.EntriesApi, &api.EntriesHandler{
+			Store:    kStore,
+			Clock:    kClock,
+			Location: time.Local}))
+	http.Handle(
+		common.SummaryApi,
+		kLatencies.Instrument(common.SummaryApi, &api.SummaryHandler{
+			Store:      kStore,
+			Clock:      kClock,
+			Location:   time.Local,
+			SLAPercent: fSLAPercent}))
+	http.Handle(
+		common.HeatmapPage,
+		kLatencies.Instrument(common.HeatmapPage, &heatmap.Handler{
+			Store:     kStore,
+			BuildId:   build.BuildId(version),
+			Clock:     kClock,
+			Location:  time.Local,
+			WeekStart: weekStart}))
+	http.Handle(
+		common.OutagesPage,
+		kLatencies.Instrument(common.OutagesPage, &outages.Handler{
+			Store:    kStore,
+			BuildId:  build.BuildId(version),
+			Clock:    kClock,
+			Location: time.Local}))
+	http.Handle(
+		common.ProbesPage,
+		kLatencies.Instrument(common.ProbesPage, &probes.Handler{
 			Store:    kStore,
 			BuildId:  build.BuildId(version),
 			Clock:    kClock,
-			Location: time.Local})
+			Location: time.Local}))
+	http.Handle(
+		common.ExportPage,
+		kLatencies.Instrument(common.ExportPage, &export.Handler{
+			Store:    kStore,
+			Clock:    kClock,
+			Location: time.Local}))
+	http.Handle(
+		common.MetricsPage,
+		&metrics.Handler{
+			Store:     kStore,
+			Clock:     kClock,
+			Window:    fMetricsWindow,
+			Latencies: &kLatencies})
 	defaultHandler := context.ClearHandler(
 		weblogs.HandlerWithOptions(
 			http.DefaultServeMux,
@@ -79,6 +147,15 @@ func rootRedirect(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func parseWeekday(s string) (time.Weekday, bool) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(s, day.String()) {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
 func setupDb(filepath string) {
 	rawdb, err := sql.Open("sqlite3", filepath)
 	if err != nil {
@@ -86,11 +163,31 @@ func setupDb(filepath string) {
 		os.Exit(1)
 	}
 	dbase := sqlite3_db.New(rawdb)
+	if err := dbase.Do(sqlite_setup.CheckCurrent); err != nil {
+		fmt.Printf("%v; run stlinit -db %s -migrate\n", err, filepath)
+		os.Exit(1)
+	}
 	kDoer = sqlite3_db.NewDoer(dbase)
 	kStore = for_sqlite.New(dbase)
+	if err := kStore.SetUpRollups(nil, fSLAPercent); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 }
 
 func init() {
 	flag.StringVar(&fPort, "http", ":8080", "Port to bind")
 	flag.StringVar(&fDb, "db", "", "Path to database file")
+	flag.DurationVar(
+		&fMetricsWindow,
+		"metrics_window",
+		24*time.Hour,
+		"Rolling window for uptime metrics")
+	flag.StringVar(
+		&fWeekStart, "week_start", "sunday", "First day of the week")
+	flag.Float64Var(
+		&fSLAPercent,
+		"sla_percent",
+		80.0,
+		"Percent of advertised speed a test must reach to meet the plan")
 }
@@ -3,10 +3,14 @@ package summary
 import (
 	"html/template"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/keep94/consume2"
+	"github.com/keep94/speedtestlogger/cmd/stlview/chart"
 	"github.com/keep94/speedtestlogger/cmd/stlview/common"
+	"github.com/keep94/speedtestlogger/cmd/stlview/export"
+	"github.com/keep94/speedtestlogger/stl"
 	"github.com/keep94/speedtestlogger/stl/aggregators"
 	"github.com/keep94/speedtestlogger/stl/dates"
 	"github.com/keep94/speedtestlogger/stl/stldb"
@@ -35,8 +39,12 @@ var (
   </style>
 </head>
 <body>
-  <h1>Average Speeds for {{.Format .Current}} &nbsp; &nbsp; Build: {{.BuildId}}</h1>
-  <a href="{{.Prev .Current}}">prev</a> &nbsp; <a href="{{.Next .Current}}">next</a> &nbsp; {{if .DrillUp .Current}}<a href="{{.DrillUp .Current}}">up</a>{{end}}
+  <h1>Average Speeds for {{.Format .Current}}{{if not .Probe.All}} at {{.Probe}}{{end}} &nbsp; &nbsp; Build: {{.BuildId}}</h1>
+  <a href="{{.Prev .Current}}">prev</a> &nbsp; <a href="{{.Next .Current}}">next</a> &nbsp; {{if .DrillUp .Current}}<a href="{{.DrillUp .Current}}">up</a>{{end}} &nbsp; <a href="{{.OutagesLink}}">outages</a> &nbsp; <a href="{{.HeatmapLink}}">by hour</a> &nbsp; Export: <a href="{{.ExportCSV}}">csv</a> <a href="{{.ExportNDJSON}}">ndjson</a> &nbsp; <a href="{{.ToggleStats}}">{{if .Stats}}hide{{else}}show{{end}} statistics</a>
+  {{if .ProbeLinks}}
+  <br><br>
+  Probe: {{range .ProbeLinks}}{{if .Link}}<a href="{{.Link}}">{{.String}}</a>{{else}}<b>{{.String}}</b>{{end}} &nbsp; {{end}}<a href="{{.CompareLink}}">side by side</a>
+  {{end}}
   <br><br>
   <span class="normal">
   {{with $top := .}}
@@ -44,17 +52,61 @@ var (
   <br>
   Upload Average (Mbps): {{with .Summary.UploadMbps}}{{if .Exists}}{{$top.FormatSpeed .Avg}}{{else}}--{{end}}{{end}}
   <br>
-  Percent Uptime: {{with .Summary.PercentUptime}}{{if .Exists}}{{$top.FormatPercent .Avg}}{{else}}--{{end}}{{end}}
+  {{if .Stats}}
+  Download (Mbps): {{with .Summary.DownloadStats}}{{if .Exists}}min {{$top.FormatSpeed .Min}} &nbsp; {{if .HasPercentiles}}p5 {{$top.FormatSpeed .P5}} &nbsp; median {{$top.FormatSpeed .Median}} &nbsp; p95 {{$top.FormatSpeed .P95}} &nbsp; {{end}}max {{$top.FormatSpeed .Max}} &nbsp; std dev {{$top.FormatSpeed .StdDev}}{{else}}--{{end}}{{end}}
+  <br>
+  Upload (Mbps): {{with .Summary.UploadStats}}{{if .Exists}}min {{$top.FormatSpeed .Min}} &nbsp; {{if .HasPercentiles}}p5 {{$top.FormatSpeed .P5}} &nbsp; median {{$top.FormatSpeed .Median}} &nbsp; p95 {{$top.FormatSpeed .P95}} &nbsp; {{end}}max {{$top.FormatSpeed .Max}} &nbsp; std dev {{$top.FormatSpeed .StdDev}}{{else}}--{{end}}{{end}}
+  <br>
+  {{end}}
+  Ping Average (ms): {{with .Summary.PingMs}}{{if .Exists}}{{$top.FormatLatency .Avg}}{{else}}--{{end}}{{end}}
+  <br>
+  Jitter Average (ms): {{with .Summary.JitterMs}}{{if .Exists}}{{$top.FormatLatency .Avg}}{{else}}--{{end}}{{end}}
+  <br>
+  Packet Loss Average (%): {{with .Summary.PacketLossPercent}}{{if .Exists}}{{$top.FormatPercent .Avg}}{{else}}--{{end}}{{end}}
+  <br>
+  Percent Uptime: {{with .Summary.TimeUptime}}{{if .Exists}}{{$top.FormatPercent .Percent}}{{else}}--{{end}}{{end}}
+  <br>
+  Percent of Tests Up: {{with .Summary.PercentUptime}}{{if .Exists}}{{$top.FormatPercent .Avg}}{{else}}--{{end}}{{end}}
+  <br>
+  Outages: {{.Summary.OutageCount}} &nbsp; Downtime: {{$top.FormatDuration .Summary.TimeUptime.Downtime}} &nbsp; Longest: {{$top.FormatDuration .Summary.LongestOutage}}
+  <br>
+  Failed Test Runs: {{.Summary.FailedRuns}}
+  {{if .HasPlans}}
+  <br>
+  Plan: {{with .Plan}}{{if .Name}}{{.Name}} {{end}}{{$top.FormatSpeed .DownloadMbps}}{{if .UploadMbps}} / {{$top.FormatSpeed .UploadMbps}}{{end}} Mbps{{else}}--{{end}}
+  <br>
+  Tests Meeting {{$top.FormatPercent .SLA.Percent}}% of Plan (%): download {{with .Summary.Compliance.Download}}{{if .Exists}}{{$top.FormatPercent .Avg}}{{else}}--{{end}}{{end}} &nbsp; upload {{with .Summary.Compliance.Upload}}{{if .Exists}}{{$top.FormatPercent .Avg}}{{else}}--{{end}}{{end}}
+  {{end}}
   {{end}}
   </span>
   <br><br>
+  {{.SpeedChart.SVG}}
+  <br>
+  {{.UptimeChart.SVG}}
+  <br><br>
   <table border=1>
     <tr>
       <th>Date</th>
       <th>Avg Download</th>
       <th>Avg Upload</th>
+      {{if .Stats}}
+      <th>Download Min / P5 / Median / P95 / Max</th>
+      <th>Download Std Dev</th>
+      <th>Upload Min / P5 / Median / P95 / Max</th>
+      <th>Upload Std Dev</th>
+      {{end}}
+      <th>Avg Ping</th>
+      <th>Avg Jitter</th>
+      <th>Avg Loss</th>
       <th>Lapse</th>
       <th>% Uptime</th>
+      <th>Outages</th>
+      <th>Downtime</th>
+      <th>Longest</th>
+      {{if .HasPlans}}
+      <th>Download Meets Plan</th>
+      <th>Upload Meets Plan</th>
+      {{end}}
     </tr>
     {{with $top := .}}
     {{range .DatedSummaries}}
@@ -62,8 +114,24 @@ var (
       <td><a href="{{$top.DrillDown .Date}}">{{$top.DrillDownFormat .Date}}</a></td>
       <td align="right">{{with .DownloadMbps}}{{if .Exists}}{{$top.FormatSpeed .Avg}}{{else}}--{{end}}{{end}}</td>
       <td align="right">{{with .UploadMbps}}{{if .Exists}}{{$top.FormatSpeed .Avg}}{{else}}--{{end}}{{end}}</td>
+      {{if $top.Stats}}
+      <td align="right">{{with .DownloadStats}}{{if .Exists}}{{$top.FormatSpeed .Min}} / {{if .HasPercentiles}}{{$top.FormatSpeed .P5}} / {{$top.FormatSpeed .Median}} / {{$top.FormatSpeed .P95}}{{else}}-- / -- / --{{end}} / {{$top.FormatSpeed .Max}}{{else}}--{{end}}{{end}}</td>
+      <td align="right">{{with .DownloadStats}}{{if .Exists}}{{$top.FormatSpeed .StdDev}}{{else}}--{{end}}{{end}}</td>
+      <td align="right">{{with .UploadStats}}{{if .Exists}}{{$top.FormatSpeed .Min}} / {{if .HasPercentiles}}{{$top.FormatSpeed .P5}} / {{$top.FormatSpeed .Median}} / {{$top.FormatSpeed .P95}}{{else}}-- / -- / --{{end}} / {{$top.FormatSpeed .Max}}{{else}}--{{end}}{{end}}</td>
+      <td align="right">{{with .UploadStats}}{{if .Exists}}{{$top.FormatSpeed .StdDev}}{{else}}--{{end}}{{end}}</td>
+      {{end}}
+      <td align="right">{{with .PingMs}}{{if .Exists}}{{$top.FormatLatency .Avg}}{{else}}--{{end}}{{end}}</td>
+      <td align="right">{{with .JitterMs}}{{if .Exists}}{{$top.FormatLatency .Avg}}{{else}}--{{end}}{{end}}</td>
+      <td align="right">{{with .PacketLossPercent}}{{if .Exists}}{{$top.FormatPercent .Avg}}{{else}}--{{end}}{{end}}</td>
       <td>{{if .ServiceLapse}}X{{else}}&nbsp;{{end}}</td>
-      <td align="right">{{with .PercentUptime}}{{if .Exists}}{{$top.FormatPercent .Avg}}{{else}}--{{end}}{{end}}</td>
+      <td align="right">{{with .TimeUptime}}{{if .Exists}}{{$top.FormatPercent .Percent}}{{else}}--{{end}}{{end}}</td>
+      <td align="right">{{.OutageCount}}</td>
+      <td align="right">{{$top.FormatDuration .TimeUptime.Downtime}}</td>
+      <td align="right">{{$top.FormatDuration .LongestOutage}}</td>
+      {{if $top.HasPlans}}
+      <td align="right">{{with .Compliance.Download}}{{if .Exists}}{{$top.FormatPercent .Avg}}{{else}}--{{end}}{{end}}</td>
+      <td align="right">{{with .Compliance.Upload}}{{if .Exists}}{{$top.FormatPercent .Avg}}{{else}}--{{end}}{{end}}</td>
+      {{end}}
     </tr>
     {{end}}
     {{end}}
@@ -72,41 +140,75 @@ var (
 </html>`
 )
 
+const (
+	kStats = "stats"
+)
+
 var (
 	kTemplate *template.Template
 )
 
 type Handler struct {
-	Store    stldb.EntriesRunner
+	Store    Store
 	BuildId  string
 	Clock    date_util.Clock
 	Location *time.Location
+
+	// The first day of the week for weekly summaries.
+	WeekStart time.Weekday
+
+	// Percent of advertised speed a test must reach to meet the plan.
+	// Must match the SLA percent the rollups of Store were set up with.
+	SLAPercent float64
+}
+
+// Store is what Handler needs from the store.
+type Store interface {
+	stldb.EntriesRunner
+	stldb.DaySummariesRunner
+	stldb.DatedSummariesRunner
+	stldb.PlansRunner
+	stldb.ProbesRunner
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 	dateStr := r.Form.Get(common.Date)
-
-	// We need just yyyyMM or yyyy on summary page.
-	if len(dateStr) > 6 {
-		dateStr = dateStr[:6]
-	}
+	stats := r.Form.Get(kStats) != ""
 	current, handler := common.ParseDateParam(
 		dateStr,
 		h.Clock.Now().Unix(),
 		h.Location,
 		common.Month())
-	totaler := aggregators.NewByPeriodTotaler(
-		current, handler.End(current), handler.Recurring(), h.Location)
+
+	// A single day on the summary page shows hourly summaries.
+	if handler == common.Day() {
+		handler = common.Hours(h.Location, h.WeekStart)
+	}
+	self := handler.Self(current)
+	probe := common.ParseProbeParam(r.Form)
+	handler = common.ForProbe(handler, probe)
+	plans, err := h.Store.Plans(nil)
+	if err != nil {
+		http_util.ReportError(w, "Error reading database", err)
+		return
+	}
+	probes, err := h.Store.Probes(nil)
+	if err != nil {
+		http_util.ReportError(w, "Error reading database", err)
+		return
+	}
+	sla := aggregators.NewSLA(plans, h.SLAPercent)
 	var summary aggregators.Summary
-	err := h.Store.Entries(
-		nil,
-		dates.ToTimestamp(current, h.Location),
-		dates.ToTimestamp(handler.End(current), h.Location),
-		consume2.Compose(
-			consume2.Call(totaler.Add),
-			consume2.Call(summary.Add),
-		))
+	var datedSummaries []*aggregators.DatedSummary
+	// Rollups have no speed percentiles, so statistics need every entry.
+	if hasRollups(handler.Recurring()) && !stats {
+		datedSummaries, err = h.fromRollups(
+			probe, handler, current, &summary)
+	} else {
+		datedSummaries, err = h.fromEntries(
+			probe, handler, current, sla, &summary)
+	}
 	if err != nil {
 		http_util.ReportError(w, "Error reading database", err)
 		return
@@ -116,24 +218,185 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		kTemplate,
 		&view{
 			common.SpeedFormatter{},
+			common.LatencyFormatter{},
 			common.PercentFormatter{},
+			common.DurationFormatter{},
 			handler,
 			current,
 			h.BuildId,
-			totaler.DatedSummaries(),
+			datedSummaries,
 			summary,
+			chart.SummarySpeeds(datedSummaries, handler.ChartFormat),
+			chart.SummaryUptime(datedSummaries, handler.ChartFormat),
+			common.ExportUrl(handler, current, export.CSV),
+			common.ExportUrl(handler, current, export.NDJSON),
+			common.OnPage(handler.Self(current), common.OutagesPage),
+			common.OnPage(handler.Self(current), common.HeatmapPage),
+			stats,
+			sla,
+			latestPlan(
+				plans,
+				min(
+					h.Clock.Now().Unix(),
+					dates.ToTimestamp(handler.End(current), h.Location)-1)),
+			probe,
+			common.ProbeLinks(withStats(self, stats), probe, probes),
+			common.OnPage(self, common.ProbesPage),
 		},
 	)
 }
 
 type view struct {
 	common.SpeedFormatter
+	common.LatencyFormatter
 	common.PercentFormatter
+	common.DurationFormatter
 	common.DateHandler
 	Current        time.Time
 	BuildId        string
 	DatedSummaries []*aggregators.DatedSummary
 	Summary        aggregators.Summary
+	SpeedChart     *chart.BarChart
+	UptimeChart    *chart.BarChart
+	ExportCSV      *url.URL
+	ExportNDJSON   *url.URL
+	OutagesLink    *url.URL
+	HeatmapLink    *url.URL
+	Stats          bool
+	SLA            *aggregators.SLA
+	Plan           *stl.Plan
+	Probe          common.ProbeFilter
+	ProbeLinks     []common.ProbeLink
+	CompareLink    *url.URL
+}
+
+// HasPlans returns true if there are advertised plans to compare against.
+func (v *view) HasPlans() bool {
+	return len(v.SLA.Plans()) > 0
+}
+
+// Prev returns the link to the previous period keeping the statistics
+// setting.
+func (v *view) Prev(current time.Time) *url.URL {
+	return v.keepStats(v.DateHandler.Prev(current))
+}
+
+// Next returns the link to the next period keeping the statistics
+// setting.
+func (v *view) Next(current time.Time) *url.URL {
+	return v.keepStats(v.DateHandler.Next(current))
+}
+
+// DrillUp returns the link to the enclosing period keeping the statistics
+// setting.
+func (v *view) DrillUp(current time.Time) *url.URL {
+	return v.keepStats(v.DateHandler.DrillUp(current))
+}
+
+// DrillDown returns the link to a period within the current period
+// keeping the statistics setting.
+func (v *view) DrillDown(date time.Time) *url.URL {
+	return v.keepStats(v.DateHandler.DrillDown(date))
+}
+
+// ToggleStats returns the link to this page with statistics shown if
+// they are hidden or hidden if they are shown.
+func (v *view) ToggleStats() *url.URL {
+	return withStats(v.DateHandler.Self(v.Current), !v.Stats)
+}
+
+func (v *view) keepStats(u *url.URL) *url.URL {
+	if !v.Stats || u == nil || u.Path != common.SummaryPage {
+		return u
+	}
+	return withStats(u, true)
+}
+
+// fromEntries summarises the entries and day summaries of the current
+// period by reading every entry.
+func (h *Handler) fromEntries(
+	probe common.ProbeFilter,
+	handler common.DateHandler,
+	current time.Time,
+	sla *aggregators.SLA,
+	summary *aggregators.Summary) ([]*aggregators.DatedSummary, error) {
+	totaler := aggregators.NewByPeriodTotaler(
+		current, handler.End(current), handler.Recurring(), h.Location)
+	totaler.SetSLA(sla)
+	err := probe.Entries(
+		h.Store,
+		dates.ToTimestamp(current, h.Location),
+		dates.ToTimestamp(handler.End(current), h.Location),
+		consume2.Compose(
+			consume2.Call(totaler.Add),
+			consume2.Call(summary.Add),
+			consume2.Call(func(entry stl.Entry) {
+				sla.Add(&summary.Compliance, entry)
+			}),
+		))
+	if err != nil {
+		return nil, err
+	}
+
+	// Day summaries stand in for entries that stlprune removed.
+	err = probe.DaySummaries(
+		h.Store,
+		current,
+		handler.End(current),
+		consume2.Call(func(day stl.DaySummary) {
+			totaler.AddDaySummary(day)
+			summary.AddDaySummary(&day)
+		}))
+	if err != nil {
+		return nil, err
+	}
+	return totaler.DatedSummaries(), nil
+}
+
+// fromRollups summarises the current period from the stored daily or
+// monthly rollups. The rollups check tests against the plans at the SLA
+// percent stlview sets them up with.
+func (h *Handler) fromRollups(
+	probe common.ProbeFilter,
+	handler common.DateHandler,
+	current time.Time,
+	summary *aggregators.Summary) ([]*aggregators.DatedSummary, error) {
+	datedSummaries, err := probe.DatedSummaries(
+		h.Store, handler.Recurring(), current, handler.End(current))
+	if err != nil {
+		return nil, err
+	}
+	for _, datedSummary := range datedSummaries {
+		summary.AddSummary(&datedSummary.Summary)
+	}
+	return datedSummaries, nil
+}
+
+// hasRollups returns true if the store keeps rollups for recurring.
+func hasRollups(recurring aggregators.Recurring) bool {
+	return recurring == aggregators.Daily() ||
+		recurring == aggregators.Monthly()
+}
+
+// latestPlan returns the plan in effect at ts or nil if there is none.
+func latestPlan(plans stl.Plans, ts int64) *stl.Plan {
+	plan, ok := plans.At(ts)
+	if !ok {
+		return nil
+	}
+	return &plan
+}
+
+func withStats(u *url.URL, stats bool) *url.URL {
+	result := *u
+	values := result.Query()
+	if stats {
+		values.Set(kStats, "on")
+	} else {
+		values.Del(kStats)
+	}
+	result.RawQuery = values.Encode()
+	return &result
 }
 
 func init() {
@@ -1,5 +1,7 @@
-if speedtest -f csv &> stl_out.csv; then
+speedtest -f csv --output-header > stl_out.csv 2> stl_err.txt
+code=$?
+if [ $code -eq 0 ]; then
     ~/go/bin/stllog -db ~/stl/stl.db -csv stl_out.csv
 else
-    ~/go/bin/stllog -db ~/stl/stl.db
+    ~/go/bin/stllog -db ~/stl/stl.db -exitcode $code -stderr stl_err.txt
 fi
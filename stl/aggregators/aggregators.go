@@ -5,7 +5,6 @@ import (
 	"time"
 
 	"github.com/keep94/speedtestlogger/stl"
-	"github.com/keep94/speedtestlogger/stl/dates"
 	"github.com/keep94/toolbox/date_util"
 )
 
@@ -39,24 +38,104 @@ type Summary struct {
 	DownloadMbps Average
 	UploadMbps   Average
 
-	// Percent uptime 0 to 100.
+	// Distributions of the same speeds that go into DownloadMbps and
+	// UploadMbps.
+	DownloadStats Distribution
+	UploadStats   Distribution
+
+	// Latency statistics. These include only entries where latency was
+	// measured.
+	PingMs            Average
+	JitterMs          Average
+	PacketLossPercent Average
+
+	// Percent uptime 0 to 100 counting each sample equally.
 	PercentUptime Average
 
-	// True if there was a lapse in service. A lapse in service is 0
-	// download speed and 0 upload speed.
+	// Uptime weighting each sample by the time until the next sample.
+	// Entries must be added most recent to least recent for this to
+	// be correct.
+	TimeUptime Uptime
+
+	// Number of outages. Consecutive entries that are outages count as a
+	// single outage.
+	OutageCount int
+
+	// How long the longest outage lasted. See Outage.
+	LongestOutage time.Duration
+
+	// True if there was a lapse in service. See stl.Entry.IsOutage.
 	ServiceLapse bool
+
+	// Number of speed test runs that failed because of a tool error or
+	// timeout. These runs count neither as uptime nor as downtime.
+	FailedRuns int
+
+	// How often tests met the advertised plan. Summary.Add does not
+	// update Compliance; see SLA.Add and ByPeriodTotaler.SetSLA.
+	Compliance Compliance
+
+	tracker outageTracker
+
+	// The outages in progress at the earliest and latest test runs so
+	// that outages spanning stored day summaries count once.
+	firstOutage outageSpan
+	lastOutage  outageSpan
 }
 
 // Add adds an stl.Entry to this summary.
 func (s *Summary) Add(entry stl.Entry) {
-	if entry.DownloadMbps == 0.0 && entry.UploadMbps == 0.0 {
+	if isFailedRun(&entry) {
+		s.FailedRuns++
+		return
+	}
+	s.addTimed(&entry)
+	switch {
+	case entry.IsOutage():
 		s.ServiceLapse = true
 		s.PercentUptime.Add(0.0)
-	} else {
+	default:
 		s.PercentUptime.Add(100.0)
 	}
-	s.DownloadMbps.Add(entry.DownloadMbps)
-	s.UploadMbps.Add(entry.UploadMbps)
+	if entry.HasDownload() {
+		s.DownloadMbps.Add(entry.DownloadMbps)
+		s.DownloadStats.Add(entry.DownloadMbps)
+	}
+	if entry.HasUpload() {
+		s.UploadMbps.Add(entry.UploadMbps)
+		s.UploadStats.Add(entry.UploadMbps)
+	}
+	if entry.HasLatency() {
+		s.PingMs.Add(entry.PingMs)
+	}
+	if entry.HasJitter() {
+		s.JitterMs.Add(entry.JitterMs)
+	}
+	if entry.HasPacketLoss() {
+		s.PacketLossPercent.Add(entry.PacketLossPercent)
+	}
+}
+
+func (s *Summary) addTimed(entry *stl.Entry) {
+	outage := entry.IsOutage()
+	latest := s.PercentUptime.N == 0
+	seconds, started := s.tracker.add(entry.Ts, outage)
+	if outage {
+		s.TimeUptime.DownSeconds += seconds
+		if started {
+			s.OutageCount++
+		}
+		s.LongestOutage = max(s.LongestOutage, s.tracker.current.Duration())
+		span := outageSpan{
+			Start: s.tracker.current.Start, End: s.tracker.current.End}
+		if latest || (!started && s.lastOutage == s.firstOutage) {
+			s.lastOutage = span
+		}
+		s.firstOutage = span
+	} else {
+		s.TimeUptime.UpSeconds += seconds
+		s.firstOutage = outageSpan{}
+	}
 }
 
 // DatedSummary represents a dated summary.
@@ -65,7 +144,9 @@ type DatedSummary struct {
 	Summary
 }
 
-// Recurring is the interface for recurring time periods. e.g monthly, yearly
+// Recurring is the interface for recurring time periods. e.g monthly, yearly.
+// Daily and longer periods are dates: midnight UTC of the first day of the
+// period. Hourly periods are actual times in a particular time zone.
 type Recurring interface {
 
 	// Normalize returns the beginning of a time period for a given date.
@@ -88,6 +169,20 @@ func Yearly() Recurring {
 	return yearly{}
 }
 
+// Hourly returns hourly periods in the given time zone. Because hourly
+// periods are actual times, a day has 23 or 25 hourly periods when
+// daylight savings time starts or ends. When given a time in loc,
+// Normalize truncates it to the hour; otherwise Normalize treats the year,
+// month, day, and hour of its date parameter as the wall clock time in loc.
+func Hourly(loc *time.Location) Recurring {
+	return hourly{loc: loc}
+}
+
+// Weekly returns weekly periods that begin on start.
+func Weekly(start time.Weekday) Recurring {
+	return weekly{start: start}
+}
+
 type daily struct{}
 
 func (d daily) Normalize(date time.Time) time.Time {
@@ -118,20 +213,55 @@ func (y yearly) Add(date time.Time, numPeriods int) time.Time {
 	return date.AddDate(numPeriods, 0, 0)
 }
 
+type hourly struct {
+	loc *time.Location
+}
+
+func (h hourly) Normalize(date time.Time) time.Time {
+	if date.Location() != h.loc {
+		return time.Date(
+			date.Year(), date.Month(), date.Day(), date.Hour(), 0, 0, 0, h.loc)
+	}
+	return date.Add(
+		-time.Duration(date.Minute())*time.Minute -
+			time.Duration(date.Second())*time.Second -
+			time.Duration(date.Nanosecond()))
+}
+
+func (h hourly) Add(date time.Time, numPeriods int) time.Time {
+	return date.Add(time.Duration(numPeriods) * time.Hour)
+}
+
+type weekly struct {
+	start time.Weekday
+}
+
+func (w weekly) Normalize(date time.Time) time.Time {
+	result := date_util.YMD(date.Year(), int(date.Month()), date.Day())
+	offset := (int(result.Weekday()) - int(w.start) + 7) % 7
+	return result.AddDate(0, 0, -offset)
+}
+
+func (w weekly) Add(date time.Time, numPeriods int) time.Time {
+	return date.AddDate(0, 0, 7*numPeriods)
+}
+
 // ByPeriodTotaler aggregates stl.Entry instances by period.
 type ByPeriodTotaler struct {
 	summaries []*DatedSummary
 	smap      map[time.Time]*DatedSummary
 	recurring Recurring
 	loc       *time.Location
+	later     outageTracker
+	sla       *SLA
 }
 
 // NewByPeriodTotaler creates a new ByPeriodTotaler that summarizes
 // stl.Entry objects with timestamps between start inclusive and end
 // exclusive. The recurring perameter indicates the recurring period
-// such as daily, monthly or yearly. loc is the time zone used to convert
-// timestamps to dates. This function converts start and end so that they
-// fall on the beginning of the given recurring period.
+// such as hourly, daily, weekly, monthly or yearly. loc is the time zone
+// used to convert timestamps to dates. This function converts start and
+// end so that they fall on the beginning of the given recurring period.
 func NewByPeriodTotaler(
 	start,
 	end time.Time,
@@ -148,22 +278,56 @@ func NewByPeriodTotaler(
 		loc:       loc}
 }
 
-// Add adds a new entry to this instance.
+// Add adds a new entry to this instance. Entries must be added most
+// recent to least recent for time weighted uptime and outages to be
+// correct.
 func (b *ByPeriodTotaler) Add(entry stl.Entry) {
-	cdate := dates.DatePart(entry.Ts, b.loc)
-	datedSummaryPtr := b.smap[b.recurring.Normalize(cdate)]
+	period := b.recurring.Normalize(time.Unix(entry.Ts, 0).In(b.loc))
+	datedSummaryPtr := b.smap[period]
 	if datedSummaryPtr != nil {
+		// Tell the summary about the entry just after so that time weighted
+		// uptime and outages can span periods.
+		if b.later.hasLater {
+			datedSummaryPtr.tracker.seed(b.later.laterTs, b.later.laterOutage)
+		}
 		datedSummaryPtr.Add(entry)
+		if b.sla != nil {
+			b.sla.Add(&datedSummaryPtr.Compliance, entry)
+		}
+	}
+	if !isFailedRun(&entry) {
+		b.later.add(entry.Ts, entry.IsOutage())
 	}
 }
 
+// AddDaySummary adds a stored day summary to this instance. Day
+// summaries can't be split into hours, so AddDaySummary ignores them when
+// the recurring period is hourly.
+func (b *ByPeriodTotaler) AddDaySummary(day stl.DaySummary) {
+	if _, ok := b.recurring.(hourly); ok {
+		return
+	}
+	period := b.recurring.Normalize(time.Unix(day.Date, 0).UTC())
+	if datedSummaryPtr := b.smap[period]; datedSummaryPtr != nil {
+		datedSummaryPtr.AddDaySummary(&day)
+	}
+}
+
+// SetSLA makes this instance compute the Compliance field of each
+// DatedSummary using sla.
+func (b *ByPeriodTotaler) SetSLA(sla *SLA) {
+	b.sla = sla
+}
+
 // DatedSummaries returns copies of the DatedSummaries collected so far.
-// Each DatedSummary falls on the beginning of a day, month, or year
-// depending on the recurring parameter passed to NewByPeriodTotaler().
+// Each DatedSummary falls on the beginning of an hour, day, week, month,
+// or year depending on the recurring parameter passed to NewByPeriodTotaler().
 func (b *ByPeriodTotaler) DatedSummaries() []*DatedSummary {
 	result := make([]*DatedSummary, 0, len(b.summaries))
 	for _, summary := range b.summaries {
 		summaryCopy := *summary
+		summaryCopy.DownloadStats = summary.DownloadStats.clone()
+		summaryCopy.UploadStats = summary.UploadStats.clone()
 		result = append(result, &summaryCopy)
 	}
 	return result
@@ -6,6 +6,7 @@ import (
 
 	"github.com/keep94/speedtestlogger/stl"
 	"github.com/keep94/speedtestlogger/stl/dates"
+	"github.com/keep94/speedtestlogger/stl/iperf"
 	"github.com/keep94/toolbox/date_util"
 	"github.com/stretchr/testify/assert"
 )
@@ -109,3 +110,195 @@ func TestYearly(t *testing.T) {
 	assert.Equal(
 		t, date_util.YMD(2030, 1, 1), r.Add(date_util.YMD(2025, 1, 1), 5))
 }
+
+func TestWeekly(t *testing.T) {
+	r := Weekly(time.Sunday)
+	assert.Equal(
+		t, date_util.YMD(2025, 8, 10), r.Normalize(date_util.YMD(2025, 8, 12)))
+	assert.Equal(
+		t, date_util.YMD(2025, 8, 10), r.Normalize(date_util.YMD(2025, 8, 10)))
+	assert.Equal(
+		t, date_util.YMD(2025, 8, 24), r.Add(date_util.YMD(2025, 8, 10), 2))
+	r = Weekly(time.Monday)
+	assert.Equal(
+		t, date_util.YMD(2025, 8, 11), r.Normalize(date_util.YMD(2025, 8, 12)))
+	assert.Equal(
+		t, date_util.YMD(2025, 8, 4), r.Normalize(date_util.YMD(2025, 8, 10)))
+}
+
+func TestHourly(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+	r := Hourly(loc)
+
+	// Dates are wall clock time in loc.
+	midnight := r.Normalize(date_util.YMD(2025, 11, 2))
+	assert.Equal(
+		t, time.Date(2025, 11, 2, 0, 0, 0, 0, loc).Unix(), midnight.Unix())
+
+	// 1:30 EDT and 1:30 EST fall in different hours.
+	firstOne := r.Add(midnight, 1)
+	secondOne := r.Add(midnight, 2)
+	assert.Equal(t, 1, firstOne.Hour())
+	assert.Equal(t, 1, secondOne.Hour())
+	assert.Equal(t, firstOne, r.Normalize(firstOne.Add(30*time.Minute)))
+	assert.Equal(t, secondOne, r.Normalize(secondOne.Add(30*time.Minute)))
+	assert.Equal(t, 2, r.Add(midnight, 3).Hour())
+}
+
+func TestByPeriodTotalerHourly(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+
+	// Daylight savings time ends
+	totaler := NewByPeriodTotaler(
+		date_util.YMD(2025, 11, 2),
+		date_util.YMD(2025, 11, 3),
+		Hourly(loc),
+		loc)
+	firstOne := time.Date(2025, 11, 2, 5, 15, 0, 0, time.UTC).Unix()
+	secondOne := firstOne + 3600
+	totaler.Add(stl.Entry{Ts: secondOne, DownloadMbps: 20.0, UploadMbps: 2.0})
+	totaler.Add(stl.Entry{Ts: firstOne, DownloadMbps: 10.0, UploadMbps: 1.0})
+	datedSummaries := totaler.DatedSummaries()
+	assert.Len(t, datedSummaries, 25)
+	assert.Equal(t, 23, datedSummaries[0].Date.Hour())
+	assert.Equal(t, 0, datedSummaries[24].Date.Hour())
+	assert.Equal(t, 1, datedSummaries[22].Date.Hour())
+	assert.Equal(t, 10.0, datedSummaries[23].DownloadMbps.Avg())
+	assert.Equal(t, 20.0, datedSummaries[22].DownloadMbps.Avg())
+
+	// Daylight savings time starts
+	totaler = NewByPeriodTotaler(
+		date_util.YMD(2025, 3, 9),
+		date_util.YMD(2025, 3, 10),
+		Hourly(loc),
+		loc)
+	assert.Len(t, totaler.DatedSummaries(), 23)
+}
+
+func TestByPeriodTotalerWeekly(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+	totaler := NewByPeriodTotaler(
+		date_util.YMD(2025, 8, 1),
+		date_util.YMD(2025, 9, 1),
+		Weekly(time.Monday),
+		loc)
+	totaler.Add(stl.Entry{
+		Ts:           dates.ToTimestamp(date_util.YMD(2025, 8, 17), loc),
+		DownloadMbps: 30.0,
+	})
+	totaler.Add(stl.Entry{
+		Ts:           dates.ToTimestamp(date_util.YMD(2025, 8, 11), loc),
+		DownloadMbps: 10.0,
+	})
+	datedSummaries := totaler.DatedSummaries()
+	assert.Len(t, datedSummaries, 5)
+	assert.Equal(t, date_util.YMD(2025, 8, 25), datedSummaries[0].Date)
+	assert.Equal(t, date_util.YMD(2025, 7, 28), datedSummaries[4].Date)
+	assert.Equal(t, 20.0, datedSummaries[2].DownloadMbps.Avg())
+}
+
+func TestSummaryLatency(t *testing.T) {
+	var summary Summary
+	summary.Add(stl.Entry{
+		DownloadMbps:      100.0,
+		UploadMbps:        10.0,
+		PingMs:            10.0,
+		JitterMs:          1.0,
+		PacketLossPercent: 0.0,
+	})
+	summary.Add(stl.Entry{
+		DownloadMbps:      80.0,
+		UploadMbps:        8.0,
+		PingMs:            20.0,
+		JitterMs:          3.0,
+		PacketLossPercent: 2.0,
+	})
+
+	// Latency not measured
+	summary.Add(stl.Entry{
+		DownloadMbps: 90.0,
+		UploadMbps:   9.0,
+		Unmeasured: stl.MeasureLatency |
+			stl.MeasureJitter |
+			stl.MeasurePacketLoss,
+	})
+	summary.Add(stl.Entry{})
+	assert.Equal(t, 4, summary.DownloadMbps.N)
+	assert.Equal(t, 15.0, summary.PingMs.Avg())
+	assert.Equal(t, 2.0, summary.JitterMs.Avg())
+	assert.Equal(t, 1.0, summary.PacketLossPercent.Avg())
+
+	// Packet loss not reported
+	summary.Add(stl.Entry{
+		DownloadMbps: 70.0,
+		UploadMbps:   7.0,
+		PingMs:       30.0,
+		JitterMs:     2.0,
+		Unmeasured:   stl.MeasurePacketLoss,
+	})
+	assert.Equal(t, 20.0, summary.PingMs.Avg())
+	assert.Equal(t, 2, summary.PacketLossPercent.N)
+	assert.Equal(t, 1.0, summary.PacketLossPercent.Avg())
+
+	day := summary.DaySummary("", date_util.YMD(2025, 8, 1))
+	assert.Equal(t, int64(3), day.LatencyTests)
+	assert.Equal(t, int64(3), day.JitterTests)
+	assert.Equal(t, int64(2), day.PacketLossTests)
+	var total Summary
+	total.AddDaySummary(&day)
+	assert.Equal(t, summary.JitterMs, total.JitterMs)
+	assert.Equal(t, summary.PacketLossPercent, total.PacketLossPercent)
+}
+
+func TestSummaryIperfUDP(t *testing.T) {
+	result := iperf.Result{
+		Protocol: "UDP",
+		Upload: &iperf.Transfer{
+			SentBitsPerSecond:     10000000,
+			ReceivedBitsPerSecond: 9000000,
+			JitterMs:              2.5,
+			LostPackets:           10,
+			Packets:               100,
+		},
+	}
+	var summary Summary
+	summary.Add(result.Entry(1000))
+	assert.Equal(t, Average{N: 1, Sum: 9.0}, summary.UploadMbps)
+	assert.False(t, summary.DownloadMbps.Exists())
+	assert.False(t, summary.PingMs.Exists())
+	assert.Equal(t, Average{N: 1, Sum: 2.5}, summary.JitterMs)
+	assert.Equal(t, Average{N: 1, Sum: 10.0}, summary.PacketLossPercent)
+
+	// TCP runs measure neither jitter nor packet loss.
+	result.Protocol = "TCP"
+	summary.Add(result.Entry(2000))
+	assert.Equal(t, 1, summary.JitterMs.N)
+	assert.Equal(t, 1, summary.PacketLossPercent.N)
+}
+
+func TestSummaryStatus(t *testing.T) {
+	var summary Summary
+	summary.Add(stl.Entry{DownloadMbps: 100.0, UploadMbps: 10.0})
+	summary.Add(stl.Entry{Status: stl.StatusToolError})
+	summary.Add(stl.Entry{Status: stl.StatusTimeout})
+	summary.Add(stl.Entry{DownloadMbps: 50.0, Status: stl.StatusPartial})
+	assert.False(t, summary.ServiceLapse)
+	assert.Equal(t, 2, summary.FailedRuns)
+	assert.Equal(t, 100.0, summary.PercentUptime.Avg())
+	assert.Equal(t, 75.0, summary.DownloadMbps.Avg())
+	assert.Equal(t, 10.0, summary.UploadMbps.Avg())
+
+	summary.Add(stl.Entry{Status: stl.StatusOutage})
+	assert.True(t, summary.ServiceLapse)
+	assert.InEpsilon(t, 66.67, summary.PercentUptime.Avg(), 0.0001)
+	assert.Equal(t, 50.0, summary.DownloadMbps.Avg())
+
+	// A run that measured only download speed
+	summary.Add(stl.Entry{DownloadMbps: 90.0, Unmeasured: stl.MeasureUpload})
+	assert.Equal(t, 75.0, summary.PercentUptime.Avg())
+	assert.Equal(t, 60.0, summary.DownloadMbps.Avg())
+	assert.Equal(t, 2, summary.UploadMbps.N)
+}
@@ -0,0 +1,187 @@
+package aggregators
+
+import (
+	"math"
+	"time"
+
+	"github.com/keep94/speedtestlogger/stl"
+)
+
+// DaySummary converts this summary to an stl.DaySummary for probe on
+// date. date is midnight UTC of the day as with Daily. The converted
+// Compliance holds only for the SLA it was computed with.
+func (s *Summary) DaySummary(probe string, date time.Time) stl.DaySummary {
+	return stl.DaySummary{
+		Probe:                probe,
+		Date:                 date.Unix(),
+		Tests:                int64(s.PercentUptime.N),
+		UpTests:              int64(math.Round(s.PercentUptime.Sum / 100.0)),
+		FailedRuns:           int64(s.FailedRuns),
+		DownloadMbps:         toStats(&s.DownloadMbps, &s.DownloadStats),
+		UploadMbps:           toStats(&s.UploadMbps, &s.UploadStats),
+		LatencyTests:         int64(s.PingMs.N),
+		PingMsSum:            s.PingMs.Sum,
+		JitterTests:          int64(s.JitterMs.N),
+		JitterMsSum:          s.JitterMs.Sum,
+		PacketLossTests:      int64(s.PacketLossPercent.N),
+		PacketLossPercentSum: s.PacketLossPercent.Sum,
+		UpSeconds:            s.TimeUptime.UpSeconds,
+		DownSeconds:          s.TimeUptime.DownSeconds,
+		Outages:              int64(s.OutageCount),
+		LongestOutageSeconds: int64(s.LongestOutage / time.Second),
+		FirstOutageStart:     s.firstOutage.Start,
+		FirstOutageEnd:       s.firstOutage.End,
+		LastOutageStart:      s.lastOutage.Start,
+		LastOutageEnd:        s.lastOutage.End,
+		DownloadPlanTests:    int64(s.Compliance.Download.N),
+		DownloadPlanMet:      int64(math.Round(s.Compliance.Download.Sum / 100.0)),
+		UploadPlanTests:      int64(s.Compliance.Upload.N),
+		UploadPlanMet:        int64(math.Round(s.Compliance.Upload.Sum / 100.0)),
+	}
+}
+
+// AddDaySummary adds a stored day summary to this summary. Speed
+// percentiles are unknown once a day summary is added; see
+// Distribution.HasPercentiles. Day summaries of a probe must be added
+// most recent to least recent like entries so that an outage spanning
+// days counts once.
+func (s *Summary) AddDaySummary(day *stl.DaySummary) {
+	s.addOutageEdges(day)
+	s.FailedRuns += int(day.FailedRuns)
+	s.PercentUptime.N += int(day.Tests)
+	s.PercentUptime.Sum += 100.0 * float64(day.UpTests)
+	if day.UpTests < day.Tests {
+		s.ServiceLapse = true
+	}
+	addStats(&s.DownloadMbps, &s.DownloadStats, day.DownloadMbps)
+	addStats(&s.UploadMbps, &s.UploadStats, day.UploadMbps)
+	s.PingMs.N += int(day.LatencyTests)
+	s.PingMs.Sum += day.PingMsSum
+	s.JitterMs.N += int(day.JitterTests)
+	s.JitterMs.Sum += day.JitterMsSum
+	s.PacketLossPercent.N += int(day.PacketLossTests)
+	s.PacketLossPercent.Sum += day.PacketLossPercentSum
+	s.TimeUptime.UpSeconds += day.UpSeconds
+	s.TimeUptime.DownSeconds += day.DownSeconds
+	s.OutageCount += int(day.Outages)
+	s.LongestOutage = max(
+		s.LongestOutage, time.Duration(day.LongestOutageSeconds)*time.Second)
+	s.Compliance.Download.N += int(day.DownloadPlanTests)
+	s.Compliance.Download.Sum += 100.0 * float64(day.DownloadPlanMet)
+	s.Compliance.Upload.N += int(day.UploadPlanTests)
+	s.Compliance.Upload.Sum += 100.0 * float64(day.UploadPlanMet)
+}
+
+// addOutageEdges joins the outage in progress at the end of day with the
+// outage in progress at the start of this summary if they are the same
+// outage. day comes before this summary. addOutageEdges must be called
+// before the counts of day are added.
+func (s *Summary) addOutageEdges(day *stl.DaySummary) {
+	if day.Tests == 0 {
+		return
+	}
+	first := outageSpan{Start: day.FirstOutageStart, End: day.FirstOutageEnd}
+	last := outageSpan{Start: day.LastOutageStart, End: day.LastOutageEnd}
+	if s.PercentUptime.N == 0 {
+		s.firstOutage = first
+		s.lastOutage = last
+		return
+	}
+	if s.firstOutage.exists() && last.exists() &&
+		last.End == s.firstOutage.Start {
+		joined := outageSpan{Start: last.Start, End: s.firstOutage.End}
+		s.OutageCount--
+		s.LongestOutage = max(s.LongestOutage, joined.duration())
+		if s.lastOutage == s.firstOutage {
+			s.lastOutage = joined
+		}
+		if first == last {
+			first = joined
+		}
+	}
+	s.firstOutage = first
+}
+
+// AddSummary adds other to this summary. Like AddDaySummary, AddSummary
+// leaves speed percentiles unknown.
+func (s *Summary) AddSummary(other *Summary) {
+	day := other.DaySummary("", time.Time{})
+	s.AddDaySummary(&day)
+}
+
+// DaySummaries summarises the entries of one probe by day.
+type DaySummaries struct {
+	probe     string
+	loc       *time.Location
+	later     outageTracker
+	sla       *SLA
+	summaries map[time.Time]*Summary
+	dates     []time.Time
+}
+
+// NewDaySummaries creates a new DaySummaries for the entries of probe.
+// loc is the time zone used to convert timestamps to dates.
+func NewDaySummaries(probe string, loc *time.Location) *DaySummaries {
+	return &DaySummaries{
+		probe: probe, loc: loc, summaries: make(map[time.Time]*Summary)}
+}
+
+// Seed tells this instance about the entry just after the ones it will
+// summarise so that time weighted uptime and outages of the last day
+// are correct. Seed must be called before Add.
+func (d *DaySummaries) Seed(entry stl.Entry) {
+	if !isFailedRun(&entry) {
+		d.later.add(entry.Ts, entry.IsOutage())
+	}
+}
+
+// SetSLA makes this instance compute how often tests met the plan
+// using sla.
+func (d *DaySummaries) SetSLA(sla *SLA) {
+	d.sla = sla
+}
+
+// Add adds an entry. Entries must be added most recent to least recent.
+func (d *DaySummaries) Add(entry stl.Entry) {
+	date := Daily().Normalize(time.Unix(entry.Ts, 0).In(d.loc))
+	summary, ok := d.summaries[date]
+	if !ok {
+		summary = &Summary{}
+		d.summaries[date] = summary
+		d.dates = append(d.dates, date)
+	}
+	if d.later.hasLater {
+		summary.tracker.seed(d.later.laterTs, d.later.laterOutage)
+	}
+	summary.Add(entry)
+	if d.sla != nil {
+		d.sla.Add(&summary.Compliance, entry)
+	}
+	if !isFailedRun(&entry) {
+		d.later.add(entry.Ts, entry.IsOutage())
+	}
+}
+
+// DaySummaries returns the summary of each day that has entries from
+// most recent to least recent.
+func (d *DaySummaries) DaySummaries() []stl.DaySummary {
+	result := make([]stl.DaySummary, 0, len(d.dates))
+	for _, date := range d.dates {
+		result = append(result, d.summaries[date].DaySummary(d.probe, date))
+	}
+	return result
+}
+
+// toStats returns the stats of distribution taking the sum from average
+// which, unlike distribution, keeps the exact sum.
+func toStats(average *Average, distribution *Distribution) stl.Stats {
+	result := distribution.Stats()
+	result.Sum = average.Sum
+	return result
+}
+
+func addStats(average *Average, distribution *Distribution, stats stl.Stats) {
+	average.N += int(stats.N)
+	average.Sum += stats.Sum
+	distribution.addStats(stats)
+}
@@ -0,0 +1,216 @@
+package aggregators
+
+import (
+	"testing"
+	"time"
+
+	"github.com/keep94/speedtestlogger/stl"
+	"github.com/keep94/toolbox/date_util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDaySummaries(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+	kept := stl.Entry{
+		Ts: dateTs(2025, 3, 3, 0, 30, loc), DownloadMbps: 90.0, UploadMbps: 9.0}
+	entries := []stl.Entry{
+		{Ts: dateTs(2025, 3, 2, 23, 0, loc)},
+		{Ts: dateTs(2025, 3, 2, 22, 0, loc), Status: stl.StatusToolError},
+		{
+			Ts:           dateTs(2025, 3, 2, 12, 0, loc),
+			DownloadMbps: 100.0,
+			UploadMbps:   10.0,
+			PingMs:       10.0,
+			JitterMs:     2.0,
+		},
+		{
+			Ts:           dateTs(2025, 3, 1, 12, 0, loc),
+			DownloadMbps: 80.0,
+			UploadMbps:   8.0,
+		},
+		{
+			Ts:           dateTs(2025, 3, 1, 6, 0, loc),
+			DownloadMbps: 60.0,
+			UploadMbps:   6.0,
+			PingMs:       20.0,
+			JitterMs:     4.0,
+		},
+	}
+	builder := NewDaySummaries("office", loc)
+	builder.Seed(kept)
+	var expected Summary
+	expected.tracker.seed(kept.Ts, false)
+	for _, entry := range entries {
+		builder.Add(entry)
+		expected.Add(entry)
+	}
+	days := builder.DaySummaries()
+	assert.Len(t, days, 2)
+
+	assert.Equal(t, "office", days[0].Probe)
+	assert.Equal(t, date_util.YMD(2025, 3, 2).Unix(), days[0].Date)
+	assert.Equal(t, int64(2), days[0].Tests)
+	assert.Equal(t, int64(1), days[0].UpTests)
+	assert.Equal(t, int64(1), days[0].FailedRuns)
+	assert.Equal(t, int64(1), days[0].Outages)
+	assert.Equal(t, int64(5400), days[0].LongestOutageSeconds)
+	assert.Equal(t, int64(5400), days[0].DownSeconds)
+	assert.Equal(t, int64(1), days[0].LatencyTests)
+	assert.Equal(t, 10.0, days[0].PingMsSum)
+
+	assert.Equal(t, date_util.YMD(2025, 3, 1).Unix(), days[1].Date)
+	assert.Equal(t, int64(2), days[1].Tests)
+	assert.Equal(t, int64(2), days[1].UpTests)
+	assert.Equal(t, stl.Stats{
+		N:          2,
+		Sum:        140.0,
+		SumSquares: 10000.0,
+		Min:        60.0,
+		Max:        80.0,
+	}, days[1].DownloadMbps)
+
+	var summary Summary
+	for i := range days {
+		summary.AddDaySummary(&days[i])
+	}
+	assert.Equal(t, expected.FailedRuns, summary.FailedRuns)
+	assert.Equal(t, expected.PercentUptime, summary.PercentUptime)
+	assert.Equal(t, expected.DownloadMbps, summary.DownloadMbps)
+	assert.Equal(t, expected.UploadMbps, summary.UploadMbps)
+	assert.Equal(t, expected.PingMs, summary.PingMs)
+	assert.Equal(t, expected.JitterMs, summary.JitterMs)
+	assert.Equal(t, expected.PacketLossPercent, summary.PacketLossPercent)
+	assert.Equal(t, expected.TimeUptime, summary.TimeUptime)
+	assert.Equal(t, expected.OutageCount, summary.OutageCount)
+	assert.Equal(t, expected.LongestOutage, summary.LongestOutage)
+	assert.True(t, summary.ServiceLapse)
+	assert.Equal(t, 4, summary.DownloadStats.N())
+	assert.False(t, summary.DownloadStats.HasPercentiles())
+	assert.Equal(t, 0.0, summary.DownloadStats.Min())
+	assert.Equal(t, 100.0, summary.DownloadStats.Max())
+	assert.InDelta(
+		t, expected.DownloadStats.Mean(), summary.DownloadStats.Mean(), 1e-9)
+	assert.InDelta(
+		t, expected.DownloadStats.StdDev(), summary.DownloadStats.StdDev(), 1e-9)
+}
+
+func TestByPeriodTotalerDaySummary(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+	totaler := NewByPeriodTotaler(
+		date_util.YMD(2025, 1, 1),
+		date_util.YMD(2025, 4, 1),
+		Monthly(),
+		loc)
+	totaler.Add(stl.Entry{
+		Ts: dateTs(2025, 3, 5, 12, 0, loc), DownloadMbps: 50.0, UploadMbps: 5.0})
+	totaler.AddDaySummary(stl.DaySummary{
+		Date:         date_util.YMD(2025, 2, 10).Unix(),
+		Tests:        4,
+		UpTests:      3,
+		DownloadMbps: stl.Stats{N: 4, Sum: 120.0, SumSquares: 4200.0, Max: 50.0},
+	})
+	datedSummaries := totaler.DatedSummaries()
+	assert.Len(t, datedSummaries, 3)
+	assert.Equal(t, date_util.YMD(2025, 3, 1), datedSummaries[0].Date)
+	assert.Equal(t, date_util.YMD(2025, 2, 1), datedSummaries[1].Date)
+	assert.Equal(t, 30.0, datedSummaries[1].DownloadMbps.Avg())
+	assert.Equal(t, 75.0, datedSummaries[1].PercentUptime.Avg())
+	assert.True(t, datedSummaries[1].ServiceLapse)
+
+	hourly := NewByPeriodTotaler(
+		time.Date(2025, 2, 10, 0, 0, 0, 0, loc),
+		time.Date(2025, 2, 11, 0, 0, 0, 0, loc),
+		Hourly(loc),
+		loc)
+	hourly.AddDaySummary(stl.DaySummary{
+		Date: date_util.YMD(2025, 2, 10).Unix(), Tests: 4, UpTests: 4})
+	for _, datedSummary := range hourly.DatedSummaries() {
+		assert.False(t, datedSummary.PercentUptime.Exists())
+	}
+}
+
+func dateTs(year, month, day, hour, minute int, loc *time.Location) int64 {
+	return time.Date(
+		year, time.Month(month), day, hour, minute, 0, 0, loc).Unix()
+}
+
+func TestSummaryAddSummary(t *testing.T) {
+	var first, second Summary
+	first.Add(stl.Entry{
+		Ts:           3600,
+		DownloadMbps: 100.0,
+		UploadMbps:   10.0,
+		Unmeasured:   stl.MeasureLatency,
+	})
+	first.Add(stl.Entry{Ts: 1800})
+	second.Add(stl.Entry{Ts: 100, DownloadMbps: 50.0, UploadMbps: 5.0, PingMs: 8.0})
+	second.Add(stl.Entry{Ts: 50, Status: stl.StatusTimeout})
+	var total Summary
+	total.AddSummary(&first)
+	total.AddSummary(&second)
+	assert.Equal(t, Average{N: 3, Sum: 150.0}, total.DownloadMbps)
+	assert.Equal(t, Average{N: 3, Sum: 200.0}, total.PercentUptime)
+	assert.Equal(t, Average{N: 1, Sum: 8.0}, total.PingMs)
+	assert.Equal(t, Uptime{DownSeconds: 1800}, total.TimeUptime)
+	assert.Equal(t, 1, total.OutageCount)
+	assert.Equal(t, 30*time.Minute, total.LongestOutage)
+	assert.Equal(t, 1, total.FailedRuns)
+	assert.True(t, total.ServiceLapse)
+	assert.Equal(t, 3, total.DownloadStats.N())
+	assert.False(t, total.DownloadStats.HasPercentiles())
+	assert.Equal(t, 100.0, total.DownloadStats.Max())
+}
+
+func TestSummaryAddSummaryCompliance(t *testing.T) {
+	sla := NewSLA(
+		stl.Plans{{DownloadMbps: 100.0, UploadMbps: 10.0, Effective: 0}}, 80.0)
+	var first, second Summary
+	for _, entry := range []stl.Entry{
+		{Ts: 3600, DownloadMbps: 90.0, UploadMbps: 5.0},
+		{Ts: 1800, DownloadMbps: 70.0, UploadMbps: 9.0},
+	} {
+		first.Add(entry)
+		sla.Add(&first.Compliance, entry)
+	}
+	entry := stl.Entry{Ts: 100, DownloadMbps: 85.0, UploadMbps: 8.0}
+	second.Add(entry)
+	sla.Add(&second.Compliance, entry)
+	var total Summary
+	total.AddSummary(&first)
+	total.AddSummary(&second)
+	assert.Equal(t, Average{N: 3, Sum: 200.0}, total.Compliance.Download)
+	assert.Equal(t, Average{N: 3, Sum: 200.0}, total.Compliance.Upload)
+}
+
+func TestDaySummariesOutageSpansDays(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+
+	// One outage from the evening of March 1 to the morning of March 3
+	entries := []stl.Entry{
+		{Ts: dateTs(2025, 3, 3, 8, 0, loc), DownloadMbps: 90.0, UploadMbps: 9.0},
+		{Ts: dateTs(2025, 3, 3, 2, 0, loc), Status: stl.StatusOutage},
+		{Ts: dateTs(2025, 3, 2, 12, 0, loc), Status: stl.StatusOutage},
+		{Ts: dateTs(2025, 3, 1, 20, 0, loc), Status: stl.StatusOutage},
+		{Ts: dateTs(2025, 3, 1, 12, 0, loc), DownloadMbps: 80.0, UploadMbps: 8.0},
+	}
+	builder := NewDaySummaries("", loc)
+	var expected Summary
+	for _, entry := range entries {
+		builder.Add(entry)
+		expected.Add(entry)
+	}
+	days := builder.DaySummaries()
+	assert.Len(t, days, 3)
+	var actual Summary
+	for i := range days {
+		assert.Equal(t, int64(1), days[i].Outages)
+		actual.AddDaySummary(&days[i])
+	}
+	assert.Equal(t, 1, expected.OutageCount)
+	assert.Equal(t, expected.OutageCount, actual.OutageCount)
+	assert.Equal(t, expected.LongestOutage, actual.LongestOutage)
+	assert.Equal(t, expected.TimeUptime, actual.TimeUptime)
+}
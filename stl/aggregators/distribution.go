@@ -0,0 +1,253 @@
+package aggregators
+
+import (
+	"math"
+	"slices"
+
+	"github.com/keep94/speedtestlogger/stl"
+)
+
+const (
+	// ExactLimit is the number of values a Distribution stores exactly.
+	// Once a Distribution has more values than this, it switches to a
+	// sketch that uses bounded memory.
+	ExactLimit = 1024
+
+	// SketchAccuracy is the maximum relative error of percentiles once a
+	// Distribution switches to a sketch.
+	SketchAccuracy = 0.01
+)
+
+var (
+	kGamma    = (1.0 + SketchAccuracy) / (1.0 - SketchAccuracy)
+	kLogGamma = math.Log(kGamma)
+)
+
+// Distribution records the distribution of non-negative values such as
+// internet speeds. Percentiles are exact until a Distribution has more
+// than ExactLimit values. After that, percentiles are within
+// SketchAccuracy of the true value. N, Min, Max, Mean, and StdDev are
+// always exact. Values that come from a stored summary rather than being
+// added one at a time count toward N, Min, Max, Mean, and StdDev only;
+// see HasPercentiles. The zero value is an empty Distribution ready to
+// use.
+type Distribution struct {
+	n      int
+	min    float64
+	max    float64
+	mean   float64
+	m2     float64
+	values []float64
+	sorted bool
+
+	// Number of values without percentile information.
+	unsampled int
+
+	// The sketch. zeros counts values too small to go in a bucket.
+	buckets map[int]int
+	zeros   int
+}
+
+// Add adds a value to this distribution. Negative values are treated
+// as zero.
+func (d *Distribution) Add(value float64) {
+	value = max(value, 0.0)
+	if d.n == 0 {
+		d.min, d.max = value, value
+	} else {
+		d.min = min(d.min, value)
+		d.max = max(d.max, value)
+	}
+
+	// Welford's algorithm
+	d.n++
+	delta := value - d.mean
+	d.mean += delta / float64(d.n)
+	d.m2 += delta * (value - d.mean)
+
+	if d.buckets != nil {
+		d.addToSketch(value)
+		return
+	}
+	d.values = append(d.values, value)
+	d.sorted = false
+	if len(d.values) > ExactLimit {
+		d.buckets = make(map[int]int)
+		for _, v := range d.values {
+			d.addToSketch(v)
+		}
+		d.values = nil
+	}
+}
+
+// N returns the number of values added.
+func (d *Distribution) N() int {
+	return d.n
+}
+
+// Exists returns true if this distribution has at least one value.
+func (d *Distribution) Exists() bool {
+	return d.n > 0
+}
+
+// HasPercentiles returns true if this distribution has at least one value
+// and all of its values were added one at a time so that percentiles are
+// known.
+func (d *Distribution) HasPercentiles() bool {
+	return d.Exists() && d.unsampled == 0
+}
+
+// Exact returns true if percentiles of this distribution are exact.
+func (d *Distribution) Exact() bool {
+	return d.buckets == nil
+}
+
+// Min returns the smallest value. Min panics if Exists returns false.
+func (d *Distribution) Min() float64 {
+	d.mustExist("Min")
+	return d.min
+}
+
+// Max returns the largest value. Max panics if Exists returns false.
+func (d *Distribution) Max() float64 {
+	d.mustExist("Max")
+	return d.max
+}
+
+// Mean returns the mean value. Mean panics if Exists returns false.
+func (d *Distribution) Mean() float64 {
+	d.mustExist("Mean")
+	return d.mean
+}
+
+// StdDev returns the population standard deviation. StdDev panics if
+// Exists returns false.
+func (d *Distribution) StdDev() float64 {
+	d.mustExist("StdDev")
+	return math.Sqrt(max(d.m2, 0.0) / float64(d.n))
+}
+
+// Median returns the median value. Median panics if HasPercentiles
+// returns false.
+func (d *Distribution) Median() float64 {
+	return d.Percentile(50.0)
+}
+
+// P5 returns the 5th percentile. P5 panics if HasPercentiles returns
+// false.
+func (d *Distribution) P5() float64 {
+	return d.Percentile(5.0)
+}
+
+// P95 returns the 95th percentile. P95 panics if HasPercentiles returns
+// false.
+func (d *Distribution) P95() float64 {
+	return d.Percentile(95.0)
+}
+
+// Percentile returns the pth percentile where p is between 0 and 100.
+// When exact, Percentile interpolates linearly between the two closest
+// ranks. Percentile panics if HasPercentiles returns false.
+func (d *Distribution) Percentile(p float64) float64 {
+	if !d.HasPercentiles() {
+		panic("Percentile() called but HasPercentiles returns false")
+	}
+	rank := min(max(p, 0.0), 100.0) / 100.0 * float64(d.n-1)
+	if d.buckets != nil {
+		return d.sketchValue(int(math.Round(rank)))
+	}
+	if !d.sorted {
+		slices.Sort(d.values)
+		d.sorted = true
+	}
+	lower := int(rank)
+	if lower >= len(d.values)-1 {
+		return d.values[len(d.values)-1]
+	}
+	frac := rank - float64(lower)
+	return d.values[lower] + frac*(d.values[lower+1]-d.values[lower])
+}
+
+// Stats returns the N, Sum, SumSquares, Min, and Max of this distribution.
+func (d *Distribution) Stats() stl.Stats {
+	n := float64(d.n)
+	return stl.Stats{
+		N:          int64(d.n),
+		Sum:        d.mean * n,
+		SumSquares: d.m2 + d.mean*d.mean*n,
+		Min:        d.min,
+		Max:        d.max,
+	}
+}
+
+// addStats adds the values that stats summarises to this distribution.
+// These values have no percentile information.
+func (d *Distribution) addStats(stats stl.Stats) {
+	if stats.N <= 0 {
+		return
+	}
+	if d.n == 0 {
+		d.min, d.max = stats.Min, stats.Max
+	} else {
+		d.min = min(d.min, stats.Min)
+		d.max = max(d.max, stats.Max)
+	}
+
+	// Chan's parallel algorithm
+	n := float64(stats.N)
+	mean := stats.Sum / n
+	m2 := max(stats.SumSquares-stats.Sum*mean, 0.0)
+	total := float64(d.n) + n
+	delta := mean - d.mean
+	d.m2 += m2 + delta*delta*float64(d.n)*n/total
+	d.mean += delta * n / total
+	d.n += int(stats.N)
+	d.unsampled += int(stats.N)
+}
+
+func (d *Distribution) clone() Distribution {
+	result := *d
+	result.values = slices.Clone(d.values)
+	if d.buckets != nil {
+		result.buckets = make(map[int]int, len(d.buckets))
+		for k, v := range d.buckets {
+			result.buckets[k] = v
+		}
+	}
+	return result
+}
+
+func (d *Distribution) mustExist(name string) {
+	if !d.Exists() {
+		panic(name + "() called but Exists returns false")
+	}
+}
+
+func (d *Distribution) addToSketch(value float64) {
+	if value < math.SmallestNonzeroFloat32 {
+		d.zeros++
+		return
+	}
+	d.buckets[int(math.Ceil(math.Log(value)/kLogGamma))]++
+}
+
+// sketchValue returns the value with the given zero based rank.
+func (d *Distribution) sketchValue(rank int) float64 {
+	if rank < d.zeros {
+		return d.min
+	}
+	keys := make([]int, 0, len(d.buckets))
+	for k := range d.buckets {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	seen := d.zeros
+	for _, k := range keys {
+		seen += d.buckets[k]
+		if rank < seen {
+			value := 2.0 * math.Pow(kGamma, float64(k)) / (kGamma + 1.0)
+			return min(max(value, d.min), d.max)
+		}
+	}
+	return d.max
+}
@@ -0,0 +1,107 @@
+package aggregators
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/keep94/speedtestlogger/stl"
+	"github.com/keep94/speedtestlogger/stl/dates"
+	"github.com/keep94/toolbox/date_util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDistributionEmpty(t *testing.T) {
+	var d Distribution
+	assert.False(t, d.Exists())
+	assert.True(t, d.Exact())
+	assert.Panics(t, func() { d.Median() })
+	assert.Panics(t, func() { d.StdDev() })
+}
+
+func TestDistributionExact(t *testing.T) {
+	var d Distribution
+	for _, v := range []float64{20.0, 900.0, 20.0, 40.0, 20.0} {
+		d.Add(v)
+	}
+	assert.True(t, d.Exists())
+	assert.True(t, d.Exact())
+	assert.Equal(t, 5, d.N())
+	assert.Equal(t, 20.0, d.Min())
+	assert.Equal(t, 900.0, d.Max())
+	assert.InDelta(t, 200.0, d.Mean(), 1e-9)
+	assert.Equal(t, 20.0, d.Median())
+	assert.Equal(t, 20.0, d.P5())
+	assert.InDelta(t, 728.0, d.P95(), 1e-9)
+	assert.Equal(t, 40.0, d.Percentile(75.0))
+	assert.InDelta(t, 350.0857, d.StdDev(), 1e-4)
+
+	// Adding after querying still works.
+	d.Add(10.0)
+	assert.Equal(t, 10.0, d.Min())
+	assert.Equal(t, 20.0, d.Median())
+}
+
+func TestDistributionSingle(t *testing.T) {
+	var d Distribution
+	d.Add(-3.0)
+	assert.Equal(t, 0.0, d.Min())
+	assert.Equal(t, 0.0, d.Median())
+	assert.Equal(t, 0.0, d.StdDev())
+}
+
+func TestDistributionSketch(t *testing.T) {
+	var d Distribution
+	for i := 0; i < 10000; i++ {
+		d.Add(float64(i % 1000))
+	}
+	assert.False(t, d.Exact())
+	assert.Equal(t, 10000, d.N())
+	assert.Equal(t, 0.0, d.Min())
+	assert.Equal(t, 999.0, d.Max())
+	assert.InDelta(t, 499.5, d.Mean(), 1e-9)
+	assert.InDelta(t, 288.67, d.StdDev(), 0.01)
+	assert.InEpsilon(t, 500.0, d.Median(), 2*SketchAccuracy)
+	assert.InEpsilon(t, 50.0, d.P5(), 2*SketchAccuracy)
+	assert.InEpsilon(t, 950.0, d.P95(), 2*SketchAccuracy)
+	assert.Equal(t, 0.0, d.Percentile(0.0))
+	assert.Equal(t, 999.0, d.Percentile(100.0))
+	assert.LessOrEqual(t, len(d.buckets), int(math.Log(1000.0)/kLogGamma)+1)
+}
+
+func TestSummaryDistribution(t *testing.T) {
+	loc := time.UTC
+	totaler := NewByPeriodTotaler(
+		date_util.YMD(2025, 12, 1),
+		date_util.YMD(2025, 12, 3),
+		Daily(),
+		loc)
+	var summary Summary
+	entries := []stl.Entry{
+		{Ts: dates.ToTimestamp(date_util.YMD(2025, 12, 2), loc), DownloadMbps: 900.0, UploadMbps: 30.0},
+		{Ts: dates.ToTimestamp(date_util.YMD(2025, 12, 1), loc), DownloadMbps: 20.0, UploadMbps: 10.0},
+		{Ts: dates.ToTimestamp(date_util.YMD(2025, 12, 1), loc), DownloadMbps: 40.0, Status: stl.StatusPartial},
+		{Ts: dates.ToTimestamp(date_util.YMD(2025, 12, 1), loc), Status: stl.StatusTimeout},
+	}
+	for _, entry := range entries {
+		totaler.Add(entry)
+		summary.Add(entry)
+	}
+	assert.Equal(t, 3, summary.DownloadStats.N())
+	assert.Equal(t, 40.0, summary.DownloadStats.Median())
+	assert.Equal(t, 2, summary.UploadStats.N())
+	assert.Equal(t, 20.0, summary.UploadStats.Median())
+
+	datedSummaries := totaler.DatedSummaries()
+	assert.Len(t, datedSummaries, 2)
+	assert.Equal(t, 900.0, datedSummaries[0].DownloadStats.Median())
+	assert.Equal(t, 30.0, datedSummaries[1].DownloadStats.Median())
+
+	// Copies don't change as more entries are added.
+	totaler.Add(stl.Entry{
+		Ts:           dates.ToTimestamp(date_util.YMD(2025, 12, 1), loc),
+		DownloadMbps: 1.0,
+		UploadMbps:   1.0})
+	assert.Equal(t, 2, datedSummaries[1].DownloadStats.N())
+	assert.Equal(t, 30.0, datedSummaries[1].DownloadStats.Median())
+}
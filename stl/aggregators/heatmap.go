@@ -0,0 +1,53 @@
+package aggregators
+
+import (
+	"time"
+
+	"github.com/keep94/speedtestlogger/stl"
+)
+
+// HeatmapCell summarizes the entries for one hour of one day of the week.
+type HeatmapCell struct {
+
+	// Download speed of tests that were not outages.
+	DownloadMbps Average
+
+	// Percent 0 to 100 of tests that were outages.
+	LapsePercent Average
+}
+
+// Heatmap aggregates stl.Entry instances by day of the week and hour of
+// the day. Failed test runs are ignored. Entries can be added in any order.
+type Heatmap struct {
+	loc   *time.Location
+	cells [7][24]HeatmapCell
+}
+
+// NewHeatmap creates a new Heatmap. loc is the time zone used to find the
+// day of the week and hour of the day of each entry.
+func NewHeatmap(loc *time.Location) *Heatmap {
+	return &Heatmap{loc: loc}
+}
+
+// Add adds an stl.Entry to this heatmap.
+func (h *Heatmap) Add(entry stl.Entry) {
+	if isFailedRun(&entry) {
+		return
+	}
+	ts := time.Unix(entry.Ts, 0).In(h.loc)
+	cell := &h.cells[ts.Weekday()][ts.Hour()]
+	if entry.IsOutage() {
+		cell.LapsePercent.Add(100.0)
+		return
+	}
+	cell.LapsePercent.Add(0.0)
+	if entry.HasDownload() {
+		cell.DownloadMbps.Add(entry.DownloadMbps)
+	}
+}
+
+// Cell returns the cell for the given day of the week and hour of the day.
+// hour goes from 0 to 23.
+func (h *Heatmap) Cell(weekday time.Weekday, hour int) HeatmapCell {
+	return h.cells[weekday][hour]
+}
@@ -0,0 +1,42 @@
+package aggregators
+
+import (
+	"testing"
+	"time"
+
+	"github.com/keep94/speedtestlogger/stl"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeatmap(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+	heatmap := NewHeatmap(loc)
+
+	// Tuesday 8/12/2025 20:xx in New York
+	evening := time.Date(2025, 8, 12, 20, 5, 0, 0, loc).Unix()
+	heatmap.Add(stl.Entry{Ts: evening, DownloadMbps: 20.0, UploadMbps: 5.0})
+	heatmap.Add(stl.Entry{Ts: evening + 1800, DownloadMbps: 40.0, UploadMbps: 5.0})
+	heatmap.Add(stl.Entry{Ts: evening + 7*86400, Status: stl.StatusOutage})
+	heatmap.Add(stl.Entry{Ts: evening + 60, Status: stl.StatusTimeout})
+
+	// Wednesday 8/13/2025 00:xx in New York is still Tuesday in UTC.
+	heatmap.Add(stl.Entry{
+		Ts:           time.Date(2025, 8, 13, 0, 30, 0, 0, loc).Unix(),
+		DownloadMbps: 100.0,
+		UploadMbps:   10.0,
+	})
+
+	cell := heatmap.Cell(time.Tuesday, 20)
+	assert.Equal(t, 30.0, cell.DownloadMbps.Avg())
+	assert.Equal(t, 3, cell.LapsePercent.N)
+	assert.InDelta(t, 33.33, cell.LapsePercent.Avg(), 0.01)
+
+	cell = heatmap.Cell(time.Wednesday, 0)
+	assert.Equal(t, 100.0, cell.DownloadMbps.Avg())
+	assert.Equal(t, 0.0, cell.LapsePercent.Avg())
+
+	cell = heatmap.Cell(time.Tuesday, 21)
+	assert.False(t, cell.DownloadMbps.Exists())
+	assert.False(t, cell.LapsePercent.Exists())
+}
@@ -0,0 +1,161 @@
+package aggregators
+
+import (
+	"time"
+
+	"github.com/keep94/speedtestlogger/stl"
+)
+
+const (
+
+	// MaxSampleInterval is the longest time in seconds that the state of a
+	// single sample is assumed to last. Time between samples beyond this
+	// counts as neither uptime nor downtime e.g when a cron job was
+	// skipped.
+	MaxSampleInterval = 2 * 60 * 60
+)
+
+// Outage represents a lapse in service reconstructed from consecutive
+// entries that are outages.
+type Outage struct {
+
+	// Timestamp of the first entry showing the outage.
+	Start int64
+
+	// Timestamp of the entry showing service restored. If service was not
+	// restored, the timestamp of the last entry showing the outage.
+	End int64
+
+	// True if there is an entry showing service restored.
+	Restored bool
+
+	// Number of entries showing the outage.
+	FailedSamples int
+}
+
+// Duration returns how long this outage lasted.
+func (o *Outage) Duration() time.Duration {
+	return time.Duration(o.End-o.Start) * time.Second
+}
+
+// Uptime represents time weighted uptime.
+type Uptime struct {
+	UpSeconds   int64
+	DownSeconds int64
+}
+
+// Exists returns true if this uptime exists.
+func (u *Uptime) Exists() bool {
+	return u.UpSeconds+u.DownSeconds > 0
+}
+
+// Percent returns the percent of time up 0 to 100. Percent panics if
+// Exists returns false.
+func (u *Uptime) Percent() float64 {
+	if !u.Exists() {
+		panic("Percent() called but Exists returns false")
+	}
+	return float64(u.UpSeconds) * 100.0 / float64(u.UpSeconds+u.DownSeconds)
+}
+
+// Downtime returns the total time down.
+func (u *Uptime) Downtime() time.Duration {
+	return time.Duration(u.DownSeconds) * time.Second
+}
+
+// Outages reconstructs outages from entries. Entries must be added most
+// recent to least recent which is the order stldb.EntriesRunner
+// returns them in. Entries for failed test runs are ignored.
+type Outages struct {
+	tracker outageTracker
+	outages []Outage
+}
+
+// Add adds an entry.
+func (o *Outages) Add(entry stl.Entry) {
+	if isFailedRun(&entry) {
+		return
+	}
+	_, started := o.tracker.add(entry.Ts, entry.IsOutage())
+	if started {
+		o.outages = append(o.outages, o.tracker.current)
+	} else if o.tracker.inOutage {
+		o.outages[len(o.outages)-1] = o.tracker.current
+	}
+}
+
+// Outages returns the outages found so far from most recent to least
+// recent.
+func (o *Outages) Outages() []Outage {
+	result := make([]Outage, len(o.outages))
+	copy(result, o.outages)
+	return result
+}
+
+// outageSpan is when an outage started and ended in seconds since the
+// epoch. The zero value means no outage.
+type outageSpan struct {
+	Start int64
+	End   int64
+}
+
+func (o outageSpan) exists() bool {
+	return o.Start != 0
+}
+
+func (o outageSpan) duration() time.Duration {
+	return time.Duration(o.End-o.Start) * time.Second
+}
+
+// outageTracker tracks samples added from most recent to least recent.
+type outageTracker struct {
+	hasLater    bool
+	laterTs     int64
+	laterOutage bool
+	inOutage    bool
+	current     Outage
+}
+
+// seed tells this tracker about the sample just after the ones it
+// will see. seed does nothing if this tracker has already seen a sample.
+func (t *outageTracker) seed(ts int64, outage bool) {
+	if t.hasLater {
+		return
+	}
+	t.hasLater = true
+	t.laterTs = ts
+	t.laterOutage = outage
+}
+
+// add adds a sample taken at ts. outage is true if the sample shows an
+// outage. add returns how many seconds the state of the sample lasted
+// and whether the sample started a new outage.
+func (t *outageTracker) add(ts int64, outage bool) (seconds int64, started bool) {
+	if t.hasLater {
+		seconds = min(t.laterTs-ts, MaxSampleInterval)
+	}
+	if outage {
+		if t.inOutage {
+			t.current.Start = ts
+			t.current.FailedSamples++
+		} else {
+			started = true
+			t.inOutage = true
+			t.current = Outage{Start: ts, End: ts, FailedSamples: 1}
+			if t.hasLater {
+				t.current.End = t.laterTs
+				t.current.Restored = !t.laterOutage
+			}
+		}
+	} else {
+		t.inOutage = false
+	}
+	t.hasLater = true
+	t.laterTs = ts
+	t.laterOutage = outage
+	return
+}
+
+func isFailedRun(entry *stl.Entry) bool {
+	return entry.Status == stl.StatusToolError || entry.Status == stl.StatusTimeout
+}
@@ -0,0 +1,98 @@
+package aggregators
+
+import (
+	"testing"
+	"time"
+
+	"github.com/keep94/speedtestlogger/stl"
+	"github.com/keep94/toolbox/date_util"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	kUp     = stl.Entry{DownloadMbps: 100.0, UploadMbps: 10.0}
+	kDown   = stl.Entry{Status: stl.StatusOutage}
+	kFailed = stl.Entry{Status: stl.StatusToolError}
+)
+
+func TestOutages(t *testing.T) {
+	var outages Outages
+	addAll(
+		outages.Add,
+		at(kDown, 10000),
+		at(kUp, 9000),
+		at(kDown, 8000),
+		at(kFailed, 7500),
+		at(kDown, 7000),
+		at(kUp, 6000),
+		at(kDown, 5000),
+	)
+	assert.Equal(
+		t,
+		[]Outage{
+			{Start: 10000, End: 10000, FailedSamples: 1},
+			{Start: 7000, End: 9000, Restored: true, FailedSamples: 2},
+			{Start: 5000, End: 6000, Restored: true, FailedSamples: 1},
+		},
+		outages.Outages())
+}
+
+func TestSummaryTimeUptime(t *testing.T) {
+	var summary Summary
+	addAll(
+		summary.Add,
+		at(kUp, 10000),
+		at(kDown, 9000),
+		at(kDown, 8000),
+		at(kUp, 7000),
+		at(kUp, 6600),
+
+		// More than MaxSampleInterval before previous sample
+		at(kDown, -3400),
+	)
+	assert.Equal(t, int64(1400), summary.TimeUptime.UpSeconds)
+	assert.Equal(
+		t, int64(2000+MaxSampleInterval), summary.TimeUptime.DownSeconds)
+	assert.Equal(t, 9200*time.Second, summary.TimeUptime.Downtime())
+	assert.InEpsilon(t, 13.21, summary.TimeUptime.Percent(), 0.001)
+	assert.Equal(t, 2, summary.OutageCount)
+	assert.Equal(t, 10000*time.Second, summary.LongestOutage)
+
+	// Sample based uptime counts each sample equally
+	assert.Equal(t, 50.0, summary.PercentUptime.Avg())
+}
+
+func TestByPeriodTotalerOutageAcrossPeriods(t *testing.T) {
+	totaler := NewByPeriodTotaler(
+		date_util.YMD(2025, 8, 1),
+		date_util.YMD(2025, 8, 3),
+		Daily(),
+		time.UTC)
+	midnight := date_util.YMD(2025, 8, 2).Unix()
+	addAll(
+		totaler.Add,
+		at(kUp, midnight+1200),
+		at(kDown, midnight+600),
+		at(kDown, midnight-600),
+		at(kUp, midnight-1200),
+	)
+	summaries := totaler.DatedSummaries()
+	assert.Equal(t, 1, summaries[0].OutageCount)
+	assert.Equal(t, 10*time.Minute, summaries[0].LongestOutage)
+	assert.Equal(t, int64(600), summaries[0].TimeUptime.DownSeconds)
+	assert.Equal(t, 1, summaries[1].OutageCount)
+	assert.Equal(t, 20*time.Minute, summaries[1].LongestOutage)
+	assert.Equal(t, int64(1200), summaries[1].TimeUptime.DownSeconds)
+	assert.Equal(t, int64(600), summaries[1].TimeUptime.UpSeconds)
+}
+
+func at(entry stl.Entry, ts int64) stl.Entry {
+	entry.Ts = ts
+	return entry
+}
+
+func addAll(add func(stl.Entry), entries ...stl.Entry) {
+	for _, entry := range entries {
+		add(entry)
+	}
+}
@@ -0,0 +1,65 @@
+package aggregators
+
+import (
+	"github.com/keep94/speedtestlogger/stl"
+)
+
+// Compliance reports how often speed tests meet the advertised plan.
+type Compliance struct {
+
+	// Percent 0 to 100 of tests where download speed met the plan.
+	Download Average
+
+	// Percent 0 to 100 of tests where upload speed met the plan. Tests
+	// run while the plan in effect did not advertise an upload speed
+	// are not included.
+	Upload Average
+}
+
+// SLA checks entries against advertised plans.
+type SLA struct {
+	plans    stl.Plans
+	fraction float64
+}
+
+// NewSLA creates a new SLA. A speed meets a plan if it is at least
+// percent percent of the advertised speed. e.g 80.0 means 80%.
+func NewSLA(plans stl.Plans, percent float64) *SLA {
+	return &SLA{plans: plans, fraction: percent / 100.0}
+}
+
+// Percent returns the percent of advertised speed needed to meet a plan.
+func (s *SLA) Percent() float64 {
+	return s.fraction * 100.0
+}
+
+// Plans returns the plans that this instance checks against.
+func (s *SLA) Plans() stl.Plans {
+	return s.plans
+}
+
+// Add adds entry to compliance. Add ignores failed test runs and entries
+// with no plan in effect. Outages count as not meeting the plan.
+func (s *SLA) Add(compliance *Compliance, entry stl.Entry) {
+	if isFailedRun(&entry) {
+		return
+	}
+	plan, ok := s.plans.At(entry.Ts)
+	if !ok {
+		return
+	}
+	if entry.HasDownload() {
+		compliance.Download.Add(
+			s.meets(entry.DownloadMbps, plan.DownloadMbps))
+	}
+	if plan.UploadMbps > 0.0 && entry.HasUpload() {
+		compliance.Upload.Add(s.meets(entry.UploadMbps, plan.UploadMbps))
+	}
+}
+
+func (s *SLA) meets(actual, advertised float64) float64 {
+	if actual >= s.fraction*advertised {
+		return 100.0
+	}
+	return 0.0
+}
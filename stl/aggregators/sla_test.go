@@ -0,0 +1,63 @@
+package aggregators
+
+import (
+	"testing"
+	"time"
+
+	"github.com/keep94/speedtestlogger/stl"
+	"github.com/keep94/speedtestlogger/stl/dates"
+	"github.com/keep94/toolbox/date_util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSLA(t *testing.T) {
+	sla := NewSLA(
+		stl.Plans{
+			{DownloadMbps: 1000.0, Effective: 2000},
+			{DownloadMbps: 100.0, UploadMbps: 10.0, Effective: 1000},
+		},
+		80.0)
+	assert.Equal(t, 80.0, sla.Percent())
+	var compliance Compliance
+
+	// No plan in effect
+	sla.Add(&compliance, stl.Entry{Ts: 999, DownloadMbps: 5.0, UploadMbps: 1.0})
+	assert.False(t, compliance.Download.Exists())
+
+	sla.Add(&compliance, stl.Entry{Ts: 1000, DownloadMbps: 80.0, UploadMbps: 7.9})
+	sla.Add(&compliance, stl.Entry{Ts: 1100, DownloadMbps: 79.0, UploadMbps: 9.0})
+	sla.Add(&compliance, stl.Entry{Ts: 1200, Status: stl.StatusOutage})
+	sla.Add(&compliance, stl.Entry{Ts: 1300, Status: stl.StatusTimeout})
+	sla.Add(&compliance, stl.Entry{
+		Ts: 1400, UploadMbps: 9.5, Status: stl.StatusPartial})
+
+	// Plan with no advertised upload speed
+	sla.Add(&compliance, stl.Entry{Ts: 2000, DownloadMbps: 850.0, UploadMbps: 1.0})
+
+	assert.Equal(t, 4, compliance.Download.N)
+	assert.Equal(t, 50.0, compliance.Download.Avg())
+	assert.Equal(t, 4, compliance.Upload.N)
+	assert.Equal(t, 50.0, compliance.Upload.Avg())
+}
+
+func TestByPeriodTotalerSLA(t *testing.T) {
+	loc := time.UTC
+	totaler := NewByPeriodTotaler(
+		date_util.YMD(2025, 12, 1),
+		date_util.YMD(2025, 12, 3),
+		Daily(),
+		loc)
+	totaler.SetSLA(NewSLA(stl.Plans{{DownloadMbps: 100.0}}, 90.0))
+	totaler.Add(stl.Entry{
+		Ts:           dates.ToTimestamp(date_util.YMD(2025, 12, 2), loc),
+		DownloadMbps: 95.0,
+	})
+	totaler.Add(stl.Entry{
+		Ts:           dates.ToTimestamp(date_util.YMD(2025, 12, 1), loc),
+		DownloadMbps: 85.0,
+	})
+	datedSummaries := totaler.DatedSummaries()
+	assert.Equal(t, 100.0, datedSummaries[0].Compliance.Download.Avg())
+	assert.Equal(t, 0.0, datedSummaries[1].Compliance.Download.Avg())
+	assert.False(t, datedSummaries[0].Compliance.Upload.Exists())
+}
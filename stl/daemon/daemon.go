@@ -0,0 +1,135 @@
+// Package daemon runs speed tests on a schedule.
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"os/exec"
+	"time"
+
+	"github.com/keep94/speedtestlogger/stl"
+	"github.com/keep94/speedtestlogger/stl/ookla"
+)
+
+const (
+
+	// How long to wait for a killed command to release its output.
+	kWaitDelay = 5 * time.Second
+)
+
+// Measurer measures internet speed.
+type Measurer interface {
+
+	// Run measures internet speed once and returns the resulting entry
+	// with timestamp ts. Failed measurements are reported in the Status
+	// field of the entry. Run returns an error only if ctx is done before
+	// the measurement finishes in which case there is no entry to record.
+	Run(ctx context.Context, ts int64) (stl.Entry, error)
+}
+
+// Command runs a speed test command such as
+// "speedtest -f json --accept-license" and converts its output to an
+// stl.Entry.
+type Command struct {
+
+	// The program followed by its arguments.
+	Args []string
+
+	// How long the command may run. 0 means no limit.
+	Timeout time.Duration
+}
+
+// Run runs the command once and returns the resulting entry with
+// timestamp ts. If the command times out, the entry has StatusTimeout.
+// If the command can't be run or its output can't be parsed, the entry
+// has StatusToolError. If the command exits with a non zero exit code,
+// the status of the entry comes from ookla.ClassifyFailure. Run returns
+// an error only if ctx is done before the command finishes in which case
+// there is no entry to record.
+func (c *Command) Run(ctx context.Context, ts int64) (stl.Entry, error) {
+	runCtx := ctx
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(runCtx, c.Args[0], c.Args[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = kWaitDelay
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return stl.Entry{}, ctx.Err()
+	}
+	if runCtx.Err() != nil {
+		return stl.Entry{Ts: ts, Status: stl.StatusTimeout}, nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return stl.Entry{
+			Ts: ts,
+			Status: ookla.ClassifyFailure(
+				exitErr.ExitCode(), stderr.String()),
+		}, nil
+	}
+	if err != nil {
+		return stl.Entry{Ts: ts, Status: stl.StatusToolError}, nil
+	}
+	result, err := ookla.Parse(&stdout)
+	if err != nil {
+		return stl.Entry{Ts: ts, Status: stl.StatusToolError}, nil
+	}
+	return result.Entry(ts), nil
+}
+
+// Scheduler calls a function at regular intervals. Calls never overlap.
+// If a call runs past the time of the next call, the next call is
+// skipped.
+type Scheduler struct {
+
+	// Time between calls. Must be positive.
+	Interval time.Duration
+
+	// Each call is delayed by a random amount between 0 and Jitter so
+	// that many probes don't all run at the same time.
+	Jitter time.Duration
+
+	// If non nil, called with the number of calls skipped because the
+	// previous call ran too long.
+	Skipped func(count int)
+}
+
+// Run calls f right away and then once every Interval until ctx is done.
+// f receives ctx so that it can stop early. Run returns ctx.Err() after
+// the call in progress, if any, returns.
+func (s *Scheduler) Run(ctx context.Context, f func(ctx context.Context)) error {
+	next := time.Now()
+	for {
+		delay := time.Until(next)
+		if s.Jitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(s.Jitter)))
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		f(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		next = next.Add(s.Interval)
+		skipped := 0
+		for now := time.Now(); !next.After(now); next = next.Add(s.Interval) {
+			skipped++
+		}
+		if skipped > 0 && s.Skipped != nil {
+			s.Skipped(skipped)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package daemon
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/keep94/speedtestlogger/stl"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	kJSONResult = `{"type":"result","timestamp":"2025-08-12T14:00:00Z","ping":{"jitter":1.5,"latency":12.25},"download":{"bandwidth":12500000},"upload":{"bandwidth":1250000},"isp":"Acme"}`
+)
+
+func TestCommandSuccess(t *testing.T) {
+	command := &Command{Args: []string{"echo", kJSONResult}}
+	entry, err := command.Run(context.Background(), 1234)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1234), entry.Ts)
+	assert.Equal(t, stl.StatusOk, entry.Status)
+	assert.Equal(t, 100.0, entry.DownloadMbps)
+	assert.Equal(t, 10.0, entry.UploadMbps)
+	assert.Equal(t, 12.25, entry.PingMs)
+}
+
+func TestCommandFailures(t *testing.T) {
+	ctx := context.Background()
+	command := &Command{
+		Args:    []string{"sleep", "10"},
+		Timeout: 50 * time.Millisecond,
+	}
+	entry, err := command.Run(ctx, 1234)
+	assert.NoError(t, err)
+	assert.Equal(t, stl.Entry{Ts: 1234, Status: stl.StatusTimeout}, entry)
+
+	command = &Command{Args: []string{"no-such-speedtest-binary"}}
+	entry, err = command.Run(ctx, 1234)
+	assert.NoError(t, err)
+	assert.Equal(t, stl.StatusToolError, entry.Status)
+
+	command = &Command{Args: []string{"echo", "not speedtest output"}}
+	entry, err = command.Run(ctx, 1234)
+	assert.NoError(t, err)
+	assert.Equal(t, stl.StatusToolError, entry.Status)
+
+	command = &Command{
+		Args: []string{"sh", "-c", "echo 'Connection refused' >&2; exit 2"}}
+	entry, err = command.Run(ctx, 1234)
+	assert.NoError(t, err)
+	assert.Equal(t, stl.StatusToolError, entry.Status)
+
+	command = &Command{Args: []string{"sh", "-c", "exit 2"}}
+	entry, err = command.Run(ctx, 1234)
+	assert.NoError(t, err)
+	assert.Equal(t, stl.StatusOutage, entry.Status)
+}
+
+func TestCommandCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(
+		context.Background(), 50*time.Millisecond)
+	defer cancel()
+	command := &Command{Args: []string{"sleep", "10"}, Timeout: time.Minute}
+	_, err := command.Run(ctx, 1234)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestScheduler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls int
+	scheduler := &Scheduler{Interval: 10 * time.Millisecond}
+	err := scheduler.Run(ctx, func(ctx context.Context) {
+		calls++
+		if calls == 3 {
+			cancel()
+		}
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 3, calls)
+}
+
+func TestSchedulerNoOverlap(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var running, overlaps atomic.Int32
+	var calls, skipped int
+	scheduler := &Scheduler{
+		Interval: 10 * time.Millisecond,
+		Jitter:   time.Millisecond,
+		Skipped:  func(count int) { skipped += count },
+	}
+	scheduler.Run(ctx, func(ctx context.Context) {
+		if running.Add(1) > 1 {
+			overlaps.Add(1)
+		}
+		calls++
+		time.Sleep(35 * time.Millisecond)
+		if calls == 2 {
+			cancel()
+		}
+		running.Add(-1)
+	})
+	assert.Equal(t, int32(0), overlaps.Load())
+	assert.Equal(t, 2, calls)
+	assert.GreaterOrEqual(t, skipped, 3)
+}
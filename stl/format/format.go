@@ -2,6 +2,7 @@
 package format
 
 import (
+	"fmt"
 	"strconv"
 	"time"
 )
@@ -11,6 +12,19 @@ func Float(value float64, precision int) string {
 	return strconv.FormatFloat(value, 'f', precision, 64)
 }
 
+// Duration formats a duration rounded to the minute e.g "3h05m" or "12m".
+// Durations under a minute are formatted in seconds e.g "45s".
+func Duration(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%ds", int64(d/time.Second))
+	}
+	minutes := int64(d.Round(time.Minute) / time.Minute)
+	if minutes < 60 {
+		return fmt.Sprintf("%dm", minutes)
+	}
+	return fmt.Sprintf("%dh%02dm", minutes/60, minutes%60)
+}
+
 // Time formats a time given seconds after Jan 1, 1970 GMT
 // and the time zone.
 func Time(ts int64, loc *time.Location) string {
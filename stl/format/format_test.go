@@ -18,3 +18,11 @@ func TestFloat(t *testing.T) {
 	assert.Equal(t, "51.38", Float(51.375, 2))
 	assert.Equal(t, "0.0312", Float(0.03125, 4))
 }
+
+func TestDuration(t *testing.T) {
+	assert.Equal(t, "0s", Duration(0))
+	assert.Equal(t, "45s", Duration(45*time.Second))
+	assert.Equal(t, "12m", Duration(12*time.Minute+10*time.Second))
+	assert.Equal(t, "3h05m", Duration(3*time.Hour+5*time.Minute))
+	assert.Equal(t, "26h00m", Duration(26*time.Hour))
+}
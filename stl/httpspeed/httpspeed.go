@@ -0,0 +1,413 @@
+// Package httpspeed measures internet speed over HTTP without the Ookla
+// speedtest CLI. Handler is the server side; Tester is the client side.
+package httpspeed
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/keep94/speedtestlogger/stl"
+)
+
+const (
+	PingPath     = "/ping"
+	DownloadPath = "/download"
+	UploadPath   = "/upload"
+)
+
+const (
+	kChunkSize       = 64 * 1024
+	kUploadSize      = 8 * 1024 * 1024
+	kMaxDownloadSize = 1 << 40
+	kBytesParam      = "bytes"
+)
+
+const (
+	DefaultStreams  = 4
+	DefaultDuration = 10 * time.Second
+	DefaultWarmUp   = 2 * time.Second
+	DefaultPings    = 5
+)
+
+var (
+	kChunk = newChunk()
+)
+
+// Handler returns the http.Handler for the speed server. The speed server
+// answers pings, sends data for download tests, and discards data for
+// upload tests.
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(PingPath, servePing)
+	mux.HandleFunc(DownloadPath, serveDownload)
+	mux.HandleFunc(UploadPath, serveUpload)
+	return mux
+}
+
+// Tester measures download speed, upload speed, and latency against a
+// speed server.
+type Tester struct {
+
+	// The base URL of the speed server e.g "http://127.0.0.1:8098"
+	URL string
+
+	// Number of parallel streams. 0 means DefaultStreams.
+	Streams int
+
+	// How long to measure each direction after warm up. 0 means
+	// DefaultDuration.
+	Duration time.Duration
+
+	// How long to transfer data before measuring to let TCP ramp up.
+	// 0 means DefaultWarmUp; negative means no warm up.
+	WarmUp time.Duration
+
+	// Number of pings for measuring latency. 0 means DefaultPings.
+	Pings int
+
+	// How long the whole measurement may take. 0 means no limit.
+	Timeout time.Duration
+}
+
+// Run measures speed and returns the resulting entry with timestamp ts.
+// If the speed server can't be reached, the entry has StatusOutage. If
+// the speed server responds with an error, the entry has
+// StatusToolError. If only one of download or upload succeeds, the entry
+// has StatusPartial. If the measurement takes longer than Timeout, the
+// entry has StatusTimeout. Run returns an error only if ctx is done before
+// the measurement finishes. Tester satisfies the daemon.Measurer
+// interface.
+func (t *Tester) Run(ctx context.Context, ts int64) (stl.Entry, error) {
+	runCtx := ctx
+	if t.Timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, t.Timeout)
+		defer cancel()
+	}
+	entry, ok := t.run(runCtx, ts)
+	if ctx.Err() != nil {
+		return stl.Entry{}, ctx.Err()
+	}
+	if !ok {
+		return stl.Entry{Ts: ts, Status: stl.StatusTimeout}, nil
+	}
+	return entry, nil
+}
+
+// run works like Run except that it returns false if ctx is done
+// before the measurement finishes.
+func (t *Tester) run(ctx context.Context, ts int64) (stl.Entry, bool) {
+	transport := &http.Transport{
+		MaxIdleConnsPerHost: t.streams(),
+		DisableCompression:  true,
+	}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport}
+	entry := stl.Entry{Ts: ts}
+	rtts, err := t.ping(ctx, client)
+	if ctx.Err() != nil {
+		return stl.Entry{}, false
+	}
+	if err != nil {
+		entry.Status = failureStatus(err)
+		return entry, true
+	}
+	entry.PingMs, entry.JitterMs = latency(rtts)
+	entry.Unmeasured = stl.MeasurePacketLoss
+	entry.DownloadMbps = t.throughput(ctx, func(ctx context.Context, count *atomic.Int64) error {
+		return download(ctx, client, t.URL, count)
+	})
+	entry.UploadMbps = t.throughput(ctx, func(ctx context.Context, count *atomic.Int64) error {
+		return upload(ctx, client, t.URL, count)
+	})
+	if ctx.Err() != nil {
+		return stl.Entry{}, false
+	}
+	switch {
+	case entry.DownloadMbps == 0.0 && entry.UploadMbps == 0.0:
+		entry.Status = stl.StatusOutage
+	case entry.DownloadMbps == 0.0 || entry.UploadMbps == 0.0:
+		entry.Status = stl.StatusPartial
+	}
+	return entry, true
+}
+
+func (t *Tester) streams() int {
+	if t.Streams <= 0 {
+		return DefaultStreams
+	}
+	return t.Streams
+}
+
+func (t *Tester) duration() time.Duration {
+	if t.Duration <= 0 {
+		return DefaultDuration
+	}
+	return t.Duration
+}
+
+func (t *Tester) warmUp() time.Duration {
+	if t.WarmUp < 0 {
+		return 0
+	}
+	if t.WarmUp == 0 {
+		return DefaultWarmUp
+	}
+	return t.WarmUp
+}
+
+func (t *Tester) pings() int {
+	if t.Pings <= 0 {
+		return DefaultPings
+	}
+	return t.Pings
+}
+
+// ping returns the round trip times of the pings. The first ping sets
+// up the connection, so its round trip time is discarded.
+func (t *Tester) ping(
+	ctx context.Context, client *http.Client) ([]time.Duration, error) {
+	var result []time.Duration
+	for i := 0; i <= t.pings(); i++ {
+		start := time.Now()
+		if err := get(ctx, client, t.URL+PingPath, io.Discard); err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			result = append(result, time.Since(start))
+		}
+	}
+	return result, nil
+}
+
+// throughput runs transfer on parallel streams and returns the speed in
+// megabits per second after warm up. Each stream adds the bytes it
+// transfers to count. throughput returns 0 if no bytes were transferred
+// after warm up or if the speed server rejected any transfer.
+func (t *Tester) throughput(
+	ctx context.Context,
+	transfer func(ctx context.Context, count *atomic.Int64) error) float64 {
+	ctx, cancel := context.WithCancel(ctx)
+	var count atomic.Int64
+	var rejected atomic.Bool
+	var wg sync.WaitGroup
+	for i := 0; i < t.streams(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var serr *statusError
+			if errors.As(transfer(ctx, &count), &serr) {
+				rejected.Store(true)
+			}
+		}()
+	}
+	done := func() bool {
+		cancel()
+		wg.Wait()
+		return !rejected.Load()
+	}
+	if !sleep(ctx, t.warmUp()) {
+		done()
+		return 0.0
+	}
+	startCount, start := count.Load(), time.Now()
+	if !sleep(ctx, t.duration()) {
+		done()
+		return 0.0
+	}
+	bytes, elapsed := count.Load()-startCount, time.Since(start)
+	if !done() {
+		return 0.0
+	}
+	return float64(bytes) * 8.0 / 1000000.0 / elapsed.Seconds()
+}
+
+func download(
+	ctx context.Context,
+	client *http.Client,
+	baseURL string,
+	count *atomic.Int64) error {
+	url := fmt.Sprintf(
+		"%s%s?%s=%d", baseURL, DownloadPath, kBytesParam, kMaxDownloadSize)
+	for ctx.Err() == nil {
+		if err := get(ctx, client, url, &countingWriter{count}); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+func upload(
+	ctx context.Context,
+	client *http.Client,
+	baseURL string,
+	count *atomic.Int64) error {
+	for ctx.Err() == nil {
+		body := &countingReader{remaining: kUploadSize, count: count}
+		request, err := http.NewRequestWithContext(
+			ctx, http.MethodPost, baseURL+UploadPath, body)
+		if err != nil {
+			return err
+		}
+		request.ContentLength = kUploadSize
+		response, err := client.Do(request)
+		if err != nil {
+			return err
+		}
+		io.Copy(io.Discard, response.Body)
+		response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			return &statusError{response.StatusCode}
+		}
+	}
+	return ctx.Err()
+}
+
+// get fetches url writing the response body to w.
+func get(
+	ctx context.Context, client *http.Client, url string, w io.Writer) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, response.Body)
+		return &statusError{response.StatusCode}
+	}
+	_, err = io.Copy(w, response.Body)
+	return err
+}
+
+// latency returns the average round trip time and the jitter, the
+// average difference between consecutive round trip times, in
+// milliseconds.
+func latency(rtts []time.Duration) (pingMs, jitterMs float64) {
+	var total, totalDiff float64
+	for i, rtt := range rtts {
+		ms := float64(rtt) / float64(time.Millisecond)
+		total += ms
+		if i > 0 {
+			totalDiff += math.Abs(
+				ms - float64(rtts[i-1])/float64(time.Millisecond))
+		}
+	}
+	pingMs = total / float64(len(rtts))
+	if len(rtts) > 1 {
+		jitterMs = totalDiff / float64(len(rtts)-1)
+	}
+	return
+}
+
+// failureStatus returns the status for a failed ping.
+func failureStatus(err error) stl.Status {
+	var serr *statusError
+	if errors.As(err, &serr) {
+		return stl.StatusToolError
+	}
+	return stl.StatusOutage
+}
+
+// sleep sleeps for d and returns true or returns false if ctx is done
+// first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+type statusError struct {
+	code int
+}
+
+func (s *statusError) Error() string {
+	return fmt.Sprintf("speed server returned %d", s.code)
+}
+
+type countingWriter struct {
+	count *atomic.Int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.count.Add(int64(len(p)))
+	return len(p), nil
+}
+
+// countingReader supplies remaining bytes of upload data adding the
+// number of bytes read to count.
+type countingReader struct {
+	remaining int64
+	count     *atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	if c.remaining == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p[:min(int64(len(p)), c.remaining)], kChunk)
+	c.remaining -= int64(n)
+	c.count.Add(int64(n))
+	return n, nil
+}
+
+func servePing(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte("pong"))
+}
+
+func serveDownload(w http.ResponseWriter, r *http.Request) {
+	size, err := strconv.ParseInt(r.FormValue(kBytesParam), 10, 64)
+	if err != nil || size < 0 || size > kMaxDownloadSize {
+		http.Error(w, "bytes must be between 0 and 2^40", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	for size > 0 {
+		n, err := w.Write(kChunk[:min(size, kChunkSize)])
+		if err != nil {
+			return
+		}
+		size -= int64(n)
+	}
+}
+
+func serveUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	n, err := io.Copy(io.Discard, r.Body)
+	if err != nil {
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintf(w, "%d", n)
+}
+
+// newChunk returns random data so that compression along the way
+// doesn't inflate the measured speed.
+func newChunk() []byte {
+	result := make([]byte, kChunkSize)
+	rand.Read(result)
+	return result
+}
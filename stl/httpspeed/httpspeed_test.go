@@ -0,0 +1,114 @@
+package httpspeed
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/keep94/speedtestlogger/stl"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTester(t *testing.T) {
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+	tester := &Tester{
+		URL:      server.URL,
+		Streams:  2,
+		Duration: 200 * time.Millisecond,
+		WarmUp:   50 * time.Millisecond,
+		Pings:    3,
+	}
+	entry, err := tester.Run(context.Background(), 1234)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1234), entry.Ts)
+	assert.Equal(t, stl.StatusOk, entry.Status)
+	assert.Greater(t, entry.DownloadMbps, 0.0)
+	assert.Greater(t, entry.UploadMbps, 0.0)
+	assert.Greater(t, entry.PingMs, 0.0)
+	assert.False(t, entry.HasPacketLoss())
+}
+
+func TestTesterUnreachable(t *testing.T) {
+	server := httptest.NewServer(Handler())
+	url := server.URL
+	server.Close()
+	tester := &Tester{URL: url}
+	entry, err := tester.Run(context.Background(), 1234)
+	assert.NoError(t, err)
+	assert.Equal(t, stl.Entry{Ts: 1234, Status: stl.StatusOutage}, entry)
+}
+
+func TestTesterServerError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	tester := &Tester{URL: server.URL}
+	entry, err := tester.Run(context.Background(), 1234)
+	assert.NoError(t, err)
+	assert.Equal(t, stl.Entry{Ts: 1234, Status: stl.StatusToolError}, entry)
+}
+
+func TestTesterPartial(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(PingPath, servePing)
+	mux.HandleFunc(DownloadPath, serveDownload)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	tester := &Tester{
+		URL:      server.URL,
+		Streams:  1,
+		Duration: 100 * time.Millisecond,
+		WarmUp:   -1,
+	}
+	entry, err := tester.Run(context.Background(), 1234)
+	assert.NoError(t, err)
+	assert.Equal(t, stl.StatusPartial, entry.Status)
+	assert.Greater(t, entry.DownloadMbps, 0.0)
+	assert.Equal(t, 0.0, entry.UploadMbps)
+}
+
+func TestTesterCancelled(t *testing.T) {
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(
+		context.Background(), 100*time.Millisecond)
+	defer cancel()
+	tester := &Tester{URL: server.URL, Duration: time.Minute}
+	_, err := tester.Run(ctx, 1234)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestTesterTimeout(t *testing.T) {
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+	tester := &Tester{
+		URL:      server.URL,
+		Duration: time.Minute,
+		Timeout:  100 * time.Millisecond,
+	}
+	entry, err := tester.Run(context.Background(), 1234)
+	assert.NoError(t, err)
+	assert.Equal(t, stl.Entry{Ts: 1234, Status: stl.StatusTimeout}, entry)
+}
+
+func TestLatency(t *testing.T) {
+	pingMs, jitterMs := latency([]time.Duration{
+		10 * time.Millisecond, 14 * time.Millisecond, 12 * time.Millisecond})
+	assert.Equal(t, 12.0, pingMs)
+	assert.Equal(t, 3.0, jitterMs)
+}
+
+func TestServeDownload(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	serveDownload(
+		recorder, httptest.NewRequest(http.MethodGet, "/download?bytes=100000", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, 100000, recorder.Body.Len())
+
+	recorder = httptest.NewRecorder()
+	serveDownload(
+		recorder, httptest.NewRequest(http.MethodGet, "/download?bytes=x", nil))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
@@ -0,0 +1,524 @@
+// Package ingest reads speed test results in bulk from files.
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/speedtestlogger/stl"
+	"github.com/keep94/speedtestlogger/stl/iperf"
+	"github.com/keep94/speedtestlogger/stl/ookla"
+)
+
+var (
+	kTimestampColumns = []string{"timestamp", "ts", "time", "date"}
+	kDownloadColumns  = []string{"download_mbps", "downloadmbps", "download mbps"}
+	kUploadColumns    = []string{"upload_mbps", "uploadmbps", "upload mbps"}
+	kPingColumns      = []string{"ping_ms", "pingms", "ping", "idle latency", "latency"}
+	kJitterColumns    = []string{"jitter_ms", "jitterms", "idle jitter", "jitter"}
+	kLossColumns      = []string{"packet_loss_percent", "packetlosspercent", "packet_loss", "packet loss"}
+	kStatusColumns    = []string{"status"}
+	kProbeColumns     = []string{"probe", "site"}
+
+	// Ookla csv columns which are in bytes per second
+	kOoklaDownloadColumn = "download"
+	kOoklaUploadColumn   = "upload"
+
+	kTimestampFormats = []string{
+		"2006-01-02 15:04:05",
+		"2006-01-02 15:04",
+		"2006-01-02T15:04:05",
+	}
+)
+
+// Record is a single record read from an input file.
+type Record struct {
+
+	// The 1-based position of the record within the input. For csv
+	// input, this is the line number.
+	Row int
+
+	// The entry read. Entry.Id is always 0.
+	Entry stl.Entry
+
+	// Non-nil if the record is invalid. In that case Entry is meaningless.
+	Err error
+}
+
+// Read reads records from r and sends them to consumer. Read detects the
+// format of r from its content. r can contain csv or tsv with a header
+// row, or json. Read accepts a single JSON value, a JSON array, or newline
+// delimited JSON. Each JSON value can be an Ookla speedtest result, an
+// iperf3 -J result, or an entry as exported by stlview. In newline
+// delimited JSON, a malformed line is an invalid record. In csv input,
+// speeds in download_mbps and upload_mbps columns are in Mbps while
+// speeds in Ookla's download and upload columns are in bytes per second.
+// loc is the time zone for timestamps that have none. Read returns an
+// error only if it cannot continue reading r; invalid records are sent
+// to consumer with Err set.
+func Read(
+	r io.Reader,
+	loc *time.Location,
+	consumer consume2.Consumer[Record]) error {
+	reader := bufio.NewReader(r)
+	for {
+		b, err := reader.ReadByte()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !isSpace(b) {
+			reader.UnreadByte()
+			if b == '{' || b == '[' {
+				return readJSON(reader, loc, consumer)
+			}
+			return readCSV(reader, loc, consumer)
+		}
+	}
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
+
+// readJSON reads json values from r. If the first line of r holds only
+// complete json values, readJSON reads r as newline delimited json so
+// that a malformed line becomes an invalid record rather than ending the
+// read. Otherwise, readJSON reads r as a stream of json values such as
+// pretty printed iperf3 output.
+func readJSON(
+	r *bufio.Reader,
+	loc *time.Location,
+	consumer consume2.Consumer[Record]) error {
+	firstLine, err := r.ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if _, lineErr := decodeLine(firstLine); lineErr == nil {
+		return readNDJSON(firstLine, r, loc, consumer)
+	}
+	return readJSONStream(
+		io.MultiReader(bytes.NewReader(firstLine), r), loc, consumer)
+}
+
+func readNDJSON(
+	firstLine []byte,
+	r *bufio.Reader,
+	loc *time.Location,
+	consumer consume2.Consumer[Record]) error {
+	row := 0
+	line := firstLine
+	for consumer.CanConsume() {
+		values, err := decodeLine(line)
+		if err != nil {
+			row++
+			consumer.Consume(Record{
+				Row: row, Err: fmt.Errorf("malformed json: %w", err)})
+		} else if err := consumeValues(values, &row, loc, consumer); err != nil {
+			return err
+		}
+		if len(line) == 0 || line[len(line)-1] != '\n' {
+			return nil
+		}
+		line, err = r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeLine returns the json values in line.
+func decodeLine(line []byte) ([]json.RawMessage, error) {
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	var result []json.RawMessage
+	for {
+		var raw json.RawMessage
+		err := decoder.Decode(&raw)
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, raw)
+	}
+}
+
+func readJSONStream(
+	r io.Reader,
+	loc *time.Location,
+	consumer consume2.Consumer[Record]) error {
+	decoder := json.NewDecoder(r)
+	row := 0
+	for consumer.CanConsume() {
+		var raw json.RawMessage
+		err := decoder.Decode(&raw)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("malformed json after record %d: %w", row, err)
+		}
+		err = consumeValues([]json.RawMessage{raw}, &row, loc, consumer)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// consumeValues sends the entries in values to consumer. A value can be
+// an array of entries. row is the number of records sent so far.
+func consumeValues(
+	values []json.RawMessage,
+	row *int,
+	loc *time.Location,
+	consumer consume2.Consumer[Record]) error {
+	for _, raw := range values {
+		var elements []json.RawMessage
+		if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) {
+			if err := json.Unmarshal(raw, &elements); err != nil {
+				return fmt.Errorf("malformed json after record %d: %w", *row, err)
+			}
+		} else {
+			elements = []json.RawMessage{raw}
+		}
+		for _, value := range elements {
+			entry, ok, err := jsonToEntry(value, loc)
+			if !ok {
+				continue
+			}
+			*row++
+			if !consumer.CanConsume() {
+				return nil
+			}
+			consumer.Consume(Record{Row: *row, Entry: entry, Err: err})
+		}
+	}
+	return nil
+}
+
+type jsonEntry struct {
+	Type              string          `json:"type"`
+	Probe             string          `json:"probe"`
+	Ts                json.RawMessage `json:"ts"`
+	DownloadMbps      *float64        `json:"downloadMbps"`
+	UploadMbps        *float64        `json:"uploadMbps"`
+	PingMs            *float64        `json:"pingMs"`
+	JitterMs          *float64        `json:"jitterMs"`
+	PacketLossPercent *float64        `json:"packetLossPercent"`
+	Retransmits       int64           `json:"retransmits"`
+	Status            string          `json:"status"`
+	Unmeasured        []string        `json:"unmeasured"`
+}
+
+// jsonToEntry converts a single json value to an entry. ok is false if
+// the json value should be ignored such as an Ookla log message.
+func jsonToEntry(
+	raw json.RawMessage, loc *time.Location) (
+	entry stl.Entry, ok bool, err error) {
+	if iperf.IsResult(raw) {
+		result, err := iperf.ParseJSON(bytes.NewReader(raw))
+		if err != nil {
+			return stl.Entry{}, true, err
+		}
+		if result.Timestamp.Unix() == 0 {
+			return stl.Entry{}, true, errors.New("iperf result missing timestamp")
+		}
+		return result.Entry(result.Timestamp.Unix()), true, nil
+	}
+	var doc jsonEntry
+	if err = json.Unmarshal(raw, &doc); err != nil {
+		return stl.Entry{}, true, err
+	}
+	switch doc.Type {
+	case "result":
+		result, err := ookla.ParseJSON(bytes.NewReader(raw))
+		if err != nil {
+			return stl.Entry{}, true, err
+		}
+		return result.Entry(result.Timestamp.Unix()), true, nil
+	case "":
+	default:
+		return stl.Entry{}, false, nil
+	}
+	if doc.DownloadMbps == nil || doc.UploadMbps == nil {
+		return stl.Entry{}, true, errors.New("missing downloadMbps or uploadMbps")
+	}
+	ts, err := parseJSONTimestamp(doc.Ts, loc)
+	if err != nil {
+		return stl.Entry{}, true, err
+	}
+	status, err := parseStatus(doc.Status)
+	if err != nil {
+		return stl.Entry{}, true, err
+	}
+	unmeasured, ok := stl.ParseMeasurement(doc.Unmeasured)
+	if !ok {
+		return stl.Entry{}, true, fmt.Errorf(
+			"bad unmeasured: %q", doc.Unmeasured)
+	}
+	entry = stl.Entry{
+		Probe:        doc.Probe,
+		Ts:           ts,
+		DownloadMbps: *doc.DownloadMbps,
+		UploadMbps:   *doc.UploadMbps,
+		Retransmits:  doc.Retransmits,
+		Status:       status,
+		Unmeasured:   unmeasured,
+	}
+	entry.PingMs = optional(doc.PingMs, stl.MeasureLatency, &entry.Unmeasured)
+	entry.JitterMs = optional(doc.JitterMs, stl.MeasureJitter, &entry.Unmeasured)
+	entry.PacketLossPercent = optional(
+		doc.PacketLossPercent, stl.MeasurePacketLoss, &entry.Unmeasured)
+	return entry, true, validate(&entry)
+}
+
+// optional returns *value. If value is nil, optional returns 0 and adds
+// measurement to unmeasured.
+func optional(
+	value *float64,
+	measurement stl.Measurement,
+	unmeasured *stl.Measurement) float64 {
+	if value == nil {
+		*unmeasured |= measurement
+		return 0.0
+	}
+	return *value
+}
+
+func parseJSONTimestamp(raw json.RawMessage, loc *time.Location) (int64, error) {
+	if len(raw) == 0 {
+		return 0, errors.New("missing ts")
+	}
+	var str string
+	if err := json.Unmarshal(raw, &str); err == nil {
+		return parseTimestamp(str, loc)
+	}
+	var seconds int64
+	if err := json.Unmarshal(raw, &seconds); err != nil {
+		return 0, fmt.Errorf("bad ts: %s", raw)
+	}
+	return seconds, nil
+}
+
+func readCSV(
+	reader *bufio.Reader,
+	loc *time.Location,
+	consumer consume2.Consumer[Record]) error {
+	firstLine, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	csvReader := csv.NewReader(
+		io.MultiReader(strings.NewReader(firstLine), reader))
+	if strings.Contains(firstLine, "\t") {
+		csvReader.Comma = '\t'
+	}
+	csvReader.FieldsPerRecord = -1
+	header, err := csvReader.Read()
+	if err != nil {
+		return fmt.Errorf("unable to read header: %w", err)
+	}
+	columns, err := newColumnMap(header)
+	if err != nil {
+		return err
+	}
+	for consumer.CanConsume() {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return err
+			}
+			consumer.Consume(Record{Row: parseErr.Line, Err: err})
+			continue
+		}
+		row, _ := csvReader.FieldPos(0)
+		entry, err := columns.toEntry(record, loc)
+		consumer.Consume(Record{Row: row, Entry: entry, Err: err})
+	}
+	return nil
+}
+
+type columnMap struct {
+	timestamp   int
+	download    int
+	upload      int
+	ping        int
+	jitter      int
+	loss        int
+	status      int
+	probe       int
+	bytesPerSec bool
+}
+
+func newColumnMap(header []string) (*columnMap, error) {
+	indexes := make(map[string]int, len(header))
+	for i, name := range header {
+		indexes[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	find := func(names []string) int {
+		for _, name := range names {
+			if idx, ok := indexes[name]; ok {
+				return idx
+			}
+		}
+		return -1
+	}
+	result := &columnMap{
+		timestamp: find(kTimestampColumns),
+		download:  find(kDownloadColumns),
+		upload:    find(kUploadColumns),
+		ping:      find(kPingColumns),
+		jitter:    find(kJitterColumns),
+		loss:      find(kLossColumns),
+		status:    find(kStatusColumns),
+		probe:     find(kProbeColumns),
+	}
+	if result.download == -1 && result.upload == -1 {
+		result.download = find([]string{kOoklaDownloadColumn})
+		result.upload = find([]string{kOoklaUploadColumn})
+		result.bytesPerSec = true
+	}
+	if result.timestamp == -1 {
+		return nil, errors.New("missing timestamp column")
+	}
+	if result.download == -1 || result.upload == -1 {
+		return nil, errors.New("missing download or upload column")
+	}
+	return result, nil
+}
+
+func (c *columnMap) toEntry(
+	record []string, loc *time.Location) (stl.Entry, error) {
+	get := func(idx int) string {
+		if idx == -1 || idx >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[idx])
+	}
+	entry := stl.Entry{Probe: get(c.probe)}
+	var err error
+	if entry.Ts, err = parseTimestamp(get(c.timestamp), loc); err != nil {
+		return stl.Entry{}, err
+	}
+	if entry.DownloadMbps, err = parseFloat(get(c.download), true); err != nil {
+		return stl.Entry{}, err
+	}
+	if entry.UploadMbps, err = parseFloat(get(c.upload), true); err != nil {
+		return stl.Entry{}, err
+	}
+	if c.bytesPerSec {
+		entry.DownloadMbps = ookla.Mbps(entry.DownloadMbps)
+		entry.UploadMbps = ookla.Mbps(entry.UploadMbps)
+	}
+	if entry.PingMs, err = parseOptionalFloat(
+		get(c.ping), stl.MeasureLatency, &entry.Unmeasured); err != nil {
+		return stl.Entry{}, err
+	}
+	if entry.JitterMs, err = parseOptionalFloat(
+		get(c.jitter), stl.MeasureJitter, &entry.Unmeasured); err != nil {
+		return stl.Entry{}, err
+	}
+	if entry.PacketLossPercent, err = parseOptionalFloat(
+		get(c.loss), stl.MeasurePacketLoss, &entry.Unmeasured); err != nil {
+		return stl.Entry{}, err
+	}
+	if entry.Status, err = parseStatus(get(c.status)); err != nil {
+		return stl.Entry{}, err
+	}
+	return entry, validate(&entry)
+}
+
+// parseTimestamp parses an RFC 3339 timestamp, seconds since the epoch,
+// or a local timestamp in loc.
+func parseTimestamp(s string, loc *time.Location) (int64, error) {
+	if s == "" {
+		return 0, errors.New("missing timestamp")
+	}
+	if seconds, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return seconds, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.Unix(), nil
+	}
+	for _, layout := range kTimestampFormats {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t.Unix(), nil
+		}
+	}
+	return 0, fmt.Errorf("bad timestamp: %q", s)
+}
+
+func parseFloat(s string, required bool) (float64, error) {
+	if s == "" || s == "N/A" {
+		if required {
+			return 0.0, errors.New("missing speed")
+		}
+		return 0.0, nil
+	}
+	result, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0.0, fmt.Errorf("bad number: %q", s)
+	}
+	return result, nil
+}
+
+// parseOptionalFloat works like parseFloat for a value that need not be
+// present. If s is empty or N/A, parseOptionalFloat returns 0 and adds
+// measurement to unmeasured.
+func parseOptionalFloat(
+	s string,
+	measurement stl.Measurement,
+	unmeasured *stl.Measurement) (float64, error) {
+	if s == "" || s == "N/A" {
+		*unmeasured |= measurement
+		return 0.0, nil
+	}
+	return parseFloat(s, false)
+}
+
+// parseStatus parses a status name. An empty name means the status should
+// be inferred from the speeds as stl.Entry.IsOutage does.
+func parseStatus(s string) (stl.Status, error) {
+	if s == "" {
+		return stl.StatusOk, nil
+	}
+	status, ok := stl.ParseStatus(s)
+	if !ok {
+		return stl.StatusOk, fmt.Errorf("bad status: %q", s)
+	}
+	return status, nil
+}
+
+func validate(entry *stl.Entry) error {
+	if entry.DownloadMbps < 0 || entry.UploadMbps < 0 {
+		return errors.New("negative speed")
+	}
+	if entry.PingMs < 0 || entry.JitterMs < 0 {
+		return errors.New("negative latency")
+	}
+	if entry.PacketLossPercent < 0 || entry.PacketLossPercent > 100 {
+		return fmt.Errorf("packet loss out of range: %v", entry.PacketLossPercent)
+	}
+	if entry.Retransmits < 0 {
+		return errors.New("negative retransmits")
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+package ingest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/speedtestlogger/stl"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+
+	// What entries with no latency columns did not measure
+	kNoLatency = stl.MeasureLatency |
+		stl.MeasureJitter |
+		stl.MeasurePacketLoss
+)
+
+func TestReadCSV(t *testing.T) {
+	input := `timestamp,download_mbps,upload_mbps,ping_ms,jitter_ms,packet_loss_percent,status
+2025-08-12T06:13:38-04:00,100.5,10.25,12.5,1.5,0,ok
+2025-08-12 07:00:00,0,0,,,,outage
+1755000000,50,5,,,,
+bad,50,5,,,,
+1755000000,-50,5,,,,
+1755000000,50,5,,,,unknown
+`
+	records := readAll(t, input)
+	assert.Len(t, records, 6)
+	assert.Equal(
+		t,
+		Record{
+			Row: 2,
+			Entry: stl.Entry{
+				Ts:           1754993618,
+				DownloadMbps: 100.5,
+				UploadMbps:   10.25,
+				PingMs:       12.5,
+				JitterMs:     1.5,
+			},
+		},
+		records[0])
+	assert.Equal(
+		t,
+		Record{
+			Row: 3,
+			Entry: stl.Entry{
+				Ts:         1754996400,
+				Status:     stl.StatusOutage,
+				Unmeasured: kNoLatency,
+			},
+		},
+		records[1])
+	assert.Equal(
+		t,
+		Record{
+			Row: 4,
+			Entry: stl.Entry{
+				Ts:           1755000000,
+				DownloadMbps: 50,
+				UploadMbps:   5,
+				Unmeasured:   kNoLatency,
+			},
+		},
+		records[2])
+	assert.Equal(t, 5, records[3].Row)
+	assert.Error(t, records[3].Err)
+	assert.Error(t, records[4].Err)
+	assert.Error(t, records[5].Err)
+}
+
+func TestReadOoklaTSV(t *testing.T) {
+	input := "timestamp\tserver name\tdownload\tupload\tidle latency\n" +
+		"1755000000\tExample\t12500000\t1250000\t9.5\n"
+	records := readAll(t, input)
+	assert.Equal(
+		t,
+		[]Record{
+			{
+				Row: 2,
+				Entry: stl.Entry{
+					Ts:           1755000000,
+					DownloadMbps: 100.0,
+					UploadMbps:   10.0,
+					PingMs:       9.5,
+					Unmeasured:   stl.MeasureJitter | stl.MeasurePacketLoss,
+				},
+			},
+		},
+		records)
+}
+
+func TestReadCSVMissingColumns(t *testing.T) {
+	err := Read(
+		strings.NewReader("download_mbps,upload_mbps\n1,2\n"),
+		time.UTC,
+		consume2.Nil[Record]())
+	assert.ErrorContains(t, err, "timestamp")
+}
+
+func TestReadJSON(t *testing.T) {
+	input := `{"type":"log","timestamp":"2025-08-12T10:13:30Z","message":"hi","level":"info"}
+{"type":"result","timestamp":"2025-08-12T10:13:38Z","ping":{"jitter":1.25,"latency":12.5},"download":{"bandwidth":12500000},"upload":{"bandwidth":1250000}}
+{"ts":"2025-08-12T06:13:38-04:00","downloadMbps":80,"uploadMbps":8,"status":"partial"}
+[{"ts":1755000000,"downloadMbps":70,"uploadMbps":7},{"ts":1755000001}]
+`
+	records := readAll(t, input)
+	assert.Len(t, records, 4)
+	assert.Equal(
+		t,
+		Record{
+			Row: 1,
+			Entry: stl.Entry{
+				Ts:           1754993618,
+				DownloadMbps: 100.0,
+				UploadMbps:   10.0,
+				PingMs:       12.5,
+				JitterMs:     1.25,
+				Unmeasured:   stl.MeasurePacketLoss,
+			},
+		},
+		records[0])
+	assert.Equal(
+		t,
+		Record{
+			Row: 2,
+			Entry: stl.Entry{
+				Ts:           1754993618,
+				DownloadMbps: 80.0,
+				UploadMbps:   8.0,
+				Status:       stl.StatusPartial,
+				Unmeasured:   kNoLatency,
+			},
+		},
+		records[1])
+	assert.Equal(
+		t,
+		Record{
+			Row: 3,
+			Entry: stl.Entry{
+				Ts:           1755000000,
+				DownloadMbps: 70,
+				UploadMbps:   7,
+				Unmeasured:   kNoLatency,
+			},
+		},
+		records[2])
+	assert.Equal(t, 4, records[3].Row)
+	assert.Error(t, records[3].Err)
+}
+
+func TestReadProbe(t *testing.T) {
+	records := readAll(t, `timestamp,download_mbps,upload_mbps,probe
+1755000000,50,5,office
+1755000001,60,6,
+`)
+	assert.Len(t, records, 2)
+	assert.Equal(t, "office", records[0].Entry.Probe)
+	assert.Equal(t, "", records[1].Entry.Probe)
+
+	records = readAll(
+		t, `{"ts":1755000000,"downloadMbps":70,"uploadMbps":7,"probe":"home"}`)
+	assert.Len(t, records, 1)
+	assert.Equal(t, "home", records[0].Entry.Probe)
+}
+
+func TestReadIperfJSON(t *testing.T) {
+	input := `{"start":{"timestamp":{"timesecs":1755007200},"test_start":{"protocol":"TCP","reverse":1}},"end":{"sum_sent":{"bits_per_second":500000000,"retransmits":4},"sum_received":{"bits_per_second":490000000}}}
+{"ts":1755000000,"downloadMbps":70,"uploadMbps":7,"retransmits":2}
+{"start":{"timestamp":{"timesecs":0}},"end":{},"error":"unable to connect to server"}
+`
+	records := readAll(t, input)
+	assert.Len(t, records, 3)
+	assert.Equal(
+		t,
+		Record{
+			Row: 1,
+			Entry: stl.Entry{
+				Ts:           1755007200,
+				DownloadMbps: 490.0,
+				Retransmits:  4,
+				Unmeasured:   kNoLatency | stl.MeasureUpload,
+			},
+		},
+		records[0])
+	assert.Equal(
+		t,
+		Record{
+			Row: 2,
+			Entry: stl.Entry{
+				Ts:           1755000000,
+				DownloadMbps: 70,
+				UploadMbps:   7,
+				Retransmits:  2,
+				Unmeasured:   kNoLatency,
+			},
+		},
+		records[1])
+	assert.Error(t, records[2].Err)
+}
+
+func TestReadMalformedJSON(t *testing.T) {
+	var records []Record
+	err := Read(
+		strings.NewReader(`{"ts":1,"downloadMbps":1,"uploadMbps":1} {"ts":`),
+		time.UTC,
+		consume2.AppendTo(&records))
+	assert.Error(t, err)
+	assert.Len(t, records, 1)
+}
+
+func TestReadMalformedLine(t *testing.T) {
+	input := `{"ts":1755000000,"downloadMbps":70,"uploadMbps":7}
+{"ts":1755000001,"downl
+[{"ts":1755000002,"downloadMbps":80,"uploadMbps":8}]
+{"ts":1755000003,"downloadMbps":90,"uploadMbps":9}`
+	records := readAll(t, input)
+	if assert.Len(t, records, 4) {
+		assert.NoError(t, records[0].Err)
+		assert.Equal(t, 2, records[1].Row)
+		assert.Error(t, records[1].Err)
+		assert.Equal(
+			t,
+			Record{
+				Row: 3,
+				Entry: stl.Entry{
+					Ts:           1755000002,
+					DownloadMbps: 80,
+					UploadMbps:   8,
+					Unmeasured:   kNoLatency,
+				},
+			},
+			records[2])
+		assert.Equal(
+			t,
+			Record{
+				Row: 4,
+				Entry: stl.Entry{
+					Ts:           1755000003,
+					DownloadMbps: 90,
+					UploadMbps:   9,
+					Unmeasured:   kNoLatency,
+				},
+			},
+			records[3])
+	}
+}
+
+func TestReadPrettyJSON(t *testing.T) {
+	input := `{
+  "ts": 1755000000,
+  "downloadMbps": 70,
+  "uploadMbps": 7
+}
+{
+  "ts": 1755000001,
+  "downloadMbps": 80,
+  "uploadMbps": 8
+}
+`
+	records := readAll(t, input)
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, int64(1755000001), records[1].Entry.Ts)
+		assert.NoError(t, records[1].Err)
+	}
+}
+
+func readAll(t *testing.T, input string) []Record {
+	t.Helper()
+	loc, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+	var records []Record
+	assert.NoError(
+		t, Read(strings.NewReader(input), loc, consume2.AppendTo(&records)))
+	return records
+}
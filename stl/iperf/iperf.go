@@ -0,0 +1,331 @@
+// Package iperf parses the output of iperf3 -J.
+package iperf
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/keep94/speedtestlogger/stl"
+)
+
+const (
+	kMillionFloat = 1000000.0
+)
+
+var (
+	kTimeoutMessages = []string{
+		"timeout",
+		"timed out",
+	}
+	kToolErrorMessages = []string{
+		"connection refused",
+		"server is busy",
+		"parameter",
+		"unrecognized option",
+		"permission denied",
+	}
+)
+
+// Transfer represents data sent in one direction.
+type Transfer struct {
+
+	// Rate at which the sender sent data in bits per second
+	SentBitsPerSecond float64
+
+	// Rate at which the receiver received data in bits per second
+	ReceivedBitsPerSecond float64
+
+	// TCP retransmits by the sender. Always 0 for UDP.
+	Retransmits int64
+
+	// UDP jitter in milliseconds. Always 0 for TCP.
+	JitterMs float64
+
+	// UDP packets lost. Always 0 for TCP.
+	LostPackets int64
+
+	// UDP packets sent. Always 0 for TCP.
+	Packets int64
+}
+
+// ReceivedMbps returns the rate at which the receiver received data in
+// megabits per second.
+func (t *Transfer) ReceivedMbps() float64 {
+	return t.ReceivedBitsPerSecond / kMillionFloat
+}
+
+// Result represents a single iperf3 run.
+type Result struct {
+
+	// When the test ran.
+	Timestamp time.Time
+
+	// "TCP" or "UDP"
+	Protocol string
+
+	// True if the run used -R so that the server sent to the client.
+	Reverse bool
+
+	// True if the run used --bidir so that data went both ways.
+	Bidir bool
+
+	// Data sent from server to client. nil if not measured.
+	Download *Transfer
+
+	// Data sent from client to server. nil if not measured.
+	Upload *Transfer
+
+	// The error iperf3 reported. If non empty, the run failed, and
+	// Download and Upload are nil.
+	Error string
+}
+
+// Status returns the status of this run. A run that measures only one
+// direction has StatusOk if data got through in that direction. A
+// bidirectional run where data got through in only one direction has
+// StatusPartial.
+func (r *Result) Status() stl.Status {
+	if r.Error != "" {
+		return classifyError(r.Error)
+	}
+	var measured, succeeded int
+	for _, transfer := range []*Transfer{r.Download, r.Upload} {
+		if transfer == nil {
+			continue
+		}
+		measured++
+		if transfer.ReceivedBitsPerSecond > 0 {
+			succeeded++
+		}
+	}
+	switch succeeded {
+	case 0:
+		return stl.StatusOutage
+	case measured:
+		return stl.StatusOk
+	default:
+		return stl.StatusPartial
+	}
+}
+
+// Unmeasured returns what this run did not measure: latency, the
+// direction a one-way run did not measure, and jitter and packet loss for
+// TCP runs. A failed run measured nothing, but its status already says
+// so, so Unmeasured returns 0 for failed runs.
+func (r *Result) Unmeasured() stl.Measurement {
+	if r.Error != "" {
+		return 0
+	}
+	result := stl.MeasureLatency
+	if r.Protocol != "UDP" {
+		result |= stl.MeasureJitter | stl.MeasurePacketLoss
+	}
+	if r.Download == nil {
+		result |= stl.MeasureDownload
+	}
+	if r.Upload == nil {
+		result |= stl.MeasureUpload
+	}
+	return result
+}
+
+// Entry converts this result to an stl.Entry with timestamp ts. Speeds
+// are what the receiver received. Retransmits, jitter, and packet loss
+// are combined across both directions. What the run did not measure,
+// including latency which iperf3 never measures, is recorded in
+// Unmeasured.
+func (r *Result) Entry(ts int64) stl.Entry {
+	entry := stl.Entry{
+		Ts: ts, Status: r.Status(), Unmeasured: r.Unmeasured()}
+	var jitterMs float64
+	var lost, packets int64
+	var transfers int
+	for _, transfer := range []*Transfer{r.Download, r.Upload} {
+		if transfer == nil {
+			continue
+		}
+		transfers++
+		entry.Retransmits += transfer.Retransmits
+		jitterMs += transfer.JitterMs
+		lost += transfer.LostPackets
+		packets += transfer.Packets
+	}
+	if r.Download != nil {
+		entry.DownloadMbps = r.Download.ReceivedMbps()
+	}
+	if r.Upload != nil {
+		entry.UploadMbps = r.Upload.ReceivedMbps()
+	}
+	if transfers > 0 {
+		entry.JitterMs = jitterMs / float64(transfers)
+	}
+	if packets > 0 {
+		entry.PacketLossPercent = 100.0 * float64(lost) / float64(packets)
+	}
+	return entry
+}
+
+// IsResult returns true if doc looks like the output of iperf3 -J.
+func IsResult(doc json.RawMessage) bool {
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(doc, &keys); err != nil {
+		return false
+	}
+	_, start := keys["start"]
+	_, end := keys["end"]
+	return start && end
+}
+
+// ParseJSON parses the output of iperf3 -J for either TCP or UDP tests.
+// If iperf3 reported an error, ParseJSON returns a Result with the Error
+// field set rather than an error. ParseJSON returns an error if the
+// output is malformed or if it has neither an error nor a result.
+func ParseJSON(r io.Reader) (*Result, error) {
+	var doc jsonDocument
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("iperf: malformed json: %w", err)
+	}
+	return doc.toResult()
+}
+
+type jsonDocument struct {
+	Start struct {
+		Timestamp struct {
+			Timesecs int64 `json:"timesecs"`
+		} `json:"timestamp"`
+		TestStart struct {
+			Protocol string `json:"protocol"`
+			Reverse  int    `json:"reverse"`
+			Bidir    int    `json:"bidir"`
+		} `json:"test_start"`
+	} `json:"start"`
+	End struct {
+		Sum                     *jsonSum `json:"sum"`
+		SumSent                 *jsonSum `json:"sum_sent"`
+		SumReceived             *jsonSum `json:"sum_received"`
+		SumBidirReverse         *jsonSum `json:"sum_bidir_reverse"`
+		SumSentBidirReverse     *jsonSum `json:"sum_sent_bidir_reverse"`
+		SumReceivedBidirReverse *jsonSum `json:"sum_received_bidir_reverse"`
+	} `json:"end"`
+	Error string `json:"error"`
+}
+
+type jsonSum struct {
+	BitsPerSecond float64 `json:"bits_per_second"`
+	Retransmits   int64   `json:"retransmits"`
+	JitterMs      float64 `json:"jitter_ms"`
+	LostPackets   int64   `json:"lost_packets"`
+	Packets       int64   `json:"packets"`
+}
+
+func (d *jsonDocument) toResult() (*Result, error) {
+	result := &Result{
+		Timestamp: time.Unix(d.Start.Timestamp.Timesecs, 0).UTC(),
+		Protocol:  strings.ToUpper(d.Start.TestStart.Protocol),
+		Reverse:   d.Start.TestStart.Reverse != 0,
+		Bidir:     d.Start.TestStart.Bidir != 0,
+		Error:     d.Error,
+	}
+	if result.Error != "" {
+		return result, nil
+	}
+	end := &d.End
+	forward, err := toTransfer(
+		result.Protocol, end.Sum, end.SumSent, end.SumReceived)
+	if err != nil {
+		return nil, err
+	}
+	if forward == nil {
+		return nil, errors.New("iperf: no result in json")
+	}
+	var backward *Transfer
+	if result.Bidir {
+		backward, err = toTransfer(
+			result.Protocol,
+			end.SumBidirReverse,
+			end.SumSentBidirReverse,
+			end.SumReceivedBidirReverse)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Without -R, the client sends in the forward direction.
+	if result.Reverse {
+		result.Download, result.Upload = forward, backward
+	} else {
+		result.Upload, result.Download = forward, backward
+	}
+	return result, nil
+}
+
+// toTransfer converts the summaries of one direction to a Transfer.
+// TCP tests report sent and received summaries. UDP tests report a
+// summary with jitter and loss and, in newer versions of iperf3, sent
+// and received summaries too. toTransfer returns nil if there are no
+// summaries.
+func toTransfer(protocol string, sum, sent, received *jsonSum) (
+	*Transfer, error) {
+	if sum == nil && sent == nil && received == nil {
+		return nil, nil
+	}
+	if sent == nil {
+		sent = sum
+	}
+	if received == nil {
+		received = sum
+	}
+	if sent == nil || received == nil {
+		return nil, errors.New("iperf: result missing sent or received summary")
+	}
+	result := &Transfer{
+		SentBitsPerSecond:     sent.BitsPerSecond,
+		ReceivedBitsPerSecond: received.BitsPerSecond,
+	}
+	if protocol == "UDP" {
+		stats := sum
+		if stats == nil {
+			stats = received
+		}
+		result.JitterMs = stats.JitterMs
+		result.LostPackets = stats.LostPackets
+		result.Packets = stats.Packets
+	} else {
+		result.Retransmits = sent.Retransmits
+	}
+	if result.SentBitsPerSecond < 0 || result.ReceivedBitsPerSecond < 0 {
+		return nil, errors.New("iperf: negative bandwidth")
+	}
+	if result.Retransmits < 0 {
+		return nil, errors.New("iperf: negative retransmits")
+	}
+	if result.LostPackets < 0 || result.LostPackets > result.Packets {
+		return nil, fmt.Errorf(
+			"iperf: lost packets out of range: %d", result.LostPackets)
+	}
+	return result, nil
+}
+
+func classifyError(message string) stl.Status {
+	message = strings.ToLower(message)
+	if containsAny(message, kTimeoutMessages) {
+		return stl.StatusTimeout
+	}
+	if containsAny(message, kToolErrorMessages) {
+		return stl.StatusToolError
+	}
+	return stl.StatusOutage
+}
+
+func containsAny(s string, substrs []string) bool {
+	for _, substr := range substrs {
+		if strings.Contains(s, substr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+package iperf
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keep94/speedtestlogger/stl"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	kTCPResult = `{"start":{"version":"iperf 3.9","timestamp":{"time":"Tue, 12 Aug 2025 14:00:00 GMT","timesecs":1755007200},"test_start":{"protocol":"TCP","num_streams":1,"blksize":131072,"omit":0,"duration":10,"bytes":0,"blocks":0,"reverse":0,"tos":0}},"intervals":[],"end":{"streams":[],"sum_sent":{"start":0,"end":10,"seconds":10,"bytes":1180000000,"bits_per_second":944000000,"retransmits":12,"sender":true},"sum_received":{"start":0,"end":10,"seconds":10,"bytes":1175000000,"bits_per_second":940000000,"sender":true}}}`
+
+	kTCPReverseResult = `{"start":{"timestamp":{"timesecs":1755007200},"test_start":{"protocol":"TCP","reverse":1}},"end":{"sum_sent":{"bits_per_second":500000000,"retransmits":4,"sender":false},"sum_received":{"bits_per_second":490000000,"sender":false}}}`
+
+	kUDPResult = `{"start":{"timestamp":{"timesecs":1755007200},"test_start":{"protocol":"UDP","reverse":0}},"end":{"sum":{"start":0,"end":10,"seconds":10,"bytes":13107200,"bits_per_second":10485760,"jitter_ms":0.25,"lost_packets":9,"packets":900,"lost_percent":1,"sender":true}}}`
+
+	kUDPNewResult = `{"start":{"timestamp":{"timesecs":1755007200},"test_start":{"protocol":"UDP","reverse":1}},"end":{"sum":{"bits_per_second":10000000,"jitter_ms":0.5,"lost_packets":50,"packets":1000,"sender":false},"sum_sent":{"bits_per_second":10000000,"jitter_ms":0,"lost_packets":0,"packets":1000},"sum_received":{"bits_per_second":9500000,"jitter_ms":0.5,"lost_packets":50,"packets":1000}}}`
+
+	kBidirResult = `{"start":{"timestamp":{"timesecs":1755007200},"test_start":{"protocol":"TCP","reverse":0,"bidir":1}},"end":{"sum_sent":{"bits_per_second":200000000,"retransmits":2},"sum_received":{"bits_per_second":190000000},"sum_sent_bidir_reverse":{"bits_per_second":800000000,"retransmits":5},"sum_received_bidir_reverse":{"bits_per_second":780000000}}}`
+
+	kErrorResult = `{"start":{"connected":[],"version":"iperf 3.9","timestamp":{"timesecs":1755007200}},"intervals":[],"end":{},"error":"unable to connect to server: Connection refused"}`
+)
+
+const (
+
+	// What TCP runs do not measure
+	kTCPUnmeasured = stl.MeasureLatency |
+		stl.MeasureJitter |
+		stl.MeasurePacketLoss
+)
+
+func TestParseTCP(t *testing.T) {
+	result, err := ParseJSON(strings.NewReader(kTCPResult))
+	assert.NoError(t, err)
+	assert.Equal(
+		t, time.Date(2025, 8, 12, 14, 0, 0, 0, time.UTC), result.Timestamp)
+	assert.Equal(t, "TCP", result.Protocol)
+	assert.False(t, result.Reverse)
+	assert.Nil(t, result.Download)
+	assert.Equal(
+		t,
+		&Transfer{
+			SentBitsPerSecond:     944000000,
+			ReceivedBitsPerSecond: 940000000,
+			Retransmits:           12,
+		},
+		result.Upload)
+	assert.Equal(
+		t,
+		stl.Entry{
+			Ts:          1234,
+			UploadMbps:  940.0,
+			Retransmits: 12,
+			Unmeasured:  kTCPUnmeasured | stl.MeasureDownload,
+		},
+		result.Entry(1234))
+}
+
+func TestParseTCPReverse(t *testing.T) {
+	result, err := ParseJSON(strings.NewReader(kTCPReverseResult))
+	assert.NoError(t, err)
+	assert.True(t, result.Reverse)
+	assert.Nil(t, result.Upload)
+	assert.Equal(
+		t,
+		stl.Entry{
+			Ts:           1234,
+			DownloadMbps: 490.0,
+			Retransmits:  4,
+			Unmeasured:   kTCPUnmeasured | stl.MeasureUpload,
+		},
+		result.Entry(1234))
+}
+
+func TestParseUDP(t *testing.T) {
+	result, err := ParseJSON(strings.NewReader(kUDPResult))
+	assert.NoError(t, err)
+	assert.Equal(t, "UDP", result.Protocol)
+	assert.Equal(
+		t,
+		&Transfer{
+			SentBitsPerSecond:     10485760,
+			ReceivedBitsPerSecond: 10485760,
+			JitterMs:              0.25,
+			LostPackets:           9,
+			Packets:               900,
+		},
+		result.Upload)
+	assert.Equal(
+		t,
+		stl.Entry{
+			Ts:                1234,
+			UploadMbps:        10.48576,
+			JitterMs:          0.25,
+			PacketLossPercent: 1.0,
+			Unmeasured:        stl.MeasureLatency | stl.MeasureDownload,
+		},
+		result.Entry(1234))
+
+	result, err = ParseJSON(strings.NewReader(kUDPNewResult))
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		stl.Entry{
+			Ts:                1234,
+			DownloadMbps:      9.5,
+			JitterMs:          0.5,
+			PacketLossPercent: 5.0,
+			Unmeasured:        stl.MeasureLatency | stl.MeasureUpload,
+		},
+		result.Entry(1234))
+}
+
+func TestParseBidir(t *testing.T) {
+	result, err := ParseJSON(strings.NewReader(kBidirResult))
+	assert.NoError(t, err)
+	assert.True(t, result.Bidir)
+	assert.Equal(
+		t,
+		stl.Entry{
+			Ts:           1234,
+			DownloadMbps: 780.0,
+			UploadMbps:   190.0,
+			Retransmits:  7,
+			Unmeasured:   kTCPUnmeasured,
+		},
+		result.Entry(1234))
+
+	// Data got through in only one direction
+	result.Download.ReceivedBitsPerSecond = 0
+	assert.Equal(t, stl.StatusPartial, result.Status())
+	assert.Equal(t, kTCPUnmeasured, result.Unmeasured())
+	result.Upload.ReceivedBitsPerSecond = 0
+	assert.Equal(t, stl.StatusOutage, result.Status())
+}
+
+func TestParseError(t *testing.T) {
+	result, err := ParseJSON(strings.NewReader(kErrorResult))
+	assert.NoError(t, err)
+	assert.Equal(
+		t, "unable to connect to server: Connection refused", result.Error)
+	assert.Equal(
+		t,
+		stl.Entry{Ts: 1234, Status: stl.StatusToolError},
+		result.Entry(1234))
+
+	result = &Result{Error: "unable to connect to server: No route to host"}
+	assert.Equal(t, stl.StatusOutage, result.Status())
+	result = &Result{Error: "control socket has closed unexpectedly: timed out"}
+	assert.Equal(t, stl.StatusTimeout, result.Status())
+}
+
+func TestParseBad(t *testing.T) {
+	_, err := ParseJSON(strings.NewReader(`{"start":{},"end":{}}`))
+	assert.Error(t, err)
+	_, err = ParseJSON(strings.NewReader(`{"start":`))
+	assert.Error(t, err)
+	_, err = ParseJSON(strings.NewReader(
+		`{"start":{"test_start":{"protocol":"UDP"}},"end":{"sum":{"bits_per_second":1,"lost_packets":5,"packets":2}}}`))
+	assert.Error(t, err)
+}
+
+func TestIsResult(t *testing.T) {
+	assert.True(t, IsResult([]byte(kTCPResult)))
+	assert.True(t, IsResult([]byte(kErrorResult)))
+	assert.False(t, IsResult([]byte(`{"type":"result"}`)))
+	assert.False(t, IsResult([]byte(`[1, 2]`)))
+}
@@ -1,12 +1,121 @@
 // Package stl provides the data structures for the speedtestlogger app
 package stl
 
+// Status is the outcome of a speed test run.
+type Status int
+
+const (
+
+	// The speed test succeeded.
+	StatusOk Status = iota
+
+	// The internet service was down.
+	StatusOutage
+
+	// The speed test tool failed for reasons other than an outage e.g it
+	// crashed or the test server refused the connection.
+	StatusToolError
+
+	// The speed test tool did not finish in time.
+	StatusTimeout
+
+	// The speed test measured only one of download or upload speed
+	// because measuring the other failed.
+	StatusPartial
+)
+
+var (
+	kStatusNames = []string{"ok", "outage", "tool-error", "timeout", "partial"}
+)
+
+// String returns the name of this status e.g "tool-error"
+func (s Status) String() string {
+	if s < 0 || int(s) >= len(kStatusNames) {
+		return "unknown"
+	}
+	return kStatusNames[s]
+}
+
+// ParseStatus converts a status name such as "timeout" to a Status.
+// ParseStatus returns false if name is not a valid status name.
+func ParseStatus(name string) (Status, bool) {
+	for i, statusName := range kStatusNames {
+		if statusName == name {
+			return Status(i), true
+		}
+	}
+	return StatusOk, false
+}
+
+// Measurement is a set of things that a speed test can measure.
+type Measurement int
+
+const (
+
+	// Download speed
+	MeasureDownload Measurement = 1 << iota
+
+	// Upload speed
+	MeasureUpload
+
+	// Packet loss
+	MeasurePacketLoss
+
+	// Ping latency
+	MeasureLatency
+
+	// Ping jitter
+	MeasureJitter
+)
+
+var (
+	kMeasurementNames = []string{
+		"download", "upload", "packet-loss", "latency", "jitter"}
+)
+
+// Names returns the names of the measurements in this set e.g
+// ["download", "upload"]. Names returns nil for the empty set.
+func (m Measurement) Names() []string {
+	var result []string
+	for i, name := range kMeasurementNames {
+		if m&(1<<i) != 0 {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// ParseMeasurement converts measurement names such as ["upload"] to a
+// Measurement. ParseMeasurement returns false if a name is not a valid
+// measurement name.
+func ParseMeasurement(names []string) (Measurement, bool) {
+	var result Measurement
+	for _, name := range names {
+		found := false
+		for i, measurementName := range kMeasurementNames {
+			if measurementName == name {
+				result |= 1 << i
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, false
+		}
+	}
+	return result, true
+}
+
 // Entry represents a speed test data point
 type Entry struct {
 
 	// Id of Entry
 	Id int64
 
+	// Identifies where the measurement was taken e.g "boston-office".
+	// Empty means the default probe.
+	Probe string
+
 	// Seconds since Jan 1 1970 GMT
 	Ts int64
 
@@ -15,4 +124,211 @@ type Entry struct {
 
 	// Upload speed in megabits per second
 	UploadMbps float64
+
+	// Ping latency in milliseconds. 0 if not measured; see HasLatency.
+	PingMs float64
+
+	// Ping jitter in milliseconds. 0 if not measured; see HasJitter.
+	JitterMs float64
+
+	// Packet loss percent 0 to 100. 0 if not measured; see HasPacketLoss.
+	PacketLossPercent float64
+
+	// TCP retransmits. 0 means none or not measured.
+	Retransmits int64
+
+	// The outcome of the speed test run
+	Status Status
+
+	// What the speed test run did not try to measure such as upload speed
+	// for a run that measured only download speed or packet loss that the
+	// speed test tool did not report. Values that were not measured are 0.
+	Unmeasured Measurement
+}
+
+// HasDownload returns true if this entry measured download speed.
+// Entries that have StatusPartial and 0 download speed did not measure
+// download speed.
+func (e *Entry) HasDownload() bool {
+	return e.Unmeasured&MeasureDownload == 0 &&
+		(e.Status != StatusPartial || e.DownloadMbps > 0.0)
+}
+
+// HasUpload returns true if this entry measured upload speed. Entries
+// that have StatusPartial and 0 upload speed did not measure upload
+// speed.
+func (e *Entry) HasUpload() bool {
+	return e.Unmeasured&MeasureUpload == 0 &&
+		(e.Status != StatusPartial || e.UploadMbps > 0.0)
+}
+
+// IsOutage returns true if this entry represents a lapse in service.
+// Entries that have StatusOk but 0 download and 0 upload speed also
+// count as outages as that is how outages were recorded before the Status
+// field existed.
+func (e *Entry) IsOutage() bool {
+	switch e.Status {
+	case StatusOutage:
+		return true
+	case StatusOk:
+		return e.DownloadMbps == 0.0 && e.UploadMbps == 0.0
+	default:
+		return false
+	}
+}
+
+// HasLatency returns true if this entry measured ping latency. Outages
+// and failed runs measure no latency.
+func (e *Entry) HasLatency() bool {
+	return e.Unmeasured&MeasureLatency == 0 && e.ran()
+}
+
+// HasJitter returns true if this entry measured jitter. Outages and
+// failed runs measure no jitter.
+func (e *Entry) HasJitter() bool {
+	return e.Unmeasured&MeasureJitter == 0 && e.ran()
+}
+
+// HasPacketLoss returns true if this entry measured packet loss. Outages
+// and failed runs measure no packet loss.
+func (e *Entry) HasPacketLoss() bool {
+	return e.Unmeasured&MeasurePacketLoss == 0 && e.ran()
+}
+
+// ran returns true if the speed test ran and got data through.
+func (e *Entry) ran() bool {
+	return (e.Status == StatusOk || e.Status == StatusPartial) &&
+		!e.IsOutage()
+}
+
+// Plan represents the internet plan that an ISP advertises.
+type Plan struct {
+
+	// Id of Plan
+	Id int64
+
+	// Name of plan e.g "Gigabit"
+	Name string
+
+	// Advertised download speed in megabits per second
+	DownloadMbps float64
+
+	// Advertised upload speed in megabits per second. 0 means not
+	// advertised.
+	UploadMbps float64
+
+	// Seconds since Jan 1 1970 GMT when this plan took effect. A plan stays
+	// in effect until the next plan takes effect.
+	Effective int64
+}
+
+// Plans is a list of plans ordered from most recently effective to least
+// recently effective.
+type Plans []Plan
+
+// At returns the plan in effect at ts, seconds since Jan 1 1970 GMT.
+// At returns false if no plan was in effect at ts.
+func (p Plans) At(ts int64) (Plan, bool) {
+	for _, plan := range p {
+		if plan.Effective <= ts {
+			return plan, true
+		}
+	}
+	return Plan{}, false
+}
+
+// Stats summarises a set of values such as download speeds.
+type Stats struct {
+
+	// Number of values
+	N int64
+
+	// Sum of the values
+	Sum float64
+
+	// Sum of the squares of the values
+	SumSquares float64
+
+	// Smallest value. Meaningless if N is 0.
+	Min float64
+
+	// Largest value. Meaningless if N is 0.
+	Max float64
+}
+
+// DaySummary summarises the entries of one probe for one day so that the
+// entries can be deleted while their summary is kept. Failed test runs
+// are as in Entry.Status.
+type DaySummary struct {
+
+	// Id of DaySummary
+	Id int64
+
+	// The probe of the entries. Empty means the default probe.
+	Probe string
+
+	// The day as seconds since Jan 1 1970 GMT at midnight GMT of that day
+	// e.g 2025-08-12 is stored as the timestamp of 2025-08-12T00:00:00Z.
+	// The day itself is in the time zone the entries were summarised in.
+	Date int64
+
+	// Number of test runs other than failed runs.
+	Tests int64
+
+	// Number of test runs that were not outages.
+	UpTests int64
+
+	// Number of failed test runs.
+	FailedRuns int64
+
+	// Download and upload speeds in megabits per second.
+	DownloadMbps Stats
+	UploadMbps   Stats
+
+	// Number of test runs that measured latency and the sum of their ping
+	// in milliseconds.
+	LatencyTests int64
+	PingMsSum    float64
+
+	// Number of test runs that measured jitter and the sum of their jitter
+	// in milliseconds.
+	JitterTests int64
+	JitterMsSum float64
+
+	// Number of test runs that measured packet loss and the sum of their
+	// packet loss percents.
+	PacketLossTests      int64
+	PacketLossPercentSum float64
+
+	// Time weighted uptime and downtime in seconds.
+	UpSeconds   int64
+	DownSeconds int64
+
+	// Number of outages that started on this day.
+	Outages int64
+
+	// How long the longest outage lasted in seconds.
+	LongestOutageSeconds int64
+
+	// When the outage in progress at the earliest test run of the day
+	// started and ended in seconds since the epoch. The outage starts
+	// with that run. Both are 0 if that run was not an outage.
+	FirstOutageStart int64
+	FirstOutageEnd   int64
+
+	// Likewise for the outage in progress at the latest test run of the
+	// day. This outage can end on a later day. When it ends with the
+	// first outage of the next day, the two are the same outage.
+	LastOutageStart int64
+	LastOutageEnd   int64
+
+	// Number of test runs checked against the advertised download speed
+	// and how many of them met it. See aggregators.SLA. Only day
+	// summaries computed with an SLA have these.
+	DownloadPlanTests int64
+	DownloadPlanMet   int64
+
+	// Likewise for the advertised upload speed.
+	UploadPlanTests int64
+	UploadPlanMet   int64
 }
@@ -0,0 +1,67 @@
+package stl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatus(t *testing.T) {
+	assert.Equal(t, "tool-error", StatusToolError.String())
+	assert.Equal(t, "unknown", Status(99).String())
+	status, ok := ParseStatus("timeout")
+	assert.True(t, ok)
+	assert.Equal(t, StatusTimeout, status)
+	_, ok = ParseStatus("bad")
+	assert.False(t, ok)
+}
+
+func TestIsOutage(t *testing.T) {
+	assert.True(t, (&Entry{}).IsOutage())
+	assert.True(t, (&Entry{Status: StatusOutage}).IsOutage())
+	assert.False(t, (&Entry{DownloadMbps: 5.0}).IsOutage())
+	assert.False(t, (&Entry{Status: StatusToolError}).IsOutage())
+	assert.False(t, (&Entry{Status: StatusTimeout}).IsOutage())
+}
+
+func TestMeasurement(t *testing.T) {
+	assert.Equal(
+		t,
+		[]string{"download", "upload"},
+		(MeasureDownload | MeasureUpload).Names())
+	assert.Nil(t, Measurement(0).Names())
+	measurement, ok := ParseMeasurement([]string{"upload"})
+	assert.True(t, ok)
+	assert.Equal(t, MeasureUpload, measurement)
+	_, ok = ParseMeasurement([]string{"upload", "bad"})
+	assert.False(t, ok)
+}
+
+func TestHasDownloadUpload(t *testing.T) {
+	entry := Entry{DownloadMbps: 50.0, Unmeasured: MeasureUpload}
+	assert.True(t, entry.HasDownload())
+	assert.False(t, entry.HasUpload())
+	entry = Entry{UploadMbps: 5.0, Status: StatusPartial}
+	assert.False(t, entry.HasDownload())
+	assert.True(t, entry.HasUpload())
+}
+
+func TestPlansAt(t *testing.T) {
+	plans := Plans{
+		{Name: "fast", DownloadMbps: 500.0, Effective: 2000},
+		{Name: "slow", DownloadMbps: 100.0, Effective: 1000},
+	}
+	_, ok := plans.At(999)
+	assert.False(t, ok)
+	plan, ok := plans.At(1000)
+	assert.True(t, ok)
+	assert.Equal(t, "slow", plan.Name)
+	plan, ok = plans.At(1999)
+	assert.True(t, ok)
+	assert.Equal(t, "slow", plan.Name)
+	plan, ok = plans.At(2000)
+	assert.True(t, ok)
+	assert.Equal(t, "fast", plan.Name)
+	_, ok = Plans(nil).At(2000)
+	assert.False(t, ok)
+}
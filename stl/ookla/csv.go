@@ -0,0 +1,174 @@
+package ookla
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var (
+	// Column order of 'speedtest -f csv' when --output-header is not given.
+	kDefaultHeader = []string{
+		"server name",
+		"server id",
+		"latency",
+		"jitter",
+		"packet loss",
+		"download",
+		"upload",
+		"download bytes",
+		"upload bytes",
+		"share url",
+	}
+)
+
+// ParseCSV parses the output of 'speedtest -f csv' or 'speedtest -f tsv'.
+// comma is the field separator, ',' for csv or '\t' for tsv. If the
+// first row is a header row as produced by --output-header, ParseCSV maps
+// columns by name; otherwise it assumes the speedtest CLI's default column
+// order. ParseCSV returns an error if the download or upload column is
+// missing or cannot be parsed. Since the speedtest CLI does not include
+// a timestamp in csv output, the Timestamp field of the returned Result
+// is the zero value.
+func ParseCSV(r io.Reader, comma rune) (*Result, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	record, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("ookla: empty csv")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ookla: malformed csv: %w", err)
+	}
+	columns := newColumnMap(kDefaultHeader)
+	if isHeader(record) {
+		columns = newColumnMap(record)
+		record, err = reader.Read()
+		if err == io.EOF {
+			return nil, errors.New("ookla: csv has header but no data")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ookla: malformed csv: %w", err)
+		}
+	}
+	return columns.toResult(record)
+}
+
+// Parse parses the output of the speedtest CLI in json, csv, or tsv
+// format detecting the format from the content.
+func Parse(r io.Reader) (*Result, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	text := strings.TrimSpace(string(content))
+	if strings.HasPrefix(text, "{") {
+		return ParseJSON(strings.NewReader(text))
+	}
+	firstLine, _, _ := strings.Cut(text, "\n")
+	if strings.Contains(firstLine, "\t") {
+		return ParseCSV(strings.NewReader(text), '\t')
+	}
+	return ParseCSV(strings.NewReader(text), ',')
+}
+
+func isHeader(record []string) bool {
+	for _, field := range record {
+		if normalizeName(field) == "download" {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+type columnMap map[string]int
+
+func newColumnMap(header []string) columnMap {
+	result := make(columnMap, len(header))
+	for i, name := range header {
+		result[normalizeName(name)] = i
+	}
+	return result
+}
+
+// get returns the value of the first column found in names.
+func (c columnMap) get(record []string, names ...string) (string, bool) {
+	for _, name := range names {
+		idx, ok := c[name]
+		if ok && idx < len(record) {
+			return strings.TrimSpace(record[idx]), true
+		}
+	}
+	return "", false
+}
+
+func (c columnMap) requiredInt(
+	record []string, name string) (int64, error) {
+	str, ok := c.get(record, name)
+	if !ok {
+		return 0, fmt.Errorf("ookla: csv missing %s column", name)
+	}
+	value, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, fmt.Errorf("ookla: bad %s value: %q", name, str)
+	}
+	return int64(value), nil
+}
+
+func (c columnMap) optionalFloat(
+	record []string, names ...string) (float64, bool, error) {
+	str, ok := c.get(record, names...)
+	if !ok || str == "" || str == "N/A" {
+		return 0.0, false, nil
+	}
+	value, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0.0, false, fmt.Errorf("ookla: bad %s value: %q", names[0], str)
+	}
+	return value, true, nil
+}
+
+func (c columnMap) toResult(record []string) (*Result, error) {
+	var result Result
+	var err error
+	result.DownloadBandwidth, err = c.requiredInt(record, "download")
+	if err != nil {
+		return nil, err
+	}
+	result.UploadBandwidth, err = c.requiredInt(record, "upload")
+	if err != nil {
+		return nil, err
+	}
+	result.PingLatencyMs, _, err = c.optionalFloat(
+		record, "idle latency", "latency")
+	if err != nil {
+		return nil, err
+	}
+	result.PingJitterMs, _, err = c.optionalFloat(
+		record, "idle jitter", "jitter")
+	if err != nil {
+		return nil, err
+	}
+	result.PacketLoss, result.PacketLossReported, err = c.optionalFloat(
+		record, "packet loss")
+	if err != nil {
+		return nil, err
+	}
+	result.Server.Name, _ = c.get(record, "server name")
+	if idStr, ok := c.get(record, "server id"); ok {
+		result.Server.Id, _ = strconv.ParseInt(idStr, 10, 64)
+	}
+	result.ResultURL, _ = c.get(record, "share url")
+	if err := result.validate(); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,67 @@
+package ookla
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCSVNoHeader(t *testing.T) {
+	input := `"Example - Boston, MA","1234","12.5","1.25","0","12500000","1250000","150000000","15000000","https://www.speedtest.net/result/c/abc"`
+	result, err := ParseCSV(strings.NewReader(input), ',')
+	assert.NoError(t, err)
+	assert.Equal(t, "Example - Boston, MA", result.Server.Name)
+	assert.Equal(t, int64(1234), result.Server.Id)
+	assert.Equal(t, 100.0, result.DownloadMbps())
+	assert.Equal(t, 10.0, result.UploadMbps())
+	assert.Equal(t, 12.5, result.PingLatencyMs)
+	assert.Equal(t, 1.25, result.PingJitterMs)
+	assert.True(t, result.PacketLossReported)
+	assert.Equal(t, 0.0, result.PacketLoss)
+	assert.True(t, result.Timestamp.IsZero())
+}
+
+func TestParseCSVHeader(t *testing.T) {
+	input := `"download","upload","server name","idle latency","idle jitter","packet loss"
+"12500000","2500000","Example","9.5","0.75","N/A"`
+	result, err := ParseCSV(strings.NewReader(input), ',')
+	assert.NoError(t, err)
+	assert.Equal(t, 100.0, result.DownloadMbps())
+	assert.Equal(t, 20.0, result.UploadMbps())
+	assert.Equal(t, 9.5, result.PingLatencyMs)
+	assert.Equal(t, 0.75, result.PingJitterMs)
+	assert.False(t, result.PacketLossReported)
+}
+
+func TestParseCSVErrors(t *testing.T) {
+	_, err := ParseCSV(strings.NewReader(""), ',')
+	assert.Error(t, err)
+	_, err = ParseCSV(strings.NewReader(`"server name","download"
+"Example","12500000"`), ',')
+	assert.ErrorContains(t, err, "upload")
+	_, err = ParseCSV(strings.NewReader(`"download","upload"`), ',')
+	assert.Error(t, err)
+	_, err = ParseCSV(strings.NewReader(`"a","b","c"`), ',')
+	assert.ErrorContains(t, err, "download")
+	_, err = ParseCSV(strings.NewReader(`"download","upload"
+"fast","slow"`), ',')
+	assert.ErrorContains(t, err, "download")
+}
+
+func TestParse(t *testing.T) {
+	result, err := Parse(strings.NewReader("\n  " + kJSONResult))
+	assert.NoError(t, err)
+	assert.Equal(t, "Comcast Cable", result.ISP)
+
+	result, err = Parse(strings.NewReader(
+		"server name\tdownload\tupload\nExample\t12500000\t1250000\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Example", result.Server.Name)
+	assert.Equal(t, 10.0, result.UploadMbps())
+
+	result, err = Parse(strings.NewReader(
+		`"Example","1234","12.5","1.25","0","12500000","1250000"`))
+	assert.NoError(t, err)
+	assert.Equal(t, 100.0, result.DownloadMbps())
+}
@@ -0,0 +1,187 @@
+// Package ookla parses the output of the Ookla speedtest CLI.
+package ookla
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	kMillionFloat = 1000000.0
+	kEightFloat   = 8.0
+)
+
+// Server represents the server the speed test ran against.
+type Server struct {
+	Id       int64
+	Name     string
+	Location string
+	Country  string
+	Host     string
+}
+
+// Result represents a single speedtest result.
+type Result struct {
+
+	// When the test ran.
+	Timestamp time.Time
+
+	// Download bandwidth in bytes per second
+	DownloadBandwidth int64
+
+	// Upload bandwidth in bytes per second
+	UploadBandwidth int64
+
+	// Ping latency in milliseconds
+	PingLatencyMs float64
+
+	// Ping jitter in milliseconds
+	PingJitterMs float64
+
+	// Packet loss percent 0 to 100. Only meaningful if PacketLossReported
+	// is true.
+	PacketLoss float64
+
+	// True if the speedtest CLI reported packet loss.
+	PacketLossReported bool
+
+	// The internet service provider
+	ISP string
+
+	// The server used for the test
+	Server Server
+
+	// The URL where the result can be viewed
+	ResultURL string
+}
+
+// DownloadMbps returns the download speed in megabits per second.
+func (r *Result) DownloadMbps() float64 {
+	return Mbps(float64(r.DownloadBandwidth))
+}
+
+// UploadMbps returns the upload speed in megabits per second.
+func (r *Result) UploadMbps() float64 {
+	return Mbps(float64(r.UploadBandwidth))
+}
+
+// Mbps converts bytes per second to megabits per second.
+func Mbps(bytesPerSecond float64) float64 {
+	return bytesPerSecond * kEightFloat / kMillionFloat
+}
+
+// ParseJSON parses the output of 'speedtest -f json'. The output may
+// contain log messages before the result document. ParseJSON returns an
+// error if the output is malformed, contains no result, or if the result
+// is missing required fields.
+func ParseJSON(r io.Reader) (*Result, error) {
+	decoder := json.NewDecoder(r)
+	var lastError string
+	for {
+		var doc jsonDocument
+		err := decoder.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ookla: malformed json: %w", err)
+		}
+		switch doc.Type {
+		case "result":
+			return doc.toResult()
+		case "log":
+			if doc.Level == "error" {
+				lastError = doc.Message
+			}
+		}
+	}
+	if lastError != "" {
+		return nil, fmt.Errorf("ookla: no result: %s", lastError)
+	}
+	return nil, errors.New("ookla: no result in json")
+}
+
+type jsonDocument struct {
+	Type      string `json:"type"`
+	Timestamp string `json:"timestamp"`
+	Level     string `json:"level"`
+	Message   string `json:"message"`
+	Ping      *struct {
+		Jitter  float64 `json:"jitter"`
+		Latency float64 `json:"latency"`
+	} `json:"ping"`
+	Download   *jsonTransfer `json:"download"`
+	Upload     *jsonTransfer `json:"upload"`
+	PacketLoss *float64      `json:"packetLoss"`
+	ISP        string        `json:"isp"`
+	Server     struct {
+		Id       int64  `json:"id"`
+		Name     string `json:"name"`
+		Location string `json:"location"`
+		Country  string `json:"country"`
+		Host     string `json:"host"`
+	} `json:"server"`
+	Result struct {
+		URL string `json:"url"`
+	} `json:"result"`
+}
+
+type jsonTransfer struct {
+	Bandwidth *int64 `json:"bandwidth"`
+}
+
+func (d *jsonDocument) toResult() (*Result, error) {
+	if d.Download == nil || d.Download.Bandwidth == nil {
+		return nil, errors.New("ookla: result missing download bandwidth")
+	}
+	if d.Upload == nil || d.Upload.Bandwidth == nil {
+		return nil, errors.New("ookla: result missing upload bandwidth")
+	}
+	if d.Ping == nil {
+		return nil, errors.New("ookla: result missing ping")
+	}
+	timestamp, err := time.Parse(time.RFC3339, d.Timestamp)
+	if err != nil {
+		return nil, fmt.Errorf("ookla: bad timestamp: %w", err)
+	}
+	result := &Result{
+		Timestamp:         timestamp,
+		DownloadBandwidth: *d.Download.Bandwidth,
+		UploadBandwidth:   *d.Upload.Bandwidth,
+		PingLatencyMs:     d.Ping.Latency,
+		PingJitterMs:      d.Ping.Jitter,
+		ISP:               d.ISP,
+		Server: Server{
+			Id:       d.Server.Id,
+			Name:     d.Server.Name,
+			Location: d.Server.Location,
+			Country:  d.Server.Country,
+			Host:     d.Server.Host,
+		},
+		ResultURL: d.Result.URL,
+	}
+	if d.PacketLoss != nil {
+		result.PacketLoss = *d.PacketLoss
+		result.PacketLossReported = true
+	}
+	if err := result.validate(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (r *Result) validate() error {
+	if r.DownloadBandwidth < 0 || r.UploadBandwidth < 0 {
+		return errors.New("ookla: negative bandwidth")
+	}
+	if r.PingLatencyMs < 0 || r.PingJitterMs < 0 {
+		return errors.New("ookla: negative ping")
+	}
+	if r.PacketLossReported && (r.PacketLoss < 0 || r.PacketLoss > 100) {
+		return fmt.Errorf("ookla: packet loss out of range: %v", r.PacketLoss)
+	}
+	return nil
+}
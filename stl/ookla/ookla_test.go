@@ -0,0 +1,57 @@
+package ookla
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	kJSONResult = `{"type":"result","timestamp":"2025-08-12T10:13:38Z","ping":{"jitter":1.25,"latency":12.5,"low":11.0,"high":15.0},"download":{"bandwidth":12500000,"bytes":150000000,"elapsed":12000},"upload":{"bandwidth":1250000,"bytes":15000000,"elapsed":10000},"packetLoss":0.5,"isp":"Comcast Cable","interface":{"internalIp":"192.168.1.10","name":"eth0","isVpn":false},"server":{"id":1234,"host":"speed.example.com","port":8080,"name":"Example","location":"Boston, MA","country":"United States","ip":"10.0.0.1"},"result":{"id":"abc","url":"https://www.speedtest.net/result/c/abc","persisted":true}}`
+)
+
+func TestParseJSON(t *testing.T) {
+	result, err := ParseJSON(strings.NewReader(kJSONResult))
+	assert.NoError(t, err)
+	assert.Equal(
+		t, time.Date(2025, 8, 12, 10, 13, 38, 0, time.UTC), result.Timestamp)
+	assert.Equal(t, int64(12500000), result.DownloadBandwidth)
+	assert.Equal(t, int64(1250000), result.UploadBandwidth)
+	assert.Equal(t, 100.0, result.DownloadMbps())
+	assert.Equal(t, 10.0, result.UploadMbps())
+	assert.Equal(t, 12.5, result.PingLatencyMs)
+	assert.Equal(t, 1.25, result.PingJitterMs)
+	assert.True(t, result.PacketLossReported)
+	assert.Equal(t, 0.5, result.PacketLoss)
+	assert.Equal(t, "Comcast Cable", result.ISP)
+	assert.Equal(t, int64(1234), result.Server.Id)
+	assert.Equal(t, "Boston, MA", result.Server.Location)
+	assert.Equal(t, "https://www.speedtest.net/result/c/abc", result.ResultURL)
+}
+
+func TestParseJSONSkipsLogs(t *testing.T) {
+	input := `{"type":"log","timestamp":"2025-08-12T10:13:30Z","message":"Configuration - Couldn't resolve host name","level":"warning"}
+` + strings.Replace(kJSONResult, `"packetLoss":0.5,`, "", 1)
+	result, err := ParseJSON(strings.NewReader(input))
+	assert.NoError(t, err)
+	assert.Equal(t, 100.0, result.DownloadMbps())
+	assert.False(t, result.PacketLossReported)
+}
+
+func TestParseJSONErrors(t *testing.T) {
+	_, err := ParseJSON(strings.NewReader(""))
+	assert.Error(t, err)
+	_, err = ParseJSON(strings.NewReader(`{"type":"result",`))
+	assert.Error(t, err)
+	_, err = ParseJSON(strings.NewReader(
+		`{"type":"log","timestamp":"2025-08-12T10:13:30Z","message":"Cannot read from socket","level":"error"}`))
+	assert.ErrorContains(t, err, "Cannot read from socket")
+	_, err = ParseJSON(strings.NewReader(
+		strings.Replace(kJSONResult, `"upload":{"bandwidth":1250000,`, `"upload":{`, 1)))
+	assert.ErrorContains(t, err, "upload")
+	_, err = ParseJSON(strings.NewReader(
+		strings.Replace(kJSONResult, `"packetLoss":0.5`, `"packetLoss":150`, 1)))
+	assert.Error(t, err)
+}
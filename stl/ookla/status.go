@@ -0,0 +1,101 @@
+package ookla
+
+import (
+	"strings"
+
+	"github.com/keep94/speedtestlogger/stl"
+)
+
+const (
+
+	// Exit code of the timeout(1) command when the command times out.
+	kTimeoutExitCode = 124
+
+	// Exit codes of the shell when a command can't be found or run.
+	kCannotExecuteExitCode = 126
+	kNotFoundExitCode      = 127
+)
+
+var (
+	kTimeoutMessages = []string{
+		"timeout",
+		"timed out",
+	}
+	kToolErrorMessages = []string{
+		"couldn't resolve host",
+		"hostnotfoundexception",
+		"connection refused",
+		"limit reached",
+		"license",
+		"segmentation fault",
+		"permission denied",
+		"command not found",
+	}
+)
+
+// Status returns the status of a successful speedtest run.
+func (r *Result) Status() stl.Status {
+	if r.DownloadBandwidth == 0 && r.UploadBandwidth == 0 {
+		return stl.StatusOutage
+	}
+	if r.DownloadBandwidth == 0 || r.UploadBandwidth == 0 {
+		return stl.StatusPartial
+	}
+	return stl.StatusOk
+}
+
+// Entry converts this result to an stl.Entry with timestamp ts. If the
+// speedtest CLI did not report packet loss, the entry records packet loss
+// as unmeasured.
+func (r *Result) Entry(ts int64) stl.Entry {
+	entry := stl.Entry{
+		Ts:           ts,
+		DownloadMbps: r.DownloadMbps(),
+		UploadMbps:   r.UploadMbps(),
+		PingMs:       r.PingLatencyMs,
+		JitterMs:     r.PingJitterMs,
+		Status:       r.Status(),
+	}
+	if r.PacketLossReported {
+		entry.PacketLossPercent = r.PacketLoss
+	} else {
+		entry.Unmeasured = stl.MeasurePacketLoss
+	}
+	return entry
+}
+
+// ClassifyFailure returns the status of a failed speedtest run given
+// the exit code of the speedtest CLI and what it wrote to stderr. An
+// exitCode of -1 means the exit code is unknown. Failures that
+// ClassifyFailure does not recognise as timeouts or tool errors are
+// reported as outages.
+func ClassifyFailure(exitCode int, stderr string) stl.Status {
+	switch exitCode {
+	case kTimeoutExitCode:
+		return stl.StatusTimeout
+	case kCannotExecuteExitCode, kNotFoundExitCode:
+		return stl.StatusToolError
+	}
+	message := strings.ToLower(stderr)
+	if containsAny(message, kTimeoutMessages) {
+		return stl.StatusTimeout
+	}
+	if containsAny(message, kToolErrorMessages) {
+		return stl.StatusToolError
+	}
+
+	// Killed by a signal other than by timeout(1) e.g crashed.
+	if exitCode > 128 {
+		return stl.StatusToolError
+	}
+	return stl.StatusOutage
+}
+
+func containsAny(s string, substrs []string) bool {
+	for _, substr := range substrs {
+		if strings.Contains(s, substr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package ookla
+
+import (
+	"testing"
+
+	"github.com/keep94/speedtestlogger/stl"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResultStatus(t *testing.T) {
+	assert.Equal(
+		t,
+		stl.StatusOk,
+		(&Result{DownloadBandwidth: 1, UploadBandwidth: 1}).Status())
+	assert.Equal(
+		t, stl.StatusPartial, (&Result{DownloadBandwidth: 1}).Status())
+	assert.Equal(t, stl.StatusOutage, (&Result{}).Status())
+}
+
+func TestClassifyFailure(t *testing.T) {
+	assert.Equal(t, stl.StatusTimeout, ClassifyFailure(124, ""))
+	assert.Equal(t, stl.StatusToolError, ClassifyFailure(127, ""))
+	assert.Equal(t, stl.StatusToolError, ClassifyFailure(139, ""))
+	assert.Equal(
+		t,
+		stl.StatusToolError,
+		ClassifyFailure(
+			2,
+			"[error] Configuration - Couldn't resolve host name (HostNotFoundException)"))
+	assert.Equal(
+		t,
+		stl.StatusTimeout,
+		ClassifyFailure(2, "[error] Error: [0] Timeout occurred in connect."))
+	assert.Equal(
+		t,
+		stl.StatusOutage,
+		ClassifyFailure(2, "[error] Cannot read: Network is unreachable"))
+	assert.Equal(t, stl.StatusOutage, ClassifyFailure(-1, ""))
+}
+
+func TestResultEntry(t *testing.T) {
+	result := Result{
+		DownloadBandwidth:  12500000,
+		UploadBandwidth:    1250000,
+		PingLatencyMs:      12.5,
+		PingJitterMs:       1.5,
+		PacketLoss:         0.25,
+		PacketLossReported: true,
+	}
+	assert.Equal(
+		t,
+		stl.Entry{
+			Ts:                1000,
+			DownloadMbps:      100.0,
+			UploadMbps:        10.0,
+			PingMs:            12.5,
+			JitterMs:          1.5,
+			PacketLossPercent: 0.25,
+		},
+		result.Entry(1000))
+
+	result.PacketLossReported = false
+	assert.Equal(
+		t,
+		stl.Entry{
+			Ts:           1000,
+			DownloadMbps: 100.0,
+			UploadMbps:   10.0,
+			PingMs:       12.5,
+			JitterMs:     1.5,
+			Unmeasured:   stl.MeasurePacketLoss,
+		},
+		result.Entry(1000))
+}
@@ -0,0 +1,119 @@
+// Package retention prunes old entries while keeping daily summaries of
+// them so that long term summaries survive.
+package retention
+
+import (
+	"math"
+	"time"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/speedtestlogger/stl"
+	"github.com/keep94/speedtestlogger/stl/aggregators"
+	"github.com/keep94/speedtestlogger/stl/dates"
+	"github.com/keep94/speedtestlogger/stl/stldb"
+	"github.com/keep94/toolbox/db"
+)
+
+type Store interface {
+	stldb.EntriesRunner
+	stldb.RemoveEntriesRunner
+	stldb.ProbesRunner
+	stldb.AddDaySummaryRunner
+}
+
+// Policy says how long to keep entries.
+type Policy struct {
+
+	// The number of whole days of entries to keep before today. Entries
+	// from today are always kept.
+	KeepDays int
+
+	// The time zone that determines where days begin and end.
+	Location *time.Location
+}
+
+// Result tallies what Prune did.
+type Result struct {
+
+	// Number of entries summarised and removed.
+	Entries int
+
+	// Number of day summaries added.
+	DaySummaries int
+}
+
+// Cutoff returns the timestamp before which Prune removes entries when
+// the current time is now. Cutoff is always midnight in p.Location.
+func (p *Policy) Cutoff(now int64) int64 {
+	today := dates.DatePart(now, p.Location)
+	return dates.ToTimestamp(
+		aggregators.Daily().Add(today, -p.KeepDays), p.Location)
+}
+
+// Prune rolls the entries before Cutoff(now) into one stl.DaySummary per
+// probe and day and then removes those entries. Callers should pass a
+// transaction so that either all of the entries are replaced by their
+// summaries or nothing changes.
+func (p *Policy) Prune(
+	t db.Transaction, store Store, now int64) (*Result, error) {
+	cutoff := p.Cutoff(now)
+	probes, err := store.Probes(t)
+	if err != nil {
+		return nil, err
+	}
+	var result Result
+	for _, probe := range probes {
+		builder := aggregators.NewDaySummaries(probe, p.Location)
+		seed, ok, err := firstKept(t, store, probe, cutoff)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			builder.Seed(seed)
+		}
+		err = store.ProbeEntries(
+			t,
+			probe,
+			math.MinInt64,
+			cutoff,
+			consume2.Call(func(entry stl.Entry) {
+				builder.Add(entry)
+				result.Entries++
+			}))
+		if err != nil {
+			return nil, err
+		}
+		for _, summary := range builder.DaySummaries() {
+			if err := store.AddDaySummary(t, &summary); err != nil {
+				return nil, err
+			}
+			result.DaySummaries++
+		}
+	}
+	if err := store.RemoveEntries(t, math.MinInt64, cutoff); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// firstKept returns the least recent entry of probe at or after cutoff.
+// It skips failed runs because they don't count as uptime or downtime.
+func firstKept(
+	t db.Transaction,
+	store Store,
+	probe string,
+	cutoff int64) (first stl.Entry, ok bool, err error) {
+	err = store.ProbeEntries(
+		t,
+		probe,
+		cutoff,
+		math.MaxInt64,
+		consume2.Call(func(entry stl.Entry) {
+			if entry.Status != stl.StatusToolError &&
+				entry.Status != stl.StatusTimeout {
+				first = entry
+				ok = true
+			}
+		}))
+	return
+}
@@ -0,0 +1,148 @@
+package retention_test
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/speedtestlogger/stl"
+	"github.com/keep94/speedtestlogger/stl/aggregators"
+	"github.com/keep94/speedtestlogger/stl/retention"
+	"github.com/keep94/speedtestlogger/stl/stldb/for_memory"
+	"github.com/keep94/speedtestlogger/stl/stldb/for_sqlite"
+	"github.com/keep94/speedtestlogger/stl/stldb/sqlite_setup"
+	"github.com/keep94/toolbox/date_util"
+	"github.com/keep94/toolbox/db"
+	"github.com/keep94/toolbox/db/sqlite3_db"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCutoff(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+	policy := retention.Policy{KeepDays: 2, Location: loc}
+	now := time.Date(2025, 3, 10, 15, 30, 0, 0, loc).Unix()
+	assert.Equal(
+		t,
+		time.Date(2025, 3, 8, 0, 0, 0, 0, loc).Unix(),
+		policy.Cutoff(now))
+}
+
+func TestPrune(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+	store := for_memory.New()
+	entries := []stl.Entry{
+		{Ts: ts(2025, 3, 1, 6, loc), DownloadMbps: 60.0, UploadMbps: 6.0},
+		{Ts: ts(2025, 3, 1, 12, loc), DownloadMbps: 80.0, UploadMbps: 8.0},
+		{Ts: ts(2025, 3, 2, 12, loc), DownloadMbps: 100.0, UploadMbps: 10.0},
+		{Ts: ts(2025, 3, 2, 23, loc)},
+		{
+			Probe:        "office",
+			Ts:           ts(2025, 3, 2, 9, loc),
+			DownloadMbps: 40.0,
+			UploadMbps:   4.0,
+		},
+		{Ts: ts(2025, 3, 3, 0, loc), DownloadMbps: 90.0, UploadMbps: 9.0},
+	}
+	for i := range entries {
+		assert.NoError(t, store.AddEntry(nil, &entries[i]))
+	}
+	policy := retention.Policy{KeepDays: 1, Location: loc}
+	now := ts(2025, 3, 4, 8, loc)
+	var expected aggregators.Summary
+	for i := len(entries) - 2; i >= 0; i-- {
+		if entries[i].Probe == "" {
+			expected.Add(entries[i])
+		}
+	}
+
+	result, err := policy.Prune(nil, store, now)
+	assert.NoError(t, err)
+	assert.Equal(t, &retention.Result{Entries: 5, DaySummaries: 3}, result)
+
+	var kept []stl.Entry
+	assert.NoError(
+		t, store.Entries(nil, 0, now, consume2.AppendTo(&kept)))
+	assert.Equal(t, []stl.Entry{entries[5]}, kept)
+
+	var days []stl.DaySummary
+	assert.NoError(
+		t, store.ProbeDaySummaries(nil, "", 0, now, consume2.AppendTo(&days)))
+	assert.Len(t, days, 2)
+	assert.Equal(t, date_util.YMD(2025, 3, 2).Unix(), days[0].Date)
+	assert.Equal(t, date_util.YMD(2025, 3, 1).Unix(), days[1].Date)
+
+	// The outage on Mar 2 lasts until the first kept entry.
+	assert.Equal(t, int64(3600), days[0].LongestOutageSeconds)
+
+	var summary aggregators.Summary
+	for i := range days {
+		summary.AddDaySummary(&days[i])
+	}
+	assert.Equal(t, expected.DownloadMbps, summary.DownloadMbps)
+	assert.Equal(t, expected.PercentUptime, summary.PercentUptime)
+	assert.Equal(t, expected.OutageCount, summary.OutageCount)
+
+	days = nil
+	assert.NoError(
+		t,
+		store.ProbeDaySummaries(
+			nil, "office", 0, now, consume2.AppendTo(&days)))
+	assert.Len(t, days, 1)
+	assert.Equal(t, int64(1), days[0].Tests)
+	assert.Equal(t, 40.0, days[0].DownloadMbps.Sum)
+
+	probes, err := store.Probes(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"", "office"}, probes)
+}
+
+func TestPruneRollsBack(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+	dbase := openDb(t)
+	defer dbase.Close()
+	store := for_sqlite.New(dbase)
+	entry := stl.Entry{
+		Ts: ts(2025, 3, 1, 6, loc), DownloadMbps: 60.0, UploadMbps: 6.0}
+	assert.NoError(t, store.AddEntry(nil, &entry))
+	policy := retention.Policy{KeepDays: 1, Location: loc}
+	now := ts(2025, 3, 4, 8, loc)
+	errDryRun := errors.New("dry run")
+	err = sqlite3_db.NewDoer(dbase).Do(func(t db.Transaction) error {
+		if _, err := policy.Prune(t, store, now); err != nil {
+			return err
+		}
+		return errDryRun
+	})
+	assert.Equal(t, errDryRun, err)
+
+	var kept []stl.Entry
+	assert.NoError(
+		t, store.Entries(nil, 0, now, consume2.AppendTo(&kept)))
+	assert.Equal(t, []stl.Entry{entry}, kept)
+	var days []stl.DaySummary
+	assert.NoError(
+		t, store.DaySummaries(nil, 0, now, consume2.AppendTo(&days)))
+	assert.Empty(t, days)
+}
+
+func ts(year, month, day, hour int, loc *time.Location) int64 {
+	return time.Date(year, time.Month(month), day, hour, 0, 0, 0, loc).Unix()
+}
+
+func openDb(t *testing.T) *sqlite3_db.Db {
+	rawdb, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Error opening database: %v", err)
+	}
+	dbase := sqlite3_db.New(rawdb)
+	if err := dbase.Do(sqlite_setup.SetUpTables); err != nil {
+		t.Fatalf("Error creating tables: %v", err)
+	}
+	return dbase
+}
@@ -0,0 +1,336 @@
+package fixture
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/speedtestlogger/stl"
+	"github.com/keep94/toolbox/db"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	kLargeCount = 5000
+	kWriters    = 8
+	kPerWriter  = 50
+)
+
+var (
+	errRollback = errors.New("fixture: rollback")
+)
+
+// Conformance runs every test of the entry runners in this package. Each
+// test gets its own empty store from newStore along with a doer that
+// creates transactions the store accepts. Backends without transactions
+// return a nil doer, and Conformance skips Rollback for them. Such
+// backends must say in their doc comments that they have no
+// transactions.
+func Conformance(
+	t *testing.T, newStore func(t *testing.T) (Store, db.Doer)) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, store Store)
+	}{
+		{"Entries", Entries},
+		{"EntryRanges", EntryRanges},
+		{"EqualTimestamps", EqualTimestamps},
+		{"EmptyRanges", EmptyRanges},
+		{"LargeResults", LargeResults},
+		{"EarlyTermination", EarlyTermination},
+		{"ConcurrentWriters", ConcurrentWriters},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, _ := newStore(t)
+			tt.test(t, store)
+		})
+	}
+	t.Run("Rollback", func(t *testing.T) {
+		store, doer := newStore(t)
+		if doer == nil {
+			t.Skip("store has no transactions")
+		}
+		Rollback(t, store, doer)
+	})
+}
+
+// EntryRanges tests that startTime is inclusive and endTime is exclusive
+// when reading and removing entries.
+func EntryRanges(t *testing.T, store Store) {
+	first := stl.Entry{Ts: 100, DownloadMbps: 50.0}
+	second := stl.Entry{Probe: "office", Ts: 200, DownloadMbps: 60.0}
+	third := stl.Entry{Ts: 300, DownloadMbps: 70.0}
+	addEntries(t, store, &first, &second, &third)
+
+	assert.Equal(t, []stl.Entry{second, first}, entries(t, store, 100, 300))
+	assert.Equal(t, []stl.Entry{second}, entries(t, store, 101, 300))
+	assert.Equal(
+		t, []stl.Entry{third, second, first}, entries(t, store, 100, 301))
+	assert.Empty(t, entries(t, store, 0, 100))
+	assert.Empty(t, entries(t, store, 301, 400))
+	assert.Equal(t, []stl.Entry{first}, probeEntries(t, store, "", 100, 300))
+	assert.Equal(t, []stl.Entry{third}, probeEntries(t, store, "", 101, 301))
+	assert.Empty(t, probeEntries(t, store, "office", 100, 200))
+
+	assert.NoError(t, store.RemoveEntries(nil, 200, 300))
+	assert.Equal(t, []stl.Entry{third, first}, entries(t, store, 0, 400))
+	assert.NoError(t, store.RemoveEntries(nil, 0, 100))
+	assert.Equal(t, []stl.Entry{third, first}, entries(t, store, 0, 400))
+	assert.NoError(t, store.RemoveEntries(nil, 100, 101))
+	assert.Equal(t, []stl.Entry{third}, entries(t, store, 0, 400))
+}
+
+// EqualTimestamps tests that entries with the same timestamp come most
+// recently added first and are read and removed together.
+func EqualTimestamps(t *testing.T, store Store) {
+	before := stl.Entry{Ts: 499, DownloadMbps: 40.0}
+	first := stl.Entry{Ts: 500, DownloadMbps: 50.0}
+	second := stl.Entry{Probe: "office", Ts: 500, DownloadMbps: 60.0}
+	third := stl.Entry{Ts: 500, Status: stl.StatusOutage}
+	after := stl.Entry{Ts: 501, DownloadMbps: 70.0}
+	addEntries(t, store, &first, &after, &second, &before, &third)
+
+	assert.Equal(
+		t, []stl.Entry{third, second, first}, entries(t, store, 500, 501))
+	assert.Equal(
+		t,
+		[]stl.Entry{after, third, second, first, before},
+		entries(t, store, 0, 1000))
+	assert.Equal(
+		t, []stl.Entry{third, first}, probeEntries(t, store, "", 500, 501))
+
+	assert.NoError(t, store.RemoveEntries(nil, 500, 501))
+	assert.Equal(t, []stl.Entry{after, before}, entries(t, store, 0, 1000))
+}
+
+// EmptyRanges tests reading and removing entries from an empty store and
+// over empty and reversed time ranges.
+func EmptyRanges(t *testing.T, store Store) {
+	assert.Empty(t, entries(t, store, 0, 1000))
+	assert.Empty(t, probeEntries(t, store, "", 0, 1000))
+	probes, err := store.Probes(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, probes)
+	assert.NoError(t, store.RemoveEntries(nil, 0, 1000))
+
+	first := stl.Entry{Ts: 100, DownloadMbps: 50.0}
+	second := stl.Entry{Ts: 200, DownloadMbps: 60.0}
+	addEntries(t, store, &first, &second)
+
+	assert.Empty(t, entries(t, store, 100, 100))
+	assert.Empty(t, entries(t, store, 200, 100))
+	assert.Empty(t, entries(t, store, 101, 200))
+	assert.Empty(t, probeEntries(t, store, "", 200, 200))
+	assert.Empty(t, probeEntries(t, store, "office", 0, 1000))
+
+	assert.NoError(t, store.RemoveEntries(nil, 100, 100))
+	assert.NoError(t, store.RemoveEntries(nil, 200, 100))
+	assert.NoError(t, store.RemoveEntries(nil, 101, 200))
+	assert.Equal(t, []stl.Entry{second, first}, entries(t, store, 0, 1000))
+}
+
+// LargeResults tests reading many entries added out of order.
+func LargeResults(t *testing.T, store Store) {
+	// 7919 is prime, so i*7919 % kLargeCount visits every index once.
+	for i := 0; i < kLargeCount; i++ {
+		index := int64(i * 7919 % kLargeCount)
+		entry := stl.Entry{Ts: index * 3600, DownloadMbps: float64(index)}
+		if index%2 == 1 {
+			entry.Probe = "office"
+		}
+		assert.NoError(t, store.AddEntry(nil, &entry))
+	}
+
+	all := entries(t, store, 0, kLargeCount*3600)
+	if assert.Len(t, all, kLargeCount) {
+		for i := range all {
+			assert.Equal(t, int64(kLargeCount-1-i)*3600, all[i].Ts)
+		}
+	}
+	assertUniqueIds(t, all)
+
+	office := probeEntries(t, store, "office", 0, kLargeCount*3600)
+	if assert.Len(t, office, kLargeCount/2) {
+		for i := range office {
+			assert.Equal(t, int64(kLargeCount-1-2*i)*3600, office[i].Ts)
+		}
+	}
+}
+
+// EarlyTermination tests that reading entries stops as soon as the
+// consumer can consume no more and that the store works afterwards.
+func EarlyTermination(t *testing.T, store Store) {
+	var added []stl.Entry
+	for i := 0; i < 10; i++ {
+		entry := stl.Entry{Ts: int64(100 * (i + 1)), DownloadMbps: 50.0}
+		assert.NoError(t, store.AddEntry(nil, &entry))
+		added = append(added, entry)
+	}
+
+	consumer := &limitConsumer{t: t, limit: 3}
+	assert.NoError(t, store.Entries(nil, 0, 2000, consumer))
+	assert.Equal(t, []stl.Entry{added[9], added[8], added[7]}, consumer.entries)
+
+	consumer = &limitConsumer{t: t, limit: 2}
+	assert.NoError(t, store.ProbeEntries(nil, "", 0, 550, consumer))
+	assert.Equal(t, []stl.Entry{added[4], added[3]}, consumer.entries)
+
+	consumer = &limitConsumer{t: t}
+	assert.NoError(t, store.Entries(nil, 0, 2000, consumer))
+	assert.Empty(t, consumer.entries)
+
+	var page []stl.Entry
+	assert.NoError(
+		t,
+		store.Entries(
+			nil, 0, 2000, consume2.Slice(consume2.AppendTo(&page), 2, 4)))
+	assert.Equal(t, []stl.Entry{added[7], added[6]}, page)
+
+	last := stl.Entry{Ts: 1100, DownloadMbps: 60.0}
+	assert.NoError(t, store.AddEntry(nil, &last))
+	assert.NoError(t, store.RemoveEntries(nil, 0, 1000))
+	assert.Equal(
+		t, []stl.Entry{last, added[9]}, entries(t, store, 0, 2000))
+}
+
+// ConcurrentWriters tests adding entries from many goroutines at once
+// while other goroutines read.
+func ConcurrentWriters(t *testing.T, store Store) {
+	var mu sync.Mutex
+	var added []stl.Entry
+	var wg sync.WaitGroup
+	for i := 0; i < kWriters; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < kPerWriter; j++ {
+				entry := stl.Entry{
+					Probe:        fmt.Sprintf("probe%d", i),
+					Ts:           int64(j*kWriters + i),
+					DownloadMbps: 50.0,
+				}
+				if err := store.AddEntry(nil, &entry); err != nil {
+					t.Errorf("Error adding entry: %v", err)
+					return
+				}
+				mu.Lock()
+				added = append(added, entry)
+				mu.Unlock()
+				err := store.ProbeEntries(
+					nil, entry.Probe, 0, entry.Ts+1, consume2.Nil[stl.Entry]())
+				if err != nil {
+					t.Errorf("Error reading entries: %v", err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	all := entries(t, store, 0, kWriters*kPerWriter)
+	assert.ElementsMatch(t, added, all)
+	if assert.Len(t, all, kWriters*kPerWriter) {
+		for i := range all {
+			assert.Equal(t, int64(kWriters*kPerWriter-1-i), all[i].Ts)
+		}
+	}
+	assertUniqueIds(t, all)
+	probes, err := store.Probes(nil)
+	assert.NoError(t, err)
+	assert.Len(t, probes, kWriters)
+}
+
+// Rollback tests that adding and removing entries within a transaction
+// that rolls back leaves store unchanged. doer must create transactions
+// that store accepts.
+func Rollback(t *testing.T, store Store, doer db.Doer) {
+	first := stl.Entry{Ts: 100, DownloadMbps: 50.0}
+	assert.NoError(t, store.AddEntry(nil, &first))
+
+	err := doer.Do(func(tx db.Transaction) error {
+		second := stl.Entry{Probe: "office", Ts: 200, DownloadMbps: 60.0}
+		if err := store.AddEntry(tx, &second); err != nil {
+			return err
+		}
+		if err := store.RemoveEntries(tx, 100, 101); err != nil {
+			return err
+		}
+		var inside []stl.Entry
+		if err := store.Entries(
+			tx, 0, 1000, consume2.AppendTo(&inside)); err != nil {
+			return err
+		}
+		assert.Equal(t, []stl.Entry{second}, inside)
+		return errRollback
+	})
+	assert.Equal(t, errRollback, err)
+
+	assert.Equal(t, []stl.Entry{first}, entries(t, store, 0, 1000))
+	probes, err := store.Probes(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{""}, probes)
+
+	third := stl.Entry{Ts: 300, DownloadMbps: 70.0}
+	assert.NoError(t, store.AddEntry(nil, &third))
+	assert.Equal(t, []stl.Entry{third, first}, entries(t, store, 0, 1000))
+}
+
+// limitConsumer consumes up to limit entries and reports an error if
+// Consume is called after CanConsume returns false.
+type limitConsumer struct {
+	t       *testing.T
+	limit   int
+	entries []stl.Entry
+}
+
+func (c *limitConsumer) CanConsume() bool {
+	return len(c.entries) < c.limit
+}
+
+func (c *limitConsumer) Consume(entry stl.Entry) {
+	if !c.CanConsume() {
+		c.t.Errorf("Consume called after CanConsume returned false")
+		return
+	}
+	c.entries = append(c.entries, entry)
+}
+
+func addEntries(t *testing.T, store Store, entries ...*stl.Entry) {
+	for _, entry := range entries {
+		assert.NoError(t, store.AddEntry(nil, entry))
+	}
+}
+
+func entries(
+	t *testing.T, store Store, startTime, endTime int64) []stl.Entry {
+	var result []stl.Entry
+	assert.NoError(
+		t,
+		store.Entries(nil, startTime, endTime, consume2.AppendTo(&result)))
+	return result
+}
+
+func probeEntries(
+	t *testing.T,
+	store Store,
+	probe string,
+	startTime,
+	endTime int64) []stl.Entry {
+	var result []stl.Entry
+	assert.NoError(
+		t,
+		store.ProbeEntries(
+			nil, probe, startTime, endTime, consume2.AppendTo(&result)))
+	return result
+}
+
+func assertUniqueIds(t *testing.T, entries []stl.Entry) {
+	ids := make(map[int64]bool, len(entries))
+	for _, entry := range entries {
+		assert.Positive(t, entry.Id)
+		assert.False(t, ids[entry.Id], "duplicate id %d", entry.Id)
+		ids[entry.Id] = true
+	}
+}
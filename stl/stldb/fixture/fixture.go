@@ -4,28 +4,44 @@ package fixture
 
 import (
 	"testing"
+	"time"
 
 	"github.com/keep94/consume2"
 	"github.com/keep94/speedtestlogger/stl"
+	"github.com/keep94/speedtestlogger/stl/aggregators"
+	"github.com/keep94/speedtestlogger/stl/dates"
 	"github.com/keep94/speedtestlogger/stl/stldb"
+	"github.com/keep94/toolbox/date_util"
 	"github.com/stretchr/testify/assert"
 )
 
 var (
 	kFirstEntry = stl.Entry{
-		Ts:           123,
-		DownloadMbps: 50.0,
-		UploadMbps:   5.0,
+		Ts:                123,
+		DownloadMbps:      50.0,
+		UploadMbps:        5.0,
+		PingMs:            12.5,
+		JitterMs:          1.5,
+		PacketLossPercent: 0.0,
 	}
 	kSecondEntry = stl.Entry{
-		Ts:           234,
-		DownloadMbps: 60.0,
-		UploadMbps:   6.0,
+		Ts:                234,
+		DownloadMbps:      60.0,
+		UploadMbps:        6.0,
+		PingMs:            15.25,
+		JitterMs:          2.0,
+		PacketLossPercent: 0.5,
+		Retransmits:       3,
+		Status:            stl.StatusPartial,
 	}
 	kThirdEntry = stl.Entry{
-		Ts:           345,
-		DownloadMbps: 70.0,
-		UploadMbps:   7.0,
+		Probe:             "office",
+		Ts:                345,
+		DownloadMbps:      70.0,
+		PingMs:            9.75,
+		JitterMs:          0.25,
+		PacketLossPercent: 1.0,
+		Unmeasured:        stl.MeasureUpload,
 	}
 )
 
@@ -33,6 +49,27 @@ type Store interface {
 	stldb.AddEntryRunner
 	stldb.EntriesRunner
 	stldb.RemoveEntriesRunner
+	stldb.ProbesRunner
+}
+
+type DaySummaryStore interface {
+	stldb.AddDaySummaryRunner
+	stldb.DaySummariesRunner
+	stldb.ProbesRunner
+}
+
+type DatedSummaryStore interface {
+	Store
+	PlanStore
+	stldb.AddDaySummaryRunner
+	stldb.DaySummariesRunner
+	stldb.DatedSummariesRunner
+}
+
+type PlanStore interface {
+	stldb.AddPlanRunner
+	stldb.PlansRunner
+	stldb.RemovePlanRunner
 }
 
 func Entries(t *testing.T, store Store) {
@@ -52,6 +89,23 @@ func Entries(t *testing.T, store Store) {
 		store.Entries(nil, 100, 400, consume2.AppendTo(&entries)))
 	assert.Equal(t, []stl.Entry{third, second, first}, entries)
 
+	entries = nil
+	assert.NoError(
+		t,
+		store.ProbeEntries(nil, "", 100, 400, consume2.AppendTo(&entries)))
+	assert.Equal(t, []stl.Entry{second, first}, entries)
+
+	entries = nil
+	assert.NoError(
+		t,
+		store.ProbeEntries(
+			nil, "office", 100, 400, consume2.AppendTo(&entries)))
+	assert.Equal(t, []stl.Entry{third}, entries)
+
+	probes, err := store.Probes(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"", "office"}, probes)
+
 	entries = nil
 	assert.NoError(
 		t,
@@ -66,3 +120,299 @@ func Entries(t *testing.T, store Store) {
 		store.Entries(nil, 100, 400, consume2.AppendTo(&entries)))
 	assert.Equal(t, []stl.Entry{third}, entries)
 }
+
+func Plans(t *testing.T, store PlanStore) {
+	plans, err := store.Plans(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, plans)
+
+	basic := stl.Plan{
+		Name: "Basic", DownloadMbps: 100.0, UploadMbps: 10.0, Effective: 1000}
+	assert.NoError(t, store.AddPlan(nil, &basic))
+	gigabit := stl.Plan{
+		Name: "Gigabit", DownloadMbps: 1000.0, UploadMbps: 35.0, Effective: 3000}
+	assert.NoError(t, store.AddPlan(nil, &gigabit))
+	fast := stl.Plan{Name: "Fast", DownloadMbps: 300.0, Effective: 2000}
+	assert.NoError(t, store.AddPlan(nil, &fast))
+	assert.Equal(t, int64(1), basic.Id)
+	assert.Equal(t, int64(2), gigabit.Id)
+	assert.Equal(t, int64(3), fast.Id)
+
+	plans, err = store.Plans(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, stl.Plans{gigabit, fast, basic}, plans)
+
+	assert.NoError(t, store.RemovePlan(nil, fast.Id))
+	plans, err = store.Plans(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, stl.Plans{gigabit, basic}, plans)
+}
+
+func DaySummaries(t *testing.T, store DaySummaryStore) {
+	first := stl.DaySummary{
+		Date:       86400,
+		Tests:      48,
+		UpTests:    47,
+		FailedRuns: 1,
+		DownloadMbps: stl.Stats{
+			N: 47, Sum: 4700.0, SumSquares: 470470.0, Min: 90.0, Max: 110.0},
+		UploadMbps: stl.Stats{
+			N: 47, Sum: 470.0, SumSquares: 4750.0, Min: 9.0, Max: 11.0},
+		LatencyTests:         47,
+		PingMsSum:            470.0,
+		JitterTests:          46,
+		JitterMsSum:          94.0,
+		PacketLossTests:      45,
+		PacketLossPercentSum: 4.5,
+		UpSeconds:            84600,
+		DownSeconds:          1800,
+		Outages:              1,
+		LongestOutageSeconds: 1800,
+	}
+	assert.NoError(t, store.AddDaySummary(nil, &first))
+	second := stl.DaySummary{Date: 2 * 86400, Tests: 24, UpTests: 24}
+	assert.NoError(t, store.AddDaySummary(nil, &second))
+	third := stl.DaySummary{
+		Probe: "office", Date: 2 * 86400, Tests: 12, UpTests: 11}
+	assert.NoError(t, store.AddDaySummary(nil, &third))
+	assert.Equal(t, int64(1), first.Id)
+	assert.Equal(t, int64(2), second.Id)
+	assert.Equal(t, int64(3), third.Id)
+
+	var summaries []stl.DaySummary
+	assert.NoError(
+		t,
+		store.DaySummaries(
+			nil, 86400, 3*86400, consume2.AppendTo(&summaries)))
+	assert.Equal(t, []stl.DaySummary{third, second, first}, summaries)
+
+	summaries = nil
+	assert.NoError(
+		t,
+		store.DaySummaries(
+			nil, 0, 2*86400, consume2.AppendTo(&summaries)))
+	assert.Equal(t, []stl.DaySummary{first}, summaries)
+
+	summaries = nil
+	assert.NoError(
+		t,
+		store.ProbeDaySummaries(
+			nil, "", 0, 3*86400, consume2.AppendTo(&summaries)))
+	assert.Equal(t, []stl.DaySummary{second, first}, summaries)
+
+	summaries = nil
+	assert.NoError(
+		t,
+		store.ProbeDaySummaries(
+			nil, "office", 0, 3*86400, consume2.AppendTo(&summaries)))
+	assert.Equal(t, []stl.DaySummary{third}, summaries)
+
+	probes, err := store.Probes(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"", "office"}, probes)
+}
+
+// DatedSummaries tests that the DatedSummaries of store match what
+// aggregators.ByPeriodTotaler computes from the same entries and day
+// summaries as entries and plans are added and removed. loc is the time
+// zone store uses to group entries into days. slaPercent is the SLA
+// percent store checks tests against plans at.
+func DatedSummaries(
+	t *testing.T,
+	store DatedSummaryStore,
+	loc *time.Location,
+	slaPercent float64) {
+	at := func(month, day, hour int) int64 {
+		return time.Date(
+			2025, time.Month(month), day, hour, 0, 0, 0, loc).Unix()
+	}
+	entries := []stl.Entry{
+		{Ts: at(2, 1, 8), DownloadMbps: 90.0, UploadMbps: 9.0},
+		{Ts: at(1, 30, 10), DownloadMbps: 100.0, UploadMbps: 10.0, PingMs: 10.0},
+		{Ts: at(2, 1, 9), Status: stl.StatusToolError},
+		{Ts: at(1, 30, 12), Status: stl.StatusOutage},
+		{Probe: "office", Ts: at(1, 31, 10), DownloadMbps: 50.0, UploadMbps: 5.0},
+		{Ts: at(1, 31, 9), DownloadMbps: 80.0, UploadMbps: 8.0},
+
+		// An outage spanning midnight
+		{Ts: at(1, 29, 23), Status: stl.StatusOutage},
+		{Ts: at(1, 30, 1), Status: stl.StatusOutage},
+	}
+	for i := range entries {
+		assert.NoError(t, store.AddEntry(nil, &entries[i]))
+	}
+	daysStart := date_util.YMD(2025, 1, 29)
+	daysEnd := date_util.YMD(2025, 2, 2)
+	monthsStart := date_util.YMD(2025, 1, 1)
+	monthsEnd := date_util.YMD(2025, 3, 1)
+	assertRollups := func(probe string) {
+		actual, err := store.ProbeDatedSummaries(
+			nil, probe, aggregators.Daily(), daysStart, daysEnd)
+		assert.NoError(t, err)
+		assertSameSummaries(
+			t,
+			expectedSummaries(
+				t,
+				store,
+				probe,
+				aggregators.Daily(),
+				daysStart,
+				daysEnd,
+				loc,
+				slaPercent),
+			actual)
+		actual, err = store.ProbeDatedSummaries(
+			nil, probe, aggregators.Monthly(), monthsStart, monthsEnd)
+		assert.NoError(t, err)
+		assertSameSummaries(
+			t,
+			expectedSummaries(
+				t,
+				store,
+				probe,
+				aggregators.Monthly(),
+				monthsStart,
+				monthsEnd,
+				loc,
+				slaPercent),
+			actual)
+	}
+	assertRollups("")
+	assertRollups("office")
+
+	// Plans change which tests meet the plan.
+	plan := stl.Plan{DownloadMbps: 95.0, UploadMbps: 9.0, Effective: at(1, 31, 0)}
+	assert.NoError(t, store.AddPlan(nil, &plan))
+	assertRollups("")
+	assertRollups("office")
+	earlier := stl.Plan{DownloadMbps: 120.0, Effective: at(1, 1, 0)}
+	assert.NoError(t, store.AddPlan(nil, &earlier))
+	assertRollups("")
+	months, err := store.ProbeDatedSummaries(
+		nil, "", aggregators.Monthly(), monthsStart, monthsEnd)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, months[1].Compliance.Download.N)
+	assert.Equal(t, 200.0, months[1].Compliance.Download.Sum)
+	assert.NoError(t, store.RemovePlan(nil, plan.Id))
+	assertRollups("")
+	assertRollups("office")
+
+	// Adding up the rollups counts the outage spanning midnight once.
+	days, err := store.ProbeDatedSummaries(
+		nil, "", aggregators.Daily(), daysStart, daysEnd)
+	assert.NoError(t, err)
+	var total aggregators.Summary
+	for _, day := range days {
+		total.AddSummary(&day.Summary)
+	}
+	var expected aggregators.Summary
+	assert.NoError(
+		t,
+		store.ProbeEntries(
+			nil,
+			"",
+			dates.ToTimestamp(daysStart, loc),
+			dates.ToTimestamp(daysEnd, loc),
+			consume2.Call(expected.Add)))
+	assert.Equal(t, 2, expected.OutageCount)
+	assert.Equal(t, expected.OutageCount, total.OutageCount)
+	assert.Equal(t, 21*time.Hour, expected.LongestOutage)
+	assert.Equal(t, expected.LongestOutage, total.LongestOutage)
+
+	all, err := store.DatedSummaries(
+		nil, aggregators.Daily(), daysStart, daysEnd)
+	assert.NoError(t, err)
+	assert.Len(t, all, 4)
+	assert.Equal(t, date_util.YMD(2025, 1, 31), all[1].Date)
+	assert.Equal(t, 2, all[1].PercentUptime.N)
+	assert.Equal(t, 65.0, all[1].DownloadMbps.Avg())
+	assert.Equal(t, 1, all[0].PercentUptime.N)
+	assert.Equal(t, 1, all[0].FailedRuns)
+
+	_, err = store.DatedSummaries(
+		nil, aggregators.Weekly(time.Sunday), daysStart, daysEnd)
+	assert.Error(t, err)
+
+	assert.NoError(t, store.RemoveEntries(nil, at(1, 31, 0), at(2, 1, 0)))
+	assertRollups("")
+	assertRollups("office")
+	office, err := store.ProbeDatedSummaries(
+		nil, "office", aggregators.Monthly(), monthsStart, monthsEnd)
+	assert.NoError(t, err)
+	assert.False(t, office[1].PercentUptime.Exists())
+
+	daySummary := stl.DaySummary{
+		Date:         date_util.YMD(2025, 1, 15).Unix(),
+		Tests:        4,
+		UpTests:      3,
+		DownloadMbps: stl.Stats{N: 4, Sum: 200.0, SumSquares: 10000.0, Max: 50.0},
+		DownSeconds:  1800,
+		Outages:      1,
+	}
+	assert.NoError(t, store.AddDaySummary(nil, &daySummary))
+	assertRollups("")
+	months, err = store.ProbeDatedSummaries(
+		nil, "", aggregators.Monthly(), monthsStart, monthsEnd)
+	assert.NoError(t, err)
+	assert.Equal(t, 8, months[1].PercentUptime.N)
+	assert.Equal(t, 3, months[1].OutageCount)
+}
+
+func expectedSummaries(
+	t *testing.T,
+	store DatedSummaryStore,
+	probe string,
+	recurring aggregators.Recurring,
+	start, end time.Time,
+	loc *time.Location,
+	slaPercent float64) []*aggregators.DatedSummary {
+	totaler := aggregators.NewByPeriodTotaler(start, end, recurring, loc)
+	plans, err := store.Plans(nil)
+	assert.NoError(t, err)
+	totaler.SetSLA(aggregators.NewSLA(plans, slaPercent))
+	assert.NoError(
+		t,
+		store.ProbeEntries(
+			nil,
+			probe,
+			dates.ToTimestamp(start, loc),
+			dates.ToTimestamp(end, loc),
+			consume2.Call(totaler.Add)))
+	assert.NoError(
+		t,
+		store.ProbeDaySummaries(
+			nil,
+			probe,
+			start.Unix(),
+			end.Unix(),
+			consume2.Call(totaler.AddDaySummary)))
+	return totaler.DatedSummaries()
+}
+
+func assertSameSummaries(
+	t *testing.T, expected, actual []*aggregators.DatedSummary) {
+	if !assert.Len(t, actual, len(expected)) {
+		return
+	}
+	for i := range expected {
+		e, a := expected[i], actual[i]
+		assert.Equal(t, e.Date, a.Date)
+		assert.Equal(t, e.DownloadMbps, a.DownloadMbps)
+		assert.Equal(t, e.UploadMbps, a.UploadMbps)
+		assert.Equal(t, e.PingMs, a.PingMs)
+		assert.Equal(t, e.JitterMs, a.JitterMs)
+		assert.Equal(t, e.PacketLossPercent, a.PacketLossPercent)
+		assert.Equal(t, e.PercentUptime, a.PercentUptime)
+		assert.Equal(t, e.TimeUptime, a.TimeUptime)
+		assert.Equal(t, e.OutageCount, a.OutageCount)
+		assert.Equal(t, e.LongestOutage, a.LongestOutage)
+		assert.Equal(t, e.ServiceLapse, a.ServiceLapse)
+		assert.Equal(t, e.FailedRuns, a.FailedRuns)
+		assert.Equal(t, e.Compliance, a.Compliance)
+		assert.Equal(t, e.DownloadStats.N(), a.DownloadStats.N())
+		if e.DownloadStats.Exists() {
+			assert.InDelta(t, e.DownloadStats.Mean(), a.DownloadStats.Mean(), 1e-9)
+			assert.Equal(t, e.DownloadStats.Max(), a.DownloadStats.Max())
+		}
+	}
+}
@@ -0,0 +1,314 @@
+// Package for_memory provides an in-memory implementation of interfaces
+// in the stldb package. It needs no database file or cgo, which makes it
+// handy for tests and for embedding.
+package for_memory
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/speedtestlogger/stl"
+	"github.com/keep94/speedtestlogger/stl/aggregators"
+	"github.com/keep94/speedtestlogger/stl/dates"
+	"github.com/keep94/speedtestlogger/stl/stldb/internal/sorted"
+	"github.com/keep94/toolbox/db"
+)
+
+const (
+
+	// The SLA percent a new store checks tests against plans at. This is
+	// stlview's default.
+	kDefaultSLAPercent = 80.0
+)
+
+var (
+	errNoRollups = errors.New("for_memory: only daily and monthly summaries are supported")
+)
+
+// Store is an in-memory datastore for the speedtestlogger app. Store is
+// safe to use from multiple goroutines. Store has no transactions; it
+// ignores the db.Transaction parameter of its methods, and changes take
+// effect immediately. Changes stay even if the transaction passed in
+// rolls back, so Store skips the Rollback conformance test.
+type Store struct {
+	mu         sync.Mutex
+	loc        *time.Location
+	slaPercent float64
+
+	// Sorted by ts then by id.
+	entries []stl.Entry
+
+	// Sorted by date then by id.
+	daySummaries []stl.DaySummary
+
+	plans         []stl.Plan
+	lastEntryId   int64
+	lastSummaryId int64
+	lastPlanId    int64
+}
+
+// New creates a new, empty in-memory store. Like for_sqlite.New, the
+// store groups entries into days in local time.
+func New() *Store {
+	return NewInLocation(time.Local)
+}
+
+// NewInLocation works like New except that the store groups entries into
+// days in loc.
+func NewInLocation(loc *time.Location) *Store {
+	return &Store{loc: loc, slaPercent: kDefaultSLAPercent}
+}
+
+// SetSLAPercent sets the SLA percent that DatedSummaries and
+// ProbeDatedSummaries check tests against plans at. The default is 80.
+// See aggregators.NewSLA.
+func (s *Store) SetSLAPercent(percent float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.slaPercent = percent
+}
+
+func (s *Store) AddEntry(t db.Transaction, entry *stl.Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastEntryId++
+	entry.Id = s.lastEntryId
+	s.entries = sorted.Insert(s.entries, *entry, sorted.CompareEntry)
+	return nil
+}
+
+func (s *Store) Entries(
+	t db.Transaction,
+	startTime,
+	endTime int64,
+	consumer consume2.Consumer[stl.Entry]) error {
+	sorted.ConsumeAll(
+		s.entriesBetween(startTime, endTime, func(*stl.Entry) bool {
+			return true
+		}),
+		consumer)
+	return nil
+}
+
+func (s *Store) ProbeEntries(
+	t db.Transaction,
+	probe string,
+	startTime,
+	endTime int64,
+	consumer consume2.Consumer[stl.Entry]) error {
+	sorted.ConsumeAll(
+		s.entriesBetween(startTime, endTime, func(entry *stl.Entry) bool {
+			return entry.Probe == probe
+		}),
+		consumer)
+	return nil
+}
+
+func (s *Store) Probes(t db.Transaction) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var probes []string
+	for i := range s.entries {
+		probes = append(probes, s.entries[i].Probe)
+	}
+	for i := range s.daySummaries {
+		probes = append(probes, s.daySummaries[i].Probe)
+	}
+	slices.Sort(probes)
+	return slices.Compact(probes), nil
+}
+
+func (s *Store) RemoveEntries(
+	t db.Transaction, startTime, endTime int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	start, end := sorted.Range(s.entries, startTime, endTime, sorted.EntryTs)
+	s.entries = slices.Delete(s.entries, start, end)
+	return nil
+}
+
+func (s *Store) AddDaySummary(
+	t db.Transaction, summary *stl.DaySummary) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastSummaryId++
+	summary.Id = s.lastSummaryId
+	s.daySummaries = sorted.Insert(
+		s.daySummaries, *summary, sorted.CompareDaySummary)
+	return nil
+}
+
+func (s *Store) DaySummaries(
+	t db.Transaction,
+	startDate,
+	endDate int64,
+	consumer consume2.Consumer[stl.DaySummary]) error {
+	sorted.ConsumeAll(
+		s.daySummariesBetween(
+			startDate, endDate, func(*stl.DaySummary) bool { return true }),
+		consumer)
+	return nil
+}
+
+func (s *Store) ProbeDaySummaries(
+	t db.Transaction,
+	probe string,
+	startDate,
+	endDate int64,
+	consumer consume2.Consumer[stl.DaySummary]) error {
+	sorted.ConsumeAll(
+		s.daySummariesBetween(
+			startDate,
+			endDate,
+			func(summary *stl.DaySummary) bool {
+				return summary.Probe == probe
+			}),
+		consumer)
+	return nil
+}
+
+func (s *Store) DatedSummaries(
+	t db.Transaction,
+	recurring aggregators.Recurring,
+	start,
+	end time.Time) ([]*aggregators.DatedSummary, error) {
+	probes, err := s.Probes(t)
+	if err != nil {
+		return nil, err
+	}
+	return s.datedSummaries(t, probes, recurring, start, end)
+}
+
+func (s *Store) ProbeDatedSummaries(
+	t db.Transaction,
+	probe string,
+	recurring aggregators.Recurring,
+	start,
+	end time.Time) ([]*aggregators.DatedSummary, error) {
+	return s.datedSummaries(t, []string{probe}, recurring, start, end)
+}
+
+func (s *Store) AddPlan(t db.Transaction, plan *stl.Plan) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastPlanId++
+	plan.Id = s.lastPlanId
+	s.plans = append(s.plans, *plan)
+	return nil
+}
+
+func (s *Store) Plans(t db.Transaction) (stl.Plans, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sortedPlans(), nil
+}
+
+func (s *Store) RemovePlan(t db.Transaction, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.plans = slices.DeleteFunc(s.plans, func(plan stl.Plan) bool {
+		return plan.Id == id
+	})
+	return nil
+}
+
+// datedSummaries summarises probes the way for_sqlite rollups do: each
+// probe by day, seeding each day with the entry that follows it, and
+// then the days by period.
+func (s *Store) datedSummaries(
+	t db.Transaction,
+	probes []string,
+	recurring aggregators.Recurring,
+	start,
+	end time.Time) ([]*aggregators.DatedSummary, error) {
+	if recurring != aggregators.Daily() && recurring != aggregators.Monthly() {
+		return nil, errNoRollups
+	}
+	start = recurring.Normalize(start)
+	end = recurring.Normalize(end)
+	startTime := dates.ToTimestamp(start, s.loc)
+	endTime := dates.ToTimestamp(end, s.loc)
+	totaler := aggregators.NewByPeriodTotaler(start, end, recurring, s.loc)
+	s.mu.Lock()
+	sla := aggregators.NewSLA(s.sortedPlans(), s.slaPercent)
+	s.mu.Unlock()
+	for _, probe := range probes {
+		isProbe := func(entry *stl.Entry) bool {
+			return entry.Probe == probe
+		}
+		builder := aggregators.NewDaySummaries(probe, s.loc)
+		builder.SetSLA(sla)
+		if next, ok := s.firstEntryFrom(endTime, probe); ok {
+			builder.Seed(next)
+		}
+		for _, entry := range s.entriesBetween(startTime, endTime, isProbe) {
+			builder.Add(entry)
+		}
+		for _, day := range builder.DaySummaries() {
+			totaler.AddDaySummary(day)
+		}
+		days := s.daySummariesBetween(
+			start.Unix(),
+			end.Unix(),
+			func(summary *stl.DaySummary) bool {
+				return summary.Probe == probe
+			})
+		for _, day := range days {
+			totaler.AddDaySummary(day)
+		}
+	}
+	return totaler.DatedSummaries(), nil
+}
+
+// firstEntryFrom returns the least recent entry of probe at or after ts
+// that is not a failed run.
+func (s *Store) firstEntryFrom(ts int64, probe string) (stl.Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	start, _ := sorted.Range(s.entries, ts, ts, sorted.EntryTs)
+	for i := start; i < len(s.entries); i++ {
+		entry := &s.entries[i]
+		if entry.Probe == probe &&
+			entry.Status != stl.StatusToolError &&
+			entry.Status != stl.StatusTimeout {
+			return *entry, true
+		}
+	}
+	return stl.Entry{}, false
+}
+
+// entriesBetween returns the entries between startTime and endTime for
+// which include returns true, most recent first.
+func (s *Store) entriesBetween(
+	startTime, endTime int64, include func(*stl.Entry) bool) []stl.Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sorted.Between(
+		s.entries, startTime, endTime, sorted.EntryTs, include)
+}
+
+// daySummariesBetween returns the day summaries between startDate and
+// endDate for which include returns true, most recent first.
+func (s *Store) daySummariesBetween(
+	startDate,
+	endDate int64,
+	include func(*stl.DaySummary) bool) []stl.DaySummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sorted.Between(
+		s.daySummaries, startDate, endDate, sorted.DaySummaryDate, include)
+}
+
+// sortedPlans returns a copy of the plans, most recently effective first.
+// Caller must hold the lock.
+func (s *Store) sortedPlans() stl.Plans {
+	plans := slices.Clone(s.plans)
+	slices.SortFunc(plans, func(a, b stl.Plan) int {
+		return cmp.Or(cmp.Compare(b.Effective, a.Effective), cmp.Compare(b.Id, a.Id))
+	})
+	return plans
+}
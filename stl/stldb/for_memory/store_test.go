@@ -0,0 +1,32 @@
+package for_memory_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/keep94/speedtestlogger/stl/stldb/fixture"
+	"github.com/keep94/speedtestlogger/stl/stldb/for_memory"
+	"github.com/keep94/toolbox/db"
+)
+
+func TestConformance(t *testing.T) {
+	fixture.Conformance(t, func(t *testing.T) (fixture.Store, db.Doer) {
+		return for_memory.New(), nil
+	})
+}
+
+func TestDaySummaries(t *testing.T) {
+	fixture.DaySummaries(t, for_memory.New())
+}
+
+func TestDatedSummaries(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("Error loading location: %v", err)
+	}
+	fixture.DatedSummaries(t, for_memory.NewInLocation(loc), loc, 80.0)
+}
+
+func TestPlans(t *testing.T) {
+	fixture.Plans(t, for_memory.New())
+}
@@ -0,0 +1,379 @@
+// Package for_ndjson provides an implementation of the entry interfaces
+// in the stldb package that keeps entries in an append-only file of JSON
+// lines. It needs no cgo, so it works on hosts where sqlite does not.
+// Each line holds one entry in the JSON form that the ingest package
+// reads, so stlimport can import the file into sqlite.
+package for_ndjson
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/speedtestlogger/stl"
+	"github.com/keep94/speedtestlogger/stl/stldb/internal/sorted"
+	"github.com/keep94/toolbox/db"
+)
+
+const (
+
+	// The type of the header line. See compact.
+	kHeaderType = "stlheader"
+)
+
+var (
+
+	// writeFile appends to the file. Tests replace it to simulate writes
+	// that fail part way through.
+	writeFile = (*os.File).Write
+)
+
+// Store stores entries in a JSON lines file. Store keeps an index of all
+// the entries in memory, which Open rebuilds from the file. AddEntry
+// appends a line to the file; RemoveEntries rewrites the file without
+// the removed entries. Store is safe to use from multiple goroutines but
+// not from multiple processes at once. Store has no transactions; it
+// ignores the db.Transaction parameter of its methods. Changes stay even
+// if the transaction passed in rolls back, so Store skips the Rollback
+// conformance test.
+type Store struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+
+	// Sorted by ts then by id.
+	entries []stl.Entry
+	lastId  int64
+}
+
+// Open opens the store in the file at path creating the file if it does
+// not exist. If the last line of the file has no newline and does not
+// parse because a write was cut short, Open discards it.
+func Open(path string) (*Store, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	result := &Store{path: path, file: file}
+	if err := result.load(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return result, nil
+}
+
+// Close closes the file.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+func (s *Store) AddEntry(t db.Transaction, entry *stl.Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	added := *entry
+	added.Id = s.lastId + 1
+	line, err := marshalLine(&added)
+	if err != nil {
+		return err
+	}
+	if err := s.append(line); err != nil {
+		return err
+	}
+	s.lastId = added.Id
+	s.insert(added)
+	entry.Id = added.Id
+	return nil
+}
+
+func (s *Store) Entries(
+	t db.Transaction,
+	startTime,
+	endTime int64,
+	consumer consume2.Consumer[stl.Entry]) error {
+	sorted.ConsumeAll(
+		s.entriesBetween(startTime, endTime, func(*stl.Entry) bool {
+			return true
+		}),
+		consumer)
+	return nil
+}
+
+func (s *Store) ProbeEntries(
+	t db.Transaction,
+	probe string,
+	startTime,
+	endTime int64,
+	consumer consume2.Consumer[stl.Entry]) error {
+	sorted.ConsumeAll(
+		s.entriesBetween(startTime, endTime, func(entry *stl.Entry) bool {
+			return entry.Probe == probe
+		}),
+		consumer)
+	return nil
+}
+
+func (s *Store) Probes(t db.Transaction) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var probes []string
+	for i := range s.entries {
+		probes = append(probes, s.entries[i].Probe)
+	}
+	slices.Sort(probes)
+	return slices.Compact(probes), nil
+}
+
+// RemoveEntries removes the entries within a given time range by
+// rewriting the file without them. The rewrite replaces the file
+// atomically so that a crash leaves either the old or the new file.
+func (s *Store) RemoveEntries(
+	t db.Transaction, startTime, endTime int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	start, end := sorted.Range(s.entries, startTime, endTime, sorted.EntryTs)
+	if start == end {
+		return nil
+	}
+	return s.compact(slices.Concat(s.entries[:start], s.entries[end:]))
+}
+
+// append appends line to the file. If the write fails, append truncates
+// the file back to where it was so that a partial line does not end up in
+// the middle of the file once the next line is appended. Caller must
+// hold the lock.
+func (s *Store) append(line []byte) error {
+	info, err := s.file.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := writeFile(s.file, line); err != nil {
+		return errors.Join(err, s.file.Truncate(info.Size()))
+	}
+	return nil
+}
+
+// load reads all the entries in the file. Caller must hold the lock or
+// have exclusive access.
+func (s *Store) load() error {
+	reader := bufio.NewReader(s.file)
+	var offset int64
+	for lineNo := 1; ; lineNo++ {
+		data, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return s.loadLast(data, offset)
+		}
+		if err != nil {
+			return err
+		}
+		offset += int64(len(data))
+		if len(bytes.TrimSpace(data)) == 0 {
+			continue
+		}
+		if err := s.loadLine(data); err != nil {
+			return fmt.Errorf("line %d: %w", lineNo, err)
+		}
+	}
+}
+
+// loadLast loads the last line of the file when it has no trailing
+// newline. data is the line, and offset is where it starts. If data
+// parses, loadLast ends it with a newline so that new lines go after
+// it; otherwise a write was cut short, and loadLast drops data. Caller
+// must hold the lock or have exclusive access.
+func (s *Store) loadLast(data []byte, offset int64) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if len(bytes.TrimSpace(data)) == 0 || s.loadLine(data) != nil {
+		return s.file.Truncate(offset)
+	}
+	_, err := s.file.Write([]byte{'\n'})
+	return err
+}
+
+// loadLine adds the entry in data to the index. Caller must hold the
+// lock or have exclusive access.
+func (s *Store) loadLine(data []byte) error {
+	entry, isHeader, err := unmarshalLine(data)
+	if err != nil {
+		return err
+	}
+	s.lastId = max(s.lastId, entry.Id)
+	if !isHeader {
+		s.insert(entry)
+	}
+	return nil
+}
+
+// compact replaces the file with one holding just entries and makes
+// entries the index. The new file begins with a header holding the
+// largest id given out so far so that removing the newest entries does
+// not make ids get reused. If compact fails before replacing the file,
+// the file and s are unchanged. Caller must hold the lock.
+func (s *Store) compact(entries []stl.Entry) (err error) {
+	tempPath := s.path + ".tmp"
+	temp, err := os.OpenFile(
+		tempPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil && s.file != temp {
+			temp.Close()
+			os.Remove(tempPath)
+		}
+	}()
+	writer := bufio.NewWriter(temp)
+	header, err := marshalHeader(s.lastId)
+	if err != nil {
+		return err
+	}
+	writer.Write(header)
+	for i := range entries {
+		line, err := marshalLine(&entries[i])
+		if err != nil {
+			return err
+		}
+		writer.Write(line)
+	}
+	if err := errors.Join(writer.Flush(), temp.Sync()); err != nil {
+		return err
+	}
+
+	// temp stays open across the rename, so it becomes the new file.
+	if err := os.Rename(tempPath, s.path); err != nil {
+		return err
+	}
+	s.file.Close()
+	s.file = temp
+	s.entries = entries
+
+	// The rename lasts through a crash only once the directory is synced.
+	return syncDir(filepath.Dir(s.path))
+}
+
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	return errors.Join(dir.Sync(), dir.Close())
+}
+
+// insert adds entry to the index. Caller must hold the lock.
+func (s *Store) insert(entry stl.Entry) {
+	s.entries = sorted.Insert(s.entries, entry, sorted.CompareEntry)
+}
+
+// entriesBetween returns the entries between startTime and endTime for
+// which include returns true, most recent first.
+func (s *Store) entriesBetween(
+	startTime, endTime int64, include func(*stl.Entry) bool) []stl.Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sorted.Between(
+		s.entries, startTime, endTime, sorted.EntryTs, include)
+}
+
+// line is the JSON form of an entry in the file. Type and LastId are
+// set only when the line is the header.
+type line struct {
+	Type              string   `json:"type,omitempty"`
+	LastId            int64    `json:"lastId,omitempty"`
+	Id                int64    `json:"id"`
+	Probe             string   `json:"probe,omitempty"`
+	Ts                int64    `json:"ts"`
+	DownloadMbps      float64  `json:"downloadMbps"`
+	UploadMbps        float64  `json:"uploadMbps"`
+	PingMs            float64  `json:"pingMs"`
+	JitterMs          float64  `json:"jitterMs"`
+	PacketLossPercent float64  `json:"packetLossPercent"`
+	Retransmits       int64    `json:"retransmits,omitempty"`
+	Status            string   `json:"status"`
+	Unmeasured        []string `json:"unmeasured,omitempty"`
+}
+
+// headerLine is the JSON form of the header. The ingest package skips
+// the header because of its type.
+type headerLine struct {
+	Type   string `json:"type"`
+	LastId int64  `json:"lastId"`
+}
+
+func marshalLine(entry *stl.Entry) ([]byte, error) {
+	result, err := json.Marshal(&line{
+		Id:                entry.Id,
+		Probe:             entry.Probe,
+		Ts:                entry.Ts,
+		DownloadMbps:      entry.DownloadMbps,
+		UploadMbps:        entry.UploadMbps,
+		PingMs:            entry.PingMs,
+		JitterMs:          entry.JitterMs,
+		PacketLossPercent: entry.PacketLossPercent,
+		Retransmits:       entry.Retransmits,
+		Status:            entry.Status.String(),
+		Unmeasured:        entry.Unmeasured.Names(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(result, '\n'), nil
+}
+
+func marshalHeader(lastId int64) ([]byte, error) {
+	result, err := json.Marshal(
+		&headerLine{Type: kHeaderType, LastId: lastId})
+	if err != nil {
+		return nil, err
+	}
+	return append(result, '\n'), nil
+}
+
+// unmarshalLine parses a line of the file. If the line is the header,
+// isHeader is true, and entry.Id is the largest id given out when the
+// header was written.
+func unmarshalLine(data []byte) (entry stl.Entry, isHeader bool, err error) {
+	var doc line
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return stl.Entry{}, false, err
+	}
+	switch doc.Type {
+	case kHeaderType:
+		return stl.Entry{Id: doc.LastId}, true, nil
+	case "":
+	default:
+		return stl.Entry{}, false, fmt.Errorf("bad type: %q", doc.Type)
+	}
+	status, ok := stl.ParseStatus(doc.Status)
+	if !ok {
+		return stl.Entry{}, false, fmt.Errorf("bad status: %q", doc.Status)
+	}
+	unmeasured, ok := stl.ParseMeasurement(doc.Unmeasured)
+	if !ok {
+		return stl.Entry{}, false, fmt.Errorf(
+			"bad unmeasured: %q", doc.Unmeasured)
+	}
+	return stl.Entry{
+		Id:                doc.Id,
+		Probe:             doc.Probe,
+		Ts:                doc.Ts,
+		DownloadMbps:      doc.DownloadMbps,
+		UploadMbps:        doc.UploadMbps,
+		PingMs:            doc.PingMs,
+		JitterMs:          doc.JitterMs,
+		PacketLossPercent: doc.PacketLossPercent,
+		Retransmits:       doc.Retransmits,
+		Status:            status,
+		Unmeasured:        unmeasured,
+	}, false, nil
+}
@@ -0,0 +1,45 @@
+package for_ndjson
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/speedtestlogger/stl"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShortWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "entries.ndjson")
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Error opening store: %v", err)
+	}
+	first := stl.Entry{Ts: 100, DownloadMbps: 50.0, UploadMbps: 5.0}
+	assert.NoError(t, store.AddEntry(nil, &first))
+
+	// The disk fills up half way through the second line.
+	writeFile = func(file *os.File, data []byte) (int, error) {
+		n, _ := file.Write(data[:len(data)/2])
+		return n, errors.New("disk full")
+	}
+	second := stl.Entry{Ts: 200, DownloadMbps: 60.0, UploadMbps: 6.0}
+	err = store.AddEntry(nil, &second)
+	writeFile = (*os.File).Write
+	assert.Error(t, err)
+
+	third := stl.Entry{Ts: 300, DownloadMbps: 70.0, UploadMbps: 7.0}
+	assert.NoError(t, store.AddEntry(nil, &third))
+	assert.NoError(t, store.Close())
+
+	store, err = Open(path)
+	if err != nil {
+		t.Fatalf("Error reopening store: %v", err)
+	}
+	defer store.Close()
+	var entries []stl.Entry
+	assert.NoError(t, store.Entries(nil, 0, 400, consume2.AppendTo(&entries)))
+	assert.Equal(t, []stl.Entry{third, first}, entries)
+}
@@ -0,0 +1,230 @@
+package for_ndjson_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/speedtestlogger/stl"
+	"github.com/keep94/speedtestlogger/stl/ingest"
+	"github.com/keep94/speedtestlogger/stl/stldb/fixture"
+	"github.com/keep94/speedtestlogger/stl/stldb/for_ndjson"
+	"github.com/keep94/toolbox/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConformance(t *testing.T) {
+	fixture.Conformance(t, func(t *testing.T) (fixture.Store, db.Doer) {
+		store := openStore(t, filepath.Join(t.TempDir(), "entries.ndjson"))
+		t.Cleanup(func() { store.Close() })
+		return store, nil
+	})
+}
+
+func TestReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "entries.ndjson")
+	store := openStore(t, path)
+	first := stl.Entry{Ts: 300, DownloadMbps: 50.0, UploadMbps: 5.0}
+	second := stl.Entry{
+		Probe: "office", Ts: 100, PingMs: 12.5, Status: stl.StatusOutage}
+	third := stl.Entry{Ts: 200, DownloadMbps: 60.0, Retransmits: 2}
+	assert.NoError(t, store.AddEntry(nil, &first))
+	assert.NoError(t, store.AddEntry(nil, &second))
+	assert.NoError(t, store.AddEntry(nil, &third))
+	assert.NoError(t, store.RemoveEntries(nil, 250, 400))
+	assert.NoError(t, store.Close())
+
+	store = openStore(t, path)
+	var entries []stl.Entry
+	assert.NoError(t, store.Entries(nil, 0, 400, consume2.AppendTo(&entries)))
+	assert.Equal(t, []stl.Entry{third, second}, entries)
+
+	// Ids keep increasing after reopening.
+	fourth := stl.Entry{Ts: 400, DownloadMbps: 70.0}
+	assert.NoError(t, store.AddEntry(nil, &fourth))
+	assert.Equal(t, int64(4), fourth.Id)
+	assert.NoError(t, store.Close())
+
+	store = openStore(t, path)
+	defer store.Close()
+	entries = nil
+	assert.NoError(t, store.Entries(nil, 0, 500, consume2.AppendTo(&entries)))
+	assert.Equal(t, []stl.Entry{fourth, third, second}, entries)
+}
+
+func TestPartialLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "entries.ndjson")
+	content := `{"id":1,"ts":100,"downloadMbps":50,"uploadMbps":5,"status":"ok"}
+{"id":2,"ts":200,"downl`
+	writeFile(t, path, content)
+	store := openStore(t, path)
+	second := stl.Entry{Ts: 200, DownloadMbps: 60.0, UploadMbps: 6.0}
+	assert.NoError(t, store.AddEntry(nil, &second))
+	assert.Equal(t, int64(2), second.Id)
+	assert.NoError(t, store.Close())
+
+	store = openStore(t, path)
+	var entries []stl.Entry
+	assert.NoError(t, store.Entries(nil, 0, 300, consume2.AppendTo(&entries)))
+	assert.Equal(
+		t,
+		[]stl.Entry{
+			second,
+			{Id: 1, Ts: 100, DownloadMbps: 50.0, UploadMbps: 5.0},
+		},
+		entries)
+	assert.NoError(t, store.Close())
+
+	// A complete last line without a newline is kept.
+	path = filepath.Join(t.TempDir(), "complete.ndjson")
+	content = `{"id":1,"ts":100,"downloadMbps":50,"uploadMbps":5,"status":"ok"}
+{"id":2,"ts":200,"downloadMbps":60,"uploadMbps":6,"status":"ok"}`
+	writeFile(t, path, content)
+	store = openStore(t, path)
+	third := stl.Entry{Ts: 300, DownloadMbps: 70.0, UploadMbps: 7.0}
+	assert.NoError(t, store.AddEntry(nil, &third))
+	assert.Equal(t, int64(3), third.Id)
+	assert.NoError(t, store.Close())
+
+	store = openStore(t, path)
+	defer store.Close()
+	entries = nil
+	assert.NoError(t, store.Entries(nil, 0, 400, consume2.AppendTo(&entries)))
+	assert.Equal(
+		t,
+		[]stl.Entry{
+			third,
+			{Id: 2, Ts: 200, DownloadMbps: 60.0, UploadMbps: 6.0},
+			{Id: 1, Ts: 100, DownloadMbps: 50.0, UploadMbps: 5.0},
+		},
+		entries)
+}
+
+func TestRemoveKeepsIds(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "entries.ndjson")
+	store := openStore(t, path)
+	first := stl.Entry{Ts: 100, DownloadMbps: 50.0, UploadMbps: 5.0}
+	second := stl.Entry{Ts: 200, DownloadMbps: 60.0, UploadMbps: 6.0}
+	third := stl.Entry{Ts: 300, DownloadMbps: 70.0, UploadMbps: 7.0}
+	assert.NoError(t, store.AddEntry(nil, &first))
+	assert.NoError(t, store.AddEntry(nil, &second))
+	assert.NoError(t, store.AddEntry(nil, &third))
+	assert.NoError(t, store.RemoveEntries(nil, 200, 400))
+	assert.NoError(t, store.Close())
+
+	store = openStore(t, path)
+	fourth := stl.Entry{Ts: 400, DownloadMbps: 80.0, UploadMbps: 8.0}
+	assert.NoError(t, store.AddEntry(nil, &fourth))
+	assert.Equal(t, int64(4), fourth.Id)
+	assert.NoError(t, store.Close())
+
+	// The header does not show up as a record.
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Error opening file: %v", err)
+	}
+	defer file.Close()
+	var records []ingest.Record
+	assert.NoError(t, ingest.Read(file, nil, consume2.AppendTo(&records)))
+	assert.Len(t, records, 2)
+}
+
+func TestRemoveFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "entries.ndjson")
+	store := openStore(t, path)
+	first := stl.Entry{Ts: 100, DownloadMbps: 50.0, UploadMbps: 5.0}
+	second := stl.Entry{Ts: 200, DownloadMbps: 60.0, UploadMbps: 6.0}
+	assert.NoError(t, store.AddEntry(nil, &first))
+	assert.NoError(t, store.AddEntry(nil, &second))
+
+	// Make the rewrite fail.
+	if err := os.Mkdir(path+".tmp", 0755); err != nil {
+		t.Fatalf("Error making directory: %v", err)
+	}
+	assert.Error(t, store.RemoveEntries(nil, 0, 150))
+	var entries []stl.Entry
+	assert.NoError(t, store.Entries(nil, 0, 400, consume2.AppendTo(&entries)))
+	assert.Equal(t, []stl.Entry{second, first}, entries)
+
+	third := stl.Entry{Ts: 300, DownloadMbps: 70.0, UploadMbps: 7.0}
+	assert.NoError(t, store.AddEntry(nil, &third))
+	assert.NoError(t, store.Close())
+
+	store = openStore(t, path)
+	defer store.Close()
+	entries = nil
+	assert.NoError(t, store.Entries(nil, 0, 400, consume2.AppendTo(&entries)))
+	assert.Equal(t, []stl.Entry{third, second, first}, entries)
+}
+
+func TestRemoveLeavesNoTempFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "entries.ndjson")
+	store := openStore(t, path)
+	defer store.Close()
+	first := stl.Entry{Ts: 100, DownloadMbps: 50.0, UploadMbps: 5.0}
+	assert.NoError(t, store.AddEntry(nil, &first))
+	assert.NoError(t, store.RemoveEntries(nil, 0, 150))
+	_, err := os.Stat(path + ".tmp")
+	assert.True(t, os.IsNotExist(err))
+
+	// The store keeps appending to the rewritten file.
+	second := stl.Entry{Ts: 200, DownloadMbps: 60.0, UploadMbps: 6.0}
+	assert.NoError(t, store.AddEntry(nil, &second))
+	reopened := openStore(t, path)
+	defer reopened.Close()
+	var entries []stl.Entry
+	assert.NoError(
+		t, reopened.Entries(nil, 0, 400, consume2.AppendTo(&entries)))
+	assert.Equal(t, []stl.Entry{second}, entries)
+}
+
+func TestBadLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "entries.ndjson")
+	writeFile(t, path, "{\"ts\":\n")
+	_, err := for_ndjson.Open(path)
+	assert.ErrorContains(t, err, "line 1")
+}
+
+func TestIngest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "entries.ndjson")
+	store := openStore(t, path)
+	entry := stl.Entry{
+		Probe:        "office",
+		Ts:           1700000000,
+		DownloadMbps: 50.0,
+		UploadMbps:   5.0,
+		PingMs:       12.5,
+		Status:       stl.StatusPartial,
+		Unmeasured:   stl.MeasurePacketLoss,
+	}
+	assert.NoError(t, store.AddEntry(nil, &entry))
+	assert.NoError(t, store.Close())
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Error opening file: %v", err)
+	}
+	defer file.Close()
+	var records []ingest.Record
+	assert.NoError(t, ingest.Read(file, nil, consume2.AppendTo(&records)))
+	if assert.Len(t, records, 1) {
+		assert.NoError(t, records[0].Err)
+		entry.Id = 0
+		assert.Equal(t, entry, records[0].Entry)
+	}
+}
+
+func openStore(t *testing.T, path string) *for_ndjson.Store {
+	store, err := for_ndjson.Open(path)
+	if err != nil {
+		t.Fatalf("Error opening store: %v", err)
+	}
+	return store
+}
+
+func writeFile(t *testing.T, path, content string) {
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Error writing file: %v", err)
+	}
+}
@@ -4,6 +4,7 @@ package for_sqlite
 
 import (
 	"database/sql"
+	"time"
 
 	"github.com/keep94/consume2"
 	"github.com/keep94/speedtestlogger/stl"
@@ -13,24 +14,83 @@ import (
 )
 
 const (
-	kSQLEntries       = "select id, ts, download_mbps, upload_mbps from entry where ts >= ? and ts < ? order by ts desc"
-	kSQLAddEntry      = "insert into entry (ts, download_mbps, upload_mbps) values (?, ?, ?)"
+	kSQLEntries       = "select id, probe, ts, download_mbps, upload_mbps, ping_ms, jitter_ms, packet_loss, retransmits, status, unmeasured from entry where ts >= ? and ts < ? order by ts desc, id desc"
+	kSQLProbeEntries  = "select id, probe, ts, download_mbps, upload_mbps, ping_ms, jitter_ms, packet_loss, retransmits, status, unmeasured from entry where probe = ? and ts >= ? and ts < ? order by ts desc, id desc"
+	kSQLProbes        = "select probe from entry union select probe from day_summary order by probe"
+	kSQLAddEntry      = "insert into entry (probe, ts, download_mbps, upload_mbps, ping_ms, jitter_ms, packet_loss, retransmits, status, unmeasured) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
 	kSQLRemoveEntries = "delete from entry where ts >= ? and ts < ?"
+	kSQLPlans         = "select id, name, download_mbps, upload_mbps, effective from plan order by effective desc, id desc"
+	kSQLAddPlan       = "insert into plan (name, download_mbps, upload_mbps, effective) values (?, ?, ?, ?)"
+	kSQLRemovePlan    = "delete from plan where id = ?"
+	kSQLPlanEffective = "select effective from plan where id = ?"
+
+	kSQLDaySummaries      = "select id, probe, date, tests, up_tests, failed_runs, download_n, download_sum, download_sum_squares, download_min, download_max, upload_n, upload_sum, upload_sum_squares, upload_min, upload_max, latency_tests, ping_ms_sum, jitter_ms_sum, packet_loss_sum, up_seconds, down_seconds, outages, longest_outage_seconds, first_outage_start, first_outage_end, last_outage_start, last_outage_end, download_plan_tests, download_plan_met, upload_plan_tests, upload_plan_met, packet_loss_tests, jitter_tests from day_summary where date >= ? and date < ? order by date desc, id desc"
+	kSQLProbeDaySummaries = "select id, probe, date, tests, up_tests, failed_runs, download_n, download_sum, download_sum_squares, download_min, download_max, upload_n, upload_sum, upload_sum_squares, upload_min, upload_max, latency_tests, ping_ms_sum, jitter_ms_sum, packet_loss_sum, up_seconds, down_seconds, outages, longest_outage_seconds, first_outage_start, first_outage_end, last_outage_start, last_outage_end, download_plan_tests, download_plan_met, upload_plan_tests, upload_plan_met, packet_loss_tests, jitter_tests from day_summary where probe = ? and date >= ? and date < ? order by date desc, id desc"
+	kSQLAddDaySummary     = "insert into day_summary (probe, date, tests, up_tests, failed_runs, download_n, download_sum, download_sum_squares, download_min, download_max, upload_n, upload_sum, upload_sum_squares, upload_min, upload_max, latency_tests, ping_ms_sum, jitter_ms_sum, packet_loss_sum, up_seconds, down_seconds, outages, longest_outage_seconds, first_outage_start, first_outage_end, last_outage_start, last_outage_end, download_plan_tests, download_plan_met, upload_plan_tests, upload_plan_met, packet_loss_tests, jitter_tests) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
 )
 
 type Store struct {
-	db sqlite3_db.Doer
+	db      sqlite3_db.Doer
+	loc     *time.Location
+	locName string
+
+	// Non-nil while batching. See Batch.
+	stale staleDays
 }
 
 // New creates a sqlite implementation of the speedtestlogger app datastore.
+// The store keeps the daily and monthly rollups of the database up to
+// date. The store reads rollups that group entries into days in local
+// time as stlview does. See SetUpRollups.
 func New(db *sqlite3_db.Db) *Store {
-	return &Store{db}
+	return NewInLocation(db, time.Local)
+}
+
+// NewInLocation works like New except that the store reads rollups that
+// group entries into days in loc.
+func NewInLocation(db *sqlite3_db.Db, loc *time.Location) *Store {
+	return &Store{db: db, loc: loc, locName: locationName(loc)}
+}
+
+// Batch runs action within t passing it a store that works like s except
+// that it refreshes rollups once when action returns instead of after
+// every change. Use Batch to add or remove many entries at once.
+func (s *Store) Batch(
+	t db.Transaction, action func(store *Store) error) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		batch := &Store{
+			db:      sqlite3_db.NewSqlite3Doer(tx),
+			loc:     s.loc,
+			locName: s.locName,
+			stale:   make(staleDays),
+		}
+		if err := action(batch); err != nil {
+			return err
+		}
+		r, err := s.rollups(tx)
+		if err != nil {
+			return err
+		}
+		return r.refresh(batch.stale)
+	})
 }
 
 func (s *Store) AddEntry(t db.Transaction, entry *stl.Entry) error {
 	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
-		return sqlite3_rw.AddRow(
+		err := sqlite3_rw.AddRow(
 			tx, (&rawEntry{}).init(entry), &entry.Id, kSQLAddEntry)
+		if err != nil {
+			return err
+		}
+		r, err := s.rollups(tx)
+		if err != nil {
+			return err
+		}
+		stale := s.staleDays()
+		if err := r.addStaleDay(stale, entry.Probe, entry.Ts); err != nil {
+			return err
+		}
+		return s.refresh(r, stale)
 	})
 }
 
@@ -50,12 +110,209 @@ func (s *Store) Entries(
 	})
 }
 
+func (s *Store) ProbeEntries(
+	t db.Transaction,
+	probe string,
+	startTime,
+	endTime int64,
+	consumer consume2.Consumer[stl.Entry]) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return sqlite3_rw.ReadMultiple[stl.Entry](
+			tx,
+			(&rawEntry{}).init(&stl.Entry{}),
+			consumer,
+			kSQLProbeEntries,
+			probe,
+			startTime,
+			endTime)
+	})
+}
+
+func (s *Store) Probes(t db.Transaction) (probes []string, err error) {
+	err = sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		rows, err := tx.Query(kSQLProbes)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var probe string
+			if err := rows.Scan(&probe); err != nil {
+				return err
+			}
+			probes = append(probes, probe)
+		}
+		return rows.Err()
+	})
+	return
+}
+
 func (s *Store) RemoveEntries(
 	t db.Transaction, startTime, endTime int64) error {
 	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
-		_, err := tx.Exec(kSQLRemoveEntries, startTime, endTime)
-		return err
+		r, err := s.rollups(tx)
+		if err != nil {
+			return err
+		}
+		removed := make(staleDays)
+		err = r.addStaleEntryDays(removed, kSQLEntryTimes, startTime, endTime)
+		if err != nil {
+			return err
+		}
+		for probe := range removed {
+			if err := r.addStalePrevDay(removed, probe, startTime); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(kSQLRemoveEntries, startTime, endTime); err != nil {
+			return err
+		}
+		stale := s.staleDays()
+		stale.addAll(removed)
+		return s.refresh(r, stale)
+	})
+}
+
+func (s *Store) AddPlan(t db.Transaction, plan *stl.Plan) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		err := sqlite3_rw.AddRow(
+			tx, (&rawPlan{}).init(plan), &plan.Id, kSQLAddPlan)
+		if err != nil {
+			return err
+		}
+		return s.refreshFrom(tx, plan.Effective)
+	})
+}
+
+func (s *Store) Plans(t db.Transaction) (plans stl.Plans, err error) {
+	err = sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return sqlite3_rw.ReadMultiple[stl.Plan](
+			tx,
+			(&rawPlan{}).init(&stl.Plan{}),
+			consume2.AppendTo((*[]stl.Plan)(&plans)),
+			kSQLPlans)
 	})
+	return
+}
+
+func (s *Store) RemovePlan(t db.Transaction, id int64) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		var effective int64
+		err := tx.QueryRow(kSQLPlanEffective, id).Scan(&effective)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(kSQLRemovePlan, id); err != nil {
+			return err
+		}
+		return s.refreshFrom(tx, effective)
+	})
+}
+
+func (s *Store) AddDaySummary(
+	t db.Transaction, summary *stl.DaySummary) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		err := sqlite3_rw.AddRow(
+			tx,
+			(&rawDaySummary{}).init(summary),
+			&summary.Id,
+			kSQLAddDaySummary)
+		if err != nil {
+			return err
+		}
+		r, err := s.rollups(tx)
+		if err != nil {
+			return err
+		}
+		stale := s.staleDays()
+		stale.add(summary.Probe, time.Unix(summary.Date, 0).UTC())
+		return s.refresh(r, stale)
+	})
+}
+
+func (s *Store) DaySummaries(
+	t db.Transaction,
+	startDate,
+	endDate int64,
+	consumer consume2.Consumer[stl.DaySummary]) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return sqlite3_rw.ReadMultiple[stl.DaySummary](
+			tx,
+			(&rawDaySummary{}).init(&stl.DaySummary{}),
+			consumer,
+			kSQLDaySummaries,
+			startDate,
+			endDate)
+	})
+}
+
+func (s *Store) ProbeDaySummaries(
+	t db.Transaction,
+	probe string,
+	startDate,
+	endDate int64,
+	consumer consume2.Consumer[stl.DaySummary]) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		return sqlite3_rw.ReadMultiple[stl.DaySummary](
+			tx,
+			(&rawDaySummary{}).init(&stl.DaySummary{}),
+			consumer,
+			kSQLProbeDaySummaries,
+			probe,
+			startDate,
+			endDate)
+	})
+}
+
+// rollups returns what maintains the rollups the way the database
+// records for them.
+func (s *Store) rollups(tx *sql.Tx) (*rollups, error) {
+	meta, ok, err := readRollupMeta(tx)
+	if err != nil || !ok {
+		return &rollups{tx: tx}, err
+	}
+	loc := s.loc
+	if meta.location != s.locName {
+		if loc, err = time.LoadLocation(meta.location); err != nil {
+			return nil, err
+		}
+	}
+	return newRollups(tx, loc, meta.slaPercent)
+}
+
+// refreshFrom refreshes the rollups of the days with entries at or after
+// ts. A plan taking effect at ts changes how those entries compare with
+// the plan.
+func (s *Store) refreshFrom(tx *sql.Tx, ts int64) error {
+	r, err := s.rollups(tx)
+	if err != nil {
+		return err
+	}
+	stale := s.staleDays()
+	if err := r.addStaleEntryDays(stale, kSQLEntryTimesFrom, ts); err != nil {
+		return err
+	}
+	return s.refresh(r, stale)
+}
+
+// staleDays returns where to record the days whose rollups need
+// refreshing.
+func (s *Store) staleDays() staleDays {
+	if s.stale != nil {
+		return s.stale
+	}
+	return make(staleDays)
+}
+
+// refresh refreshes the rollups of stale unless s is batching.
+func (s *Store) refresh(r *rollups, stale staleDays) error {
+	if s.stale != nil {
+		return nil
+	}
+	return r.refresh(stale)
 }
 
 type rawEntry struct {
@@ -69,13 +326,163 @@ func (r *rawEntry) init(bo *stl.Entry) *rawEntry {
 }
 
 func (r *rawEntry) Ptrs() []interface{} {
-	return []interface{}{&r.Id, &r.Ts, &r.DownloadMbps, &r.UploadMbps}
+	return []interface{}{
+		&r.Id,
+		&r.Probe,
+		&r.Ts,
+		&r.DownloadMbps,
+		&r.UploadMbps,
+		&r.PingMs,
+		&r.JitterMs,
+		&r.PacketLossPercent,
+		&r.Retransmits,
+		&r.Status,
+		&r.Unmeasured,
+	}
 }
 
 func (r *rawEntry) Values() []interface{} {
-	return []interface{}{r.Ts, r.DownloadMbps, r.UploadMbps, r.Id}
+	return []interface{}{
+		r.Probe,
+		r.Ts,
+		r.DownloadMbps,
+		r.UploadMbps,
+		r.PingMs,
+		r.JitterMs,
+		r.PacketLossPercent,
+		r.Retransmits,
+		r.Status,
+		r.Unmeasured,
+		r.Id,
+	}
 }
 
 func (r *rawEntry) ValueRead() stl.Entry {
 	return *r.Entry
 }
+
+type rawPlan struct {
+	*stl.Plan
+	sqlite3_rw.SimpleRow
+}
+
+func (r *rawPlan) init(bo *stl.Plan) *rawPlan {
+	r.Plan = bo
+	return r
+}
+
+func (r *rawPlan) Ptrs() []interface{} {
+	return []interface{}{
+		&r.Id,
+		&r.Name,
+		&r.DownloadMbps,
+		&r.UploadMbps,
+		&r.Effective,
+	}
+}
+
+func (r *rawPlan) Values() []interface{} {
+	return []interface{}{
+		r.Name,
+		r.DownloadMbps,
+		r.UploadMbps,
+		r.Effective,
+		r.Id,
+	}
+}
+
+func (r *rawPlan) ValueRead() stl.Plan {
+	return *r.Plan
+}
+
+type rawDaySummary struct {
+	*stl.DaySummary
+	sqlite3_rw.SimpleRow
+}
+
+func (r *rawDaySummary) init(bo *stl.DaySummary) *rawDaySummary {
+	r.DaySummary = bo
+	return r
+}
+
+func (r *rawDaySummary) Ptrs() []interface{} {
+	return []interface{}{
+		&r.Id,
+		&r.Probe,
+		&r.Date,
+		&r.Tests,
+		&r.UpTests,
+		&r.FailedRuns,
+		&r.DownloadMbps.N,
+		&r.DownloadMbps.Sum,
+		&r.DownloadMbps.SumSquares,
+		&r.DownloadMbps.Min,
+		&r.DownloadMbps.Max,
+		&r.UploadMbps.N,
+		&r.UploadMbps.Sum,
+		&r.UploadMbps.SumSquares,
+		&r.UploadMbps.Min,
+		&r.UploadMbps.Max,
+		&r.LatencyTests,
+		&r.PingMsSum,
+		&r.JitterMsSum,
+		&r.PacketLossPercentSum,
+		&r.UpSeconds,
+		&r.DownSeconds,
+		&r.Outages,
+		&r.LongestOutageSeconds,
+		&r.FirstOutageStart,
+		&r.FirstOutageEnd,
+		&r.LastOutageStart,
+		&r.LastOutageEnd,
+		&r.DownloadPlanTests,
+		&r.DownloadPlanMet,
+		&r.UploadPlanTests,
+		&r.UploadPlanMet,
+		&r.PacketLossTests,
+		&r.JitterTests,
+	}
+}
+
+func (r *rawDaySummary) Values() []interface{} {
+	return []interface{}{
+		r.Probe,
+		r.Date,
+		r.Tests,
+		r.UpTests,
+		r.FailedRuns,
+		r.DownloadMbps.N,
+		r.DownloadMbps.Sum,
+		r.DownloadMbps.SumSquares,
+		r.DownloadMbps.Min,
+		r.DownloadMbps.Max,
+		r.UploadMbps.N,
+		r.UploadMbps.Sum,
+		r.UploadMbps.SumSquares,
+		r.UploadMbps.Min,
+		r.UploadMbps.Max,
+		r.LatencyTests,
+		r.PingMsSum,
+		r.JitterMsSum,
+		r.PacketLossPercentSum,
+		r.UpSeconds,
+		r.DownSeconds,
+		r.Outages,
+		r.LongestOutageSeconds,
+		r.FirstOutageStart,
+		r.FirstOutageEnd,
+		r.LastOutageStart,
+		r.LastOutageEnd,
+		r.DownloadPlanTests,
+		r.DownloadPlanMet,
+		r.UploadPlanTests,
+		r.UploadPlanMet,
+		r.PacketLossTests,
+		r.JitterTests,
+		r.Id,
+	}
+}
+
+func (r *rawDaySummary) ValueRead() stl.DaySummary {
+	return *r.DaySummary
+}
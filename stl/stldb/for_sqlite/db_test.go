@@ -3,18 +3,52 @@ package for_sqlite_test
 import (
 	"database/sql"
 	"testing"
+	"time"
 
+	"github.com/keep94/speedtestlogger/stl"
+	"github.com/keep94/speedtestlogger/stl/aggregators"
 	"github.com/keep94/speedtestlogger/stl/stldb/fixture"
 	"github.com/keep94/speedtestlogger/stl/stldb/for_sqlite"
 	"github.com/keep94/speedtestlogger/stl/stldb/sqlite_setup"
+	"github.com/keep94/toolbox/date_util"
+	"github.com/keep94/toolbox/db"
 	"github.com/keep94/toolbox/db/sqlite3_db"
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
 )
 
-func TestEntries(t *testing.T) {
+const (
+	kSLAPercent = 80.0
+)
+
+func TestConformance(t *testing.T) {
+	fixture.Conformance(t, func(t *testing.T) (fixture.Store, db.Doer) {
+		sqliteDb := openDb(t)
+		t.Cleanup(func() { closeDb(t, sqliteDb) })
+		return newStore(t, sqliteDb, time.Local), sqlite3_db.NewDoer(sqliteDb)
+	})
+}
+
+func TestDaySummaries(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.DaySummaries(t, newStore(t, db, time.Local))
+}
+
+func TestDatedSummaries(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("Error loading location: %v", err)
+	}
 	db := openDb(t)
 	defer closeDb(t, db)
-	fixture.Entries(t, for_sqlite.New(db))
+	fixture.DatedSummaries(t, newStore(t, db, loc), loc, kSLAPercent)
+}
+
+func TestPlans(t *testing.T) {
+	db := openDb(t)
+	defer closeDb(t, db)
+	fixture.Plans(t, newStore(t, db, time.Local))
 }
 
 func openDb(t *testing.T) *sqlite3_db.Db {
@@ -30,8 +64,113 @@ func openDb(t *testing.T) *sqlite3_db.Db {
 	return db
 }
 
+func newStore(
+	t *testing.T, db *sqlite3_db.Db, loc *time.Location) *for_sqlite.Store {
+	store := for_sqlite.NewInLocation(db, loc)
+	if err := store.SetUpRollups(nil, kSLAPercent); err != nil {
+		t.Fatalf("Error setting up rollups: %v", err)
+	}
+	return store
+}
+
 func closeDb(t *testing.T, db *sqlite3_db.Db) {
 	if err := db.Close(); err != nil {
 		t.Errorf("Error closing database: %v", err)
 	}
 }
+
+func TestBatch(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("Error loading location: %v", err)
+	}
+	entries := []stl.Entry{
+		{Ts: 1738400000, DownloadMbps: 90.0, UploadMbps: 9.0},
+		{Ts: 1738200000, Status: stl.StatusOutage},
+		{Ts: 1738300000, DownloadMbps: 80.0, UploadMbps: 8.0},
+		{Probe: "office", Ts: 1738250000, DownloadMbps: 50.0, UploadMbps: 5.0},
+	}
+	start := date_util.YMD(2025, 1, 28)
+	end := date_util.YMD(2025, 2, 3)
+
+	db := openDb(t)
+	defer closeDb(t, db)
+	store := newStore(t, db, loc)
+	for i := range entries {
+		entry := entries[i]
+		assert.NoError(t, store.AddEntry(nil, &entry))
+	}
+	expected, err := store.DatedSummaries(nil, aggregators.Daily(), start, end)
+	assert.NoError(t, err)
+
+	batchDb := openDb(t)
+	defer closeDb(t, batchDb)
+	batchStore := newStore(t, batchDb, loc)
+	err = batchStore.Batch(nil, func(batch *for_sqlite.Store) error {
+		for i := range entries {
+			entry := entries[i]
+			if err := batch.AddEntry(nil, &entry); err != nil {
+				return err
+			}
+		}
+		unchanged, err := batch.DatedSummaries(
+			nil, aggregators.Daily(), start, end)
+		assert.NoError(t, err)
+		for _, datedSummary := range unchanged {
+			assert.False(t, datedSummary.PercentUptime.Exists())
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	actual, err := batchStore.DatedSummaries(
+		nil, aggregators.Daily(), start, end)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, actual)
+}
+
+func TestRollupLocation(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("Error loading location: %v", err)
+	}
+	start := date_util.YMD(2025, 1, 31)
+	end := date_util.YMD(2025, 2, 2)
+	db := openDb(t)
+	defer closeDb(t, db)
+	store := for_sqlite.NewInLocation(db, newYork)
+	utcStore := for_sqlite.NewInLocation(db, time.UTC)
+
+	// Without rollups, stores still take entries.
+	entry := stl.Entry{Ts: 1738380000, DownloadMbps: 90.0, UploadMbps: 9.0}
+	assert.NoError(t, store.AddEntry(nil, &entry))
+	_, err = store.DatedSummaries(nil, aggregators.Daily(), start, end)
+	assert.Error(t, err)
+
+	assert.NoError(t, store.SetUpRollups(nil, kSLAPercent))
+	_, err = utcStore.DatedSummaries(nil, aggregators.Daily(), start, end)
+	assert.Error(t, err)
+
+	// The UTC store keeps the rollups in New York time. Both entries are
+	// on February 1 in UTC but January 31 in New York.
+	entry = stl.Entry{Ts: 1738370000, DownloadMbps: 70.0, UploadMbps: 7.0}
+	assert.NoError(t, utcStore.AddEntry(nil, &entry))
+	summaries, err := store.DatedSummaries(
+		nil, aggregators.Daily(), start, end)
+	assert.NoError(t, err)
+	if assert.Len(t, summaries, 2) {
+		assert.Equal(t, date_util.YMD(2025, 1, 31), summaries[1].Date)
+		assert.Equal(t, 2, summaries[1].DownloadMbps.N)
+	}
+
+	// Setting up rollups in UTC rebuilds them.
+	assert.NoError(t, utcStore.SetUpRollups(nil, kSLAPercent))
+	summaries, err = utcStore.DatedSummaries(
+		nil, aggregators.Daily(), start, end)
+	assert.NoError(t, err)
+	if assert.Len(t, summaries, 2) {
+		assert.Equal(t, 2, summaries[0].DownloadMbps.N)
+		assert.False(t, summaries[1].DownloadMbps.Exists())
+	}
+	_, err = store.DatedSummaries(nil, aggregators.Daily(), start, end)
+	assert.Error(t, err)
+}
@@ -0,0 +1,475 @@
+package for_sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/speedtestlogger/stl"
+	"github.com/keep94/speedtestlogger/stl/aggregators"
+	"github.com/keep94/speedtestlogger/stl/dates"
+	"github.com/keep94/toolbox/db"
+	"github.com/keep94/toolbox/db/sqlite3_db"
+	"github.com/keep94/toolbox/db/sqlite3_rw"
+)
+
+// The rollup_day and rollup_month tables have the same columns as the
+// day_summary table. Each row summarises one probe for one day or month
+// including the day summaries of pruned entries. Rollups of all probes
+// come grouped by probe so that each probe's rollups are added most
+// recent to least recent; see aggregators.Summary.AddDaySummary.
+const (
+	kSQLDayRollups        = "select id, probe, date, tests, up_tests, failed_runs, download_n, download_sum, download_sum_squares, download_min, download_max, upload_n, upload_sum, upload_sum_squares, upload_min, upload_max, latency_tests, ping_ms_sum, jitter_ms_sum, packet_loss_sum, up_seconds, down_seconds, outages, longest_outage_seconds, first_outage_start, first_outage_end, last_outage_start, last_outage_end, download_plan_tests, download_plan_met, upload_plan_tests, upload_plan_met, packet_loss_tests, jitter_tests from rollup_day where date >= ? and date < ? order by probe, date desc"
+	kSQLProbeDayRollups   = "select id, probe, date, tests, up_tests, failed_runs, download_n, download_sum, download_sum_squares, download_min, download_max, upload_n, upload_sum, upload_sum_squares, upload_min, upload_max, latency_tests, ping_ms_sum, jitter_ms_sum, packet_loss_sum, up_seconds, down_seconds, outages, longest_outage_seconds, first_outage_start, first_outage_end, last_outage_start, last_outage_end, download_plan_tests, download_plan_met, upload_plan_tests, upload_plan_met, packet_loss_tests, jitter_tests from rollup_day where probe = ? and date >= ? and date < ? order by date desc"
+	kSQLAddDayRollup      = "insert into rollup_day (probe, date, tests, up_tests, failed_runs, download_n, download_sum, download_sum_squares, download_min, download_max, upload_n, upload_sum, upload_sum_squares, upload_min, upload_max, latency_tests, ping_ms_sum, jitter_ms_sum, packet_loss_sum, up_seconds, down_seconds, outages, longest_outage_seconds, first_outage_start, first_outage_end, last_outage_start, last_outage_end, download_plan_tests, download_plan_met, upload_plan_tests, upload_plan_met, packet_loss_tests, jitter_tests) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	kSQLRemoveDayRollup   = "delete from rollup_day where probe = ? and date = ?"
+	kSQLMonthRollups      = "select id, probe, date, tests, up_tests, failed_runs, download_n, download_sum, download_sum_squares, download_min, download_max, upload_n, upload_sum, upload_sum_squares, upload_min, upload_max, latency_tests, ping_ms_sum, jitter_ms_sum, packet_loss_sum, up_seconds, down_seconds, outages, longest_outage_seconds, first_outage_start, first_outage_end, last_outage_start, last_outage_end, download_plan_tests, download_plan_met, upload_plan_tests, upload_plan_met, packet_loss_tests, jitter_tests from rollup_month where date >= ? and date < ? order by probe, date desc"
+	kSQLProbeMonthRollups = "select id, probe, date, tests, up_tests, failed_runs, download_n, download_sum, download_sum_squares, download_min, download_max, upload_n, upload_sum, upload_sum_squares, upload_min, upload_max, latency_tests, ping_ms_sum, jitter_ms_sum, packet_loss_sum, up_seconds, down_seconds, outages, longest_outage_seconds, first_outage_start, first_outage_end, last_outage_start, last_outage_end, download_plan_tests, download_plan_met, upload_plan_tests, upload_plan_met, packet_loss_tests, jitter_tests from rollup_month where probe = ? and date >= ? and date < ? order by date desc"
+	kSQLAddMonthRollup    = "insert into rollup_month (probe, date, tests, up_tests, failed_runs, download_n, download_sum, download_sum_squares, download_min, download_max, upload_n, upload_sum, upload_sum_squares, upload_min, upload_max, latency_tests, ping_ms_sum, jitter_ms_sum, packet_loss_sum, up_seconds, down_seconds, outages, longest_outage_seconds, first_outage_start, first_outage_end, last_outage_start, last_outage_end, download_plan_tests, download_plan_met, upload_plan_tests, upload_plan_met, packet_loss_tests, jitter_tests) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	kSQLRemoveMonthRollup = "delete from rollup_month where probe = ? and date = ?"
+	kSQLClearDayRollups   = "delete from rollup_day"
+	kSQLClearMonthRollups = "delete from rollup_month"
+
+	kSQLProbeDaySummariesOn = "select id, probe, date, tests, up_tests, failed_runs, download_n, download_sum, download_sum_squares, download_min, download_max, upload_n, upload_sum, upload_sum_squares, upload_min, upload_max, latency_tests, ping_ms_sum, jitter_ms_sum, packet_loss_sum, up_seconds, down_seconds, outages, longest_outage_seconds, first_outage_start, first_outage_end, last_outage_start, last_outage_end, download_plan_tests, download_plan_met, upload_plan_tests, upload_plan_met, packet_loss_tests, jitter_tests from day_summary where probe = ? and date = ?"
+	kSQLNextEntry           = "select id, probe, ts, download_mbps, upload_mbps, ping_ms, jitter_ms, packet_loss, retransmits, status, unmeasured from entry where probe = ? and ts >= ? and status not in (?, ?) order by ts limit 1"
+	kSQLPrevEntry           = "select id, probe, ts, download_mbps, upload_mbps, ping_ms, jitter_ms, packet_loss, retransmits, status, unmeasured from entry where probe = ? and ts < ? and status not in (?, ?) order by ts desc limit 1"
+	kSQLEntryTimes          = "select probe, ts from entry where ts >= ? and ts < ?"
+	kSQLAllEntryTimes       = "select probe, ts from entry"
+	kSQLAllDaySummaryDates  = "select probe, date from day_summary"
+	kSQLRollupMeta          = "select location, sla_percent from rollup_meta"
+	kSQLClearRollupMeta     = "delete from rollup_meta"
+	kSQLAddRollupMeta       = "insert into rollup_meta (location, sla_percent) values (?, ?)"
+	kSQLEntryTimesFrom      = "select probe, ts from entry where ts >= ?"
+)
+
+var (
+	errNoRollups      = errors.New("for_sqlite: only daily and monthly summaries are stored")
+	errRollupsMissing = errors.New("for_sqlite: rollups not built; call SetUpRollups")
+)
+
+// SetUpRollups builds the daily and monthly rollups grouping entries
+// into days in the location of s and checking tests against the
+// advertised plans at slaPercent unless they are already built that way.
+// See aggregators.NewSLA. The database records the location and SLA
+// percent of its rollups, and every store of the database keeps the
+// rollups up to date with them. Until SetUpRollups is called, the
+// database has no rollups.
+func (s *Store) SetUpRollups(t db.Transaction, slaPercent float64) error {
+	return sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		meta, ok, err := readRollupMeta(tx)
+		if err != nil {
+			return err
+		}
+		if ok && meta == (rollupMeta{s.locName, slaPercent}) {
+			return nil
+		}
+		return rebuildRollups(tx, s.loc, rollupMeta{s.locName, slaPercent})
+	})
+}
+
+func (s *Store) DatedSummaries(
+	t db.Transaction,
+	recurring aggregators.Recurring,
+	start,
+	end time.Time) (result []*aggregators.DatedSummary, err error) {
+	query, err := rollupQuery(recurring, kSQLDayRollups, kSQLMonthRollups)
+	if err != nil {
+		return nil, err
+	}
+	totaler := aggregators.NewByPeriodTotaler(start, end, recurring, s.loc)
+	err = sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		if err := s.checkRollups(tx); err != nil {
+			return err
+		}
+		return sqlite3_rw.ReadMultiple[stl.DaySummary](
+			tx,
+			(&rawDaySummary{}).init(&stl.DaySummary{}),
+			consume2.Call(totaler.AddDaySummary),
+			query,
+			recurring.Normalize(start).Unix(),
+			recurring.Normalize(end).Unix())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return totaler.DatedSummaries(), nil
+}
+
+func (s *Store) ProbeDatedSummaries(
+	t db.Transaction,
+	probe string,
+	recurring aggregators.Recurring,
+	start,
+	end time.Time) (result []*aggregators.DatedSummary, err error) {
+	query, err := rollupQuery(
+		recurring, kSQLProbeDayRollups, kSQLProbeMonthRollups)
+	if err != nil {
+		return nil, err
+	}
+	totaler := aggregators.NewByPeriodTotaler(start, end, recurring, s.loc)
+	err = sqlite3_db.ToDoer(s.db, t).Do(func(tx *sql.Tx) error {
+		if err := s.checkRollups(tx); err != nil {
+			return err
+		}
+		return sqlite3_rw.ReadMultiple[stl.DaySummary](
+			tx,
+			(&rawDaySummary{}).init(&stl.DaySummary{}),
+			consume2.Call(totaler.AddDaySummary),
+			query,
+			probe,
+			recurring.Normalize(start).Unix(),
+			recurring.Normalize(end).Unix())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return totaler.DatedSummaries(), nil
+}
+
+// checkRollups returns an error unless the rollups group entries into
+// days in the location of s.
+func (s *Store) checkRollups(tx *sql.Tx) error {
+	meta, ok, err := readRollupMeta(tx)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errRollupsMissing
+	}
+	if meta.location != s.locName {
+		return fmt.Errorf(
+			"for_sqlite: rollups are in %s, not %s; call SetUpRollups",
+			meta.location,
+			s.locName)
+	}
+	return nil
+}
+
+// rebuildRollups recomputes the rollup_day and rollup_month tables from
+// scratch as meta says grouping entries into days in loc. loc is the
+// location meta names.
+func rebuildRollups(tx *sql.Tx, loc *time.Location, meta rollupMeta) error {
+	if _, err := tx.Exec(kSQLClearDayRollups); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(kSQLClearMonthRollups); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(kSQLClearRollupMeta); err != nil {
+		return err
+	}
+	_, err := tx.Exec(kSQLAddRollupMeta, meta.location, meta.slaPercent)
+	if err != nil {
+		return err
+	}
+	r, err := newRollups(tx, loc, meta.slaPercent)
+	if err != nil {
+		return err
+	}
+	stale := make(staleDays)
+	if err := r.addStaleEntryDays(stale, kSQLAllEntryTimes); err != nil {
+		return err
+	}
+	rows, err := tx.Query(kSQLAllDaySummaryDates)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var probe string
+		var date int64
+		if err := rows.Scan(&probe, &date); err != nil {
+			return err
+		}
+		stale.add(probe, time.Unix(date, 0).UTC())
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return r.refresh(stale)
+}
+
+// rollupMeta is how the rollups are built.
+type rollupMeta struct {
+
+	// The name of the location the rollups group entries into days in.
+	location string
+
+	// The SLA percent the rollups check tests against plans at.
+	slaPercent float64
+}
+
+// readRollupMeta returns how the rollups are built. ok is false if the
+// rollups are not built.
+func readRollupMeta(tx *sql.Tx) (meta rollupMeta, ok bool, err error) {
+	err = tx.QueryRow(kSQLRollupMeta).Scan(&meta.location, &meta.slaPercent)
+	if err == sql.ErrNoRows {
+		return rollupMeta{}, false, nil
+	}
+	if err != nil {
+		return rollupMeta{}, false, err
+	}
+	return meta, true, nil
+}
+
+// locationName returns the name of loc that time.LoadLocation accepts.
+// For time.Local, that is the zone in the TZ environment variable or
+// the zone that /etc/localtime links to. The name of time.Local is just
+// Local if neither is available.
+func locationName(loc *time.Location) string {
+	if loc != time.Local {
+		return loc.String()
+	}
+	if tz, ok := os.LookupEnv("TZ"); ok {
+		tz = strings.TrimPrefix(tz, ":")
+		if tz == "" {
+			return "UTC"
+		}
+		return zoneName(tz)
+	}
+	if target, err := filepath.EvalSymlinks("/etc/localtime"); err == nil {
+		if name := zoneName(target); name != target {
+			return name
+		}
+	}
+	return loc.String()
+}
+
+// zoneName returns the part of path after the zoneinfo directory or path
+// itself if path has no zoneinfo directory.
+func zoneName(path string) string {
+	_, after, found := strings.Cut(path, "zoneinfo/")
+	if !found {
+		return path
+	}
+	return after
+}
+
+func rollupQuery(
+	recurring aggregators.Recurring, daily, monthly string) (string, error) {
+	switch recurring {
+	case aggregators.Daily():
+		return daily, nil
+	case aggregators.Monthly():
+		return monthly, nil
+	default:
+		return "", errNoRollups
+	}
+}
+
+// staleDays holds the days of each probe whose rollups need refreshing.
+type staleDays map[string]map[time.Time]bool
+
+func (s staleDays) add(probe string, day time.Time) {
+	days, ok := s[probe]
+	if !ok {
+		days = make(map[time.Time]bool)
+		s[probe] = days
+	}
+	days[day] = true
+}
+
+func (s staleDays) addAll(other staleDays) {
+	for probe, days := range other {
+		for day := range days {
+			s.add(probe, day)
+		}
+	}
+}
+
+// rollups maintains the rollup tables within a transaction. A nil loc
+// means there are no rollups to maintain.
+type rollups struct {
+	tx  *sql.Tx
+	loc *time.Location
+	sla *aggregators.SLA
+}
+
+// newRollups returns what maintains the rollups grouping entries into
+// days in loc and checking tests against the plans at slaPercent.
+func newRollups(
+	tx *sql.Tx, loc *time.Location, slaPercent float64) (*rollups, error) {
+	var plans stl.Plans
+	err := sqlite3_rw.ReadMultiple[stl.Plan](
+		tx,
+		(&rawPlan{}).init(&stl.Plan{}),
+		consume2.AppendTo((*[]stl.Plan)(&plans)),
+		kSQLPlans)
+	if err != nil {
+		return nil, err
+	}
+	return &rollups{
+		tx: tx, loc: loc, sla: aggregators.NewSLA(plans, slaPercent)}, nil
+}
+
+// addStaleDay adds to stale the day of an entry of probe at ts along
+// with the day of the entry of probe before it.
+func (r *rollups) addStaleDay(stale staleDays, probe string, ts int64) error {
+	if r.loc == nil {
+		return nil
+	}
+	stale.add(probe, dates.DatePart(ts, r.loc))
+	return r.addStalePrevDay(stale, probe, ts)
+}
+
+// addStaleEntryDays adds the days of the entries that query returns to
+// stale. query returns probe and ts columns.
+func (r *rollups) addStaleEntryDays(
+	stale staleDays, query string, args ...interface{}) error {
+	if r.loc == nil {
+		return nil
+	}
+	rows, err := r.tx.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var probe string
+		var ts int64
+		if err := rows.Scan(&probe, &ts); err != nil {
+			return err
+		}
+		stale.add(probe, dates.DatePart(ts, r.loc))
+	}
+	return rows.Err()
+}
+
+// addStalePrevDay adds to stale the day of the last entry of probe before
+// ts. That entry's time weighted uptime and outages depend on what comes
+// after it.
+func (r *rollups) addStalePrevDay(
+	stale staleDays, probe string, ts int64) error {
+	if r.loc == nil {
+		return nil
+	}
+	prev, ok, err := r.entry(kSQLPrevEntry, probe, ts)
+	if err != nil || !ok {
+		return err
+	}
+	stale.add(probe, dates.DatePart(prev.Ts, r.loc))
+	return nil
+}
+
+// refresh recomputes the day rollups in stale along with the month
+// rollups of the months they fall in.
+func (r *rollups) refresh(stale staleDays) error {
+	if r.loc == nil {
+		return nil
+	}
+	for probe, days := range stale {
+		months := make(map[time.Time]bool)
+		for day := range days {
+			if err := r.refreshDay(probe, day); err != nil {
+				return err
+			}
+			months[aggregators.Monthly().Normalize(day)] = true
+		}
+		for month := range months {
+			if err := r.refreshMonth(probe, month); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *rollups) refreshDay(probe string, day time.Time) error {
+	end := dates.ToTimestamp(aggregators.Daily().Add(day, 1), r.loc)
+	builder := aggregators.NewDaySummaries(probe, r.loc)
+	builder.SetSLA(r.sla)
+	next, ok, err := r.entry(kSQLNextEntry, probe, end)
+	if err != nil {
+		return err
+	}
+	if ok {
+		builder.Seed(next)
+	}
+	err = sqlite3_rw.ReadMultiple[stl.Entry](
+		r.tx,
+		(&rawEntry{}).init(&stl.Entry{}),
+		consume2.Call(builder.Add),
+		kSQLProbeEntries,
+		probe,
+		dates.ToTimestamp(day, r.loc),
+		end)
+	if err != nil {
+		return err
+	}
+	parts := builder.DaySummaries()
+	err = sqlite3_rw.ReadMultiple[stl.DaySummary](
+		r.tx,
+		(&rawDaySummary{}).init(&stl.DaySummary{}),
+		consume2.AppendTo(&parts),
+		kSQLProbeDaySummariesOn,
+		probe,
+		day.Unix())
+	if err != nil {
+		return err
+	}
+	return r.write(
+		kSQLRemoveDayRollup, kSQLAddDayRollup, probe, day, parts)
+}
+
+func (r *rollups) refreshMonth(probe string, month time.Time) error {
+	var parts []stl.DaySummary
+	err := sqlite3_rw.ReadMultiple[stl.DaySummary](
+		r.tx,
+		(&rawDaySummary{}).init(&stl.DaySummary{}),
+		consume2.AppendTo(&parts),
+		kSQLProbeDayRollups,
+		probe,
+		month.Unix(),
+		aggregators.Monthly().Add(month, 1).Unix())
+	if err != nil {
+		return err
+	}
+	return r.write(
+		kSQLRemoveMonthRollup, kSQLAddMonthRollup, probe, month, parts)
+}
+
+// write replaces the rollup of probe on date with the combination of
+// parts. If parts is empty, write just removes the rollup.
+func (r *rollups) write(
+	removeSQL, addSQL string,
+	probe string,
+	date time.Time,
+	parts []stl.DaySummary) error {
+	if _, err := r.tx.Exec(removeSQL, probe, date.Unix()); err != nil {
+		return err
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+	var summary aggregators.Summary
+	for i := range parts {
+		summary.AddDaySummary(&parts[i])
+	}
+	rollup := summary.DaySummary(probe, date)
+	return sqlite3_rw.AddRow(
+		r.tx, (&rawDaySummary{}).init(&rollup), &rollup.Id, addSQL)
+}
+
+// entry returns the entry that query finds for probe and ts. query is
+// kSQLNextEntry or kSQLPrevEntry.
+func (r *rollups) entry(
+	query, probe string, ts int64) (result stl.Entry, ok bool, err error) {
+	err = sqlite3_rw.ReadMultiple[stl.Entry](
+		r.tx,
+		(&rawEntry{}).init(&stl.Entry{}),
+		consume2.Call(func(entry stl.Entry) {
+			result = entry
+			ok = true
+		}),
+		query,
+		probe,
+		ts,
+		stl.StatusToolError,
+		stl.StatusTimeout)
+	return
+}
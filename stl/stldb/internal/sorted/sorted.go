@@ -0,0 +1,88 @@
+// Package sorted holds the in-memory indexes that the for_memory and
+// for_ndjson stores share. An index is a slice sorted by a timestamp
+// key then by id.
+package sorted
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/speedtestlogger/stl"
+)
+
+// Insert inserts value into values keeping values sorted by compare and
+// returns the new slice.
+func Insert[T any](values []T, value T, compare func(a, b *T) int) []T {
+	i, _ := slices.BinarySearchFunc(values, &value, func(existing T, value *T) int {
+		return compare(&existing, value)
+	})
+	return slices.Insert(values, i, value)
+}
+
+// Range returns the indexes of the values with keys between start
+// and end. start is inclusive; end is exclusive.
+func Range[T any](
+	values []T, start, end int64, keyOf func(*T) int64) (first, last int) {
+	first = firstAtOrAfter(values, start, keyOf)
+	last = max(first, firstAtOrAfter(values, end, keyOf))
+	return
+}
+
+// Between returns the values with keys between start and end for
+// which include returns true, most recent first.
+func Between[T any](
+	values []T,
+	start,
+	end int64,
+	keyOf func(*T) int64,
+	include func(*T) bool) []T {
+	first, last := Range(values, start, end, keyOf)
+	var result []T
+	for i := last - 1; i >= first; i-- {
+		if include(&values[i]) {
+			result = append(result, values[i])
+		}
+	}
+	return result
+}
+
+// ConsumeAll sends values to consumer until consumer can consume no more.
+func ConsumeAll[T any](values []T, consumer consume2.Consumer[T]) {
+	for _, value := range values {
+		if !consumer.CanConsume() {
+			return
+		}
+		consumer.Consume(value)
+	}
+}
+
+// CompareEntry orders entries by ts then by id.
+func CompareEntry(a, b *stl.Entry) int {
+	return cmp.Or(cmp.Compare(a.Ts, b.Ts), cmp.Compare(a.Id, b.Id))
+}
+
+// CompareDaySummary orders day summaries by date then by id.
+func CompareDaySummary(a, b *stl.DaySummary) int {
+	return cmp.Or(cmp.Compare(a.Date, b.Date), cmp.Compare(a.Id, b.Id))
+}
+
+// EntryTs is the key of an entry.
+func EntryTs(entry *stl.Entry) int64 {
+	return entry.Ts
+}
+
+// DaySummaryDate is the key of a day summary.
+func DaySummaryDate(summary *stl.DaySummary) int64 {
+	return summary.Date
+}
+
+func firstAtOrAfter[T any](values []T, key int64, keyOf func(*T) int64) int {
+	i, _ := slices.BinarySearchFunc(values, key, func(value T, key int64) int {
+		if keyOf(&value) < key {
+			return -1
+		}
+		return 1
+	})
+	return i
+}
@@ -0,0 +1,49 @@
+package sorted_test
+
+import (
+	"testing"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/speedtestlogger/stl"
+	"github.com/keep94/speedtestlogger/stl/stldb/internal/sorted"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEntries(t *testing.T) {
+	var entries []stl.Entry
+	for _, entry := range []stl.Entry{
+		{Id: 1, Ts: 200},
+		{Id: 2, Ts: 100},
+		{Id: 3, Ts: 300},
+		{Id: 4, Ts: 200},
+	} {
+		entries = sorted.Insert(entries, entry, sorted.CompareEntry)
+	}
+	assert.Equal(t, []int64{2, 1, 4, 3}, ids(entries))
+
+	start, end := sorted.Range(entries, 200, 300, sorted.EntryTs)
+	assert.Equal(t, 1, start)
+	assert.Equal(t, 3, end)
+	start, end = sorted.Range(entries, 300, 200, sorted.EntryTs)
+	assert.Equal(t, start, end)
+
+	between := sorted.Between(
+		entries,
+		100,
+		300,
+		sorted.EntryTs,
+		func(entry *stl.Entry) bool { return entry.Id != 4 })
+	assert.Equal(t, []int64{1, 2}, ids(between))
+
+	var consumed []stl.Entry
+	sorted.ConsumeAll(entries, consume2.Slice(consume2.AppendTo(&consumed), 0, 2))
+	assert.Equal(t, []int64{2, 1}, ids(consumed))
+}
+
+func ids(entries []stl.Entry) []int64 {
+	var result []int64
+	for _, entry := range entries {
+		result = append(result, entry.Id)
+	}
+	return result
+}
@@ -3,10 +3,222 @@ package sqlite_setup
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/keep94/speedtestlogger/stl"
+)
+
+// Migration represents a single step in evolving the database schema.
+// Migrations are applied in order of increasing Version.
+type Migration struct {
+
+	// The schema version after this migration is applied.
+	Version int
+
+	// What this migration does.
+	Description string
+
+	apply func(tx *sql.Tx) error
+}
+
+const (
+
+	// The columns of the day_summary, rollup_day, and rollup_month tables.
+	kSummaryColumns = "(id INTEGER PRIMARY KEY AUTOINCREMENT, probe TEXT NOT NULL DEFAULT '', date INTEGER NOT NULL, tests INTEGER NOT NULL, up_tests INTEGER NOT NULL, failed_runs INTEGER NOT NULL, download_n INTEGER NOT NULL, download_sum REAL NOT NULL, download_sum_squares REAL NOT NULL, download_min REAL NOT NULL, download_max REAL NOT NULL, upload_n INTEGER NOT NULL, upload_sum REAL NOT NULL, upload_sum_squares REAL NOT NULL, upload_min REAL NOT NULL, upload_max REAL NOT NULL, latency_tests INTEGER NOT NULL, ping_ms_sum REAL NOT NULL, jitter_ms_sum REAL NOT NULL, packet_loss_sum REAL NOT NULL, up_seconds INTEGER NOT NULL, down_seconds INTEGER NOT NULL, outages INTEGER NOT NULL, longest_outage_seconds INTEGER NOT NULL)"
+)
+
+var (
+	// CheckCurrent returns an error wrapping ErrNotCurrent when the
+	// database has pending migrations.
+	ErrNotCurrent = errors.New("sqlite_setup: database schema is out of date")
+)
+
+var (
+	kMigrations = []Migration{
+		{
+			Version:     1,
+			Description: "create entry table",
+			apply:       createEntryTable,
+		},
+		{
+			Version:     2,
+			Description: "add ping_ms, jitter_ms, packet_loss to entry",
+			apply:       addLatencyColumns,
+		},
+		{
+			Version:     3,
+			Description: "add status to entry",
+			apply:       addStatusColumn,
+		},
+		{
+			Version:     4,
+			Description: "create plan table",
+			apply:       createPlanTable,
+		},
+		{
+			Version:     5,
+			Description: "add retransmits to entry",
+			apply:       addRetransmitsColumn,
+		},
+		{
+			Version:     6,
+			Description: "add probe to entry",
+			apply:       addProbeColumn,
+		},
+		{
+			Version:     7,
+			Description: "create day_summary table",
+			apply:       createDaySummaryTable,
+		},
+		{
+			Version:     8,
+			Description: "create rollup_day and rollup_month tables",
+			apply:       createRollupTables,
+		},
+		{
+			Version:     9,
+			Description: "create rollup_meta table",
+			apply:       createRollupMetaTable,
+		},
+		{
+			Version:     10,
+			Description: "add outage edges to day_summary and rollups",
+			apply:       addOutageEdgeColumns,
+		},
+		{
+			Version:     11,
+			Description: "add plan compliance to day_summary and rollups",
+			apply:       addPlanColumns,
+		},
+		{
+			Version:     12,
+			Description: "add unmeasured to entry",
+			apply:       addUnmeasuredColumn,
+		},
+		{
+			Version:     13,
+			Description: "add packet_loss_tests to day_summary and rollups",
+			apply:       addPacketLossTestsColumn,
+		},
+		{
+			Version:     14,
+			Description: "mark unmeasured latency in entry and add jitter_tests to day_summary and rollups",
+			apply:       addJitterTestsColumn,
+		},
+	}
 )
 
 // SetUpTables creates all needed tables in database for speedtestlogger app.
+// SetUpTables also brings an existing database up to the latest schema
+// version.
 func SetUpTables(tx *sql.Tx) error {
+	_, err := Migrate(tx)
+	return err
+}
+
+// Migrations returns all the migrations in order.
+func Migrations() []Migration {
+	result := make([]Migration, len(kMigrations))
+	copy(result, kMigrations)
+	return result
+}
+
+// CurrentVersion returns the current schema version of the database.
+// CurrentVersion returns 0 for a database that has never been migrated.
+// CurrentVersion does not change the database.
+func CurrentVersion(tx *sql.Tx) (int, error) {
+	exists, err := hasTable(tx, "schema_version")
+	if err != nil || !exists {
+		return 0, err
+	}
+	var version sql.NullInt64
+	err = tx.QueryRow("select max(version) from schema_version").Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+	return int(version.Int64), nil
+}
+
+// Pending returns the migrations not yet applied to the database in
+// the order they would be applied. Pending does not change the database,
+// so it can be used for a dry run.
+func Pending(tx *sql.Tx) ([]Migration, error) {
+	version, err := CurrentVersion(tx)
+	if err != nil {
+		return nil, err
+	}
+	var result []Migration
+	for _, migration := range kMigrations {
+		if migration.Version > version {
+			result = append(result, migration)
+		}
+	}
+	return result, nil
+}
+
+// CheckCurrent returns an error wrapping ErrNotCurrent if the database
+// has pending migrations. The stores assume the latest schema, so
+// programs that write to the database should call CheckCurrent before
+// writing. CheckCurrent does not change the database.
+func CheckCurrent(tx *sql.Tx) error {
+	pending, err := Pending(tx)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf(
+			"%w: at version %d, latest is %d",
+			ErrNotCurrent,
+			pending[0].Version-1,
+			pending[len(pending)-1].Version)
+	}
+	return nil
+}
+
+// Migrate applies all pending migrations in order and returns the
+// migrations applied. Because each migration step is idempotent, Migrate
+// can upgrade databases that were created before schema versions were
+// tracked. Callers should run Migrate within a single transaction so that
+// either all pending migrations are applied or none are.
+func Migrate(tx *sql.Tx) ([]Migration, error) {
+	pending, err := Pending(tx)
+	if err != nil {
+		return nil, err
+	}
+	if len(pending) == 0 {
+		return nil, nil
+	}
+	if err := createSchemaVersionTable(tx); err != nil {
+		return nil, err
+	}
+	for _, migration := range pending {
+		if err := migration.apply(tx); err != nil {
+			return nil, fmt.Errorf(
+				"migration %d (%s): %w",
+				migration.Version,
+				migration.Description,
+				err)
+		}
+		_, err := tx.Exec(
+			"insert into schema_version (version, description, applied_ts) values (?, ?, ?)",
+			migration.Version,
+			migration.Description,
+			time.Now().Unix())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pending, nil
+}
+
+func createSchemaVersionTable(tx *sql.Tx) error {
+	_, err := tx.Exec("create table if not exists schema_version (version INTEGER PRIMARY KEY, description TEXT, applied_ts INTEGER)")
+	return err
+}
+
+func createEntryTable(tx *sql.Tx) error {
 	_, err := tx.Exec("create table if not exists entry (id INTEGER PRIMARY KEY AUTOINCREMENT, ts INTEGER, download_mbps REAL, upload_mbps REAL)")
 	if err != nil {
 		return err
@@ -14,3 +226,249 @@ func SetUpTables(tx *sql.Tx) error {
 	_, err = tx.Exec("create index if not exists entry_ts_idx on entry (ts)")
 	return err
 }
+
+func addLatencyColumns(tx *sql.Tx) error {
+	if err := addColumn(tx, "entry", "ping_ms", "REAL NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := addColumn(tx, "entry", "jitter_ms", "REAL NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	return addColumn(tx, "entry", "packet_loss", "REAL NOT NULL DEFAULT 0")
+}
+
+// addStatusColumn adds the status column. Before the status column
+// existed, outages were recorded as 0 download and 0 upload speed.
+func addStatusColumn(tx *sql.Tx) error {
+	exists, err := hasColumn(tx, "entry", "status")
+	if err != nil || exists {
+		return err
+	}
+	if err := addColumn(tx, "entry", "status", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		"update entry set status = ? where download_mbps = 0 and upload_mbps = 0",
+		stl.StatusOutage)
+	return err
+}
+
+func createPlanTable(tx *sql.Tx) error {
+	_, err := tx.Exec("create table if not exists plan (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL DEFAULT '', download_mbps REAL NOT NULL, upload_mbps REAL NOT NULL DEFAULT 0, effective INTEGER NOT NULL)")
+	return err
+}
+
+func addRetransmitsColumn(tx *sql.Tx) error {
+	return addColumn(tx, "entry", "retransmits", "INTEGER NOT NULL DEFAULT 0")
+}
+
+func addProbeColumn(tx *sql.Tx) error {
+	if err := addColumn(tx, "entry", "probe", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	_, err := tx.Exec("create index if not exists entry_probe_ts_idx on entry (probe, ts)")
+	return err
+}
+
+func createDaySummaryTable(tx *sql.Tx) error {
+	_, err := tx.Exec("create table if not exists day_summary " + kSummaryColumns)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("create index if not exists day_summary_date_idx on day_summary (date)")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("create index if not exists day_summary_probe_date_idx on day_summary (probe, date)")
+	return err
+}
+
+// createRollupTables creates the rollup tables empty. The store fills
+// them; see for_sqlite.Store.SetUpRollups.
+func createRollupTables(tx *sql.Tx) error {
+	for _, table := range []string{"rollup_day", "rollup_month"} {
+		_, err := tx.Exec(
+			fmt.Sprintf("create table if not exists %s %s", table, kSummaryColumns))
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(
+			fmt.Sprintf(
+				"create unique index if not exists %s_probe_date_idx on %s (probe, date)",
+				table,
+				table))
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(
+			fmt.Sprintf(
+				"create index if not exists %s_date_idx on %s (date)",
+				table,
+				table))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createRollupMetaTable creates the table that records the time zone
+// the rollups group entries into days in. The table is empty until the
+// rollups are built.
+func createRollupMetaTable(tx *sql.Tx) error {
+	_, err := tx.Exec("create table if not exists rollup_meta (location TEXT NOT NULL)")
+	return err
+}
+
+// addOutageEdgeColumns adds the columns that let outages span days. The
+// rollups are rebuilt to fill in the new columns.
+func addOutageEdgeColumns(tx *sql.Tx) error {
+	for _, table := range []string{"day_summary", "rollup_day", "rollup_month"} {
+		for _, column := range []string{
+			"first_outage_start",
+			"first_outage_end",
+			"last_outage_start",
+			"last_outage_end"} {
+			if err := addColumn(tx, table, column, "INTEGER NOT NULL DEFAULT 0"); err != nil {
+				return err
+			}
+		}
+	}
+	return clearRollupMeta(tx)
+}
+
+// addPlanColumns adds the columns that record how often tests met the
+// advertised plan along with the SLA percent the rollups check tests
+// against. The rollups are rebuilt to fill in the new columns.
+func addPlanColumns(tx *sql.Tx) error {
+	for _, table := range []string{"day_summary", "rollup_day", "rollup_month"} {
+		for _, column := range []string{
+			"download_plan_tests",
+			"download_plan_met",
+			"upload_plan_tests",
+			"upload_plan_met"} {
+			if err := addColumn(tx, table, column, "INTEGER NOT NULL DEFAULT 0"); err != nil {
+				return err
+			}
+		}
+	}
+	if err := addColumn(tx, "rollup_meta", "sla_percent", "REAL NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	return clearRollupMeta(tx)
+}
+
+func addUnmeasuredColumn(tx *sql.Tx) error {
+	return addColumn(tx, "entry", "unmeasured", "INTEGER NOT NULL DEFAULT 0")
+}
+
+// addPacketLossTestsColumn adds the number of runs that measured packet
+// loss. Before the column existed, every run that measured latency
+// counted as measuring packet loss.
+func addPacketLossTestsColumn(tx *sql.Tx) error {
+	for _, table := range []string{"day_summary", "rollup_day", "rollup_month"} {
+		exists, err := hasColumn(tx, table, "packet_loss_tests")
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if err := addColumn(tx, table, "packet_loss_tests", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+			return err
+		}
+		_, err = tx.Exec(
+			fmt.Sprintf("update %s set packet_loss_tests = latency_tests", table))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addJitterTestsColumn records latency, jitter, and packet loss as
+// unmeasured in entries that have no ping as 0 ping used to mean that
+// latency was not measured. It also adds the number of runs that measured
+// jitter. Before the column existed, only runs that measured latency
+// counted as measuring jitter. The rollups are rebuilt so that they
+// include jitter and packet loss from runs that measured no latency.
+func addJitterTestsColumn(tx *sql.Tx) error {
+	exists, err := hasColumn(tx, "day_summary", "jitter_tests")
+	if err != nil || exists {
+		return err
+	}
+	updates := []struct {
+		measurement stl.Measurement
+		where       string
+	}{
+		{stl.MeasureLatency, "ping_ms = 0"},
+		{stl.MeasureJitter, "ping_ms = 0 and jitter_ms = 0"},
+		{stl.MeasurePacketLoss, "ping_ms = 0 and packet_loss = 0"},
+	}
+	for _, update := range updates {
+		_, err := tx.Exec(
+			"update entry set unmeasured = unmeasured | ? where "+update.where,
+			update.measurement)
+		if err != nil {
+			return err
+		}
+	}
+	for _, table := range []string{"day_summary", "rollup_day", "rollup_month"} {
+		if err := addColumn(tx, table, "jitter_tests", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+			return err
+		}
+		_, err := tx.Exec(
+			fmt.Sprintf("update %s set jitter_tests = latency_tests", table))
+		if err != nil {
+			return err
+		}
+	}
+	return clearRollupMeta(tx)
+}
+
+// clearRollupMeta marks the rollups as not built so that they are
+// rebuilt. Migrations that change what goes into rollups call it.
+func clearRollupMeta(tx *sql.Tx) error {
+	_, err := tx.Exec("delete from rollup_meta")
+	return err
+}
+
+// addColumn adds a column to a table unless the column already exists.
+func addColumn(tx *sql.Tx, table, column, definition string) error {
+	exists, err := hasColumn(tx, table, column)
+	if err != nil || exists {
+		return err
+	}
+	_, err = tx.Exec(
+		fmt.Sprintf("alter table %s add column %s %s", table, column, definition))
+	return err
+}
+
+func hasTable(tx *sql.Tx, table string) (bool, error) {
+	var count int
+	err := tx.QueryRow(
+		"select count(*) from sqlite_master where type = 'table' and name = ?",
+		table).Scan(&count)
+	return count > 0, err
+}
+
+func hasColumn(tx *sql.Tx, table, column string) (bool, error) {
+	rows, err := tx.Query(fmt.Sprintf("pragma table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, ctype string
+		var defaultValue sql.NullString
+		if err := rows.Scan(
+			&cid, &name, &ctype, &notNull, &defaultValue, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
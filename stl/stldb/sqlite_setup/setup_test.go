@@ -0,0 +1,146 @@
+package sqlite_setup_test
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/keep94/consume2"
+	"github.com/keep94/speedtestlogger/stl"
+	"github.com/keep94/speedtestlogger/stl/stldb/for_sqlite"
+	"github.com/keep94/speedtestlogger/stl/stldb/sqlite_setup"
+	"github.com/keep94/toolbox/db/sqlite3_db"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+
+	// What entries from before latency was measured did not measure
+	kNoLatency = stl.MeasureLatency |
+		stl.MeasureJitter |
+		stl.MeasurePacketLoss
+)
+
+func TestMigrateLegacyDatabase(t *testing.T) {
+	db := openDb(t)
+	defer db.Close()
+	assert.NoError(t, db.Do(func(tx *sql.Tx) error {
+		_, err := tx.Exec("create table entry (id INTEGER PRIMARY KEY AUTOINCREMENT, ts INTEGER, download_mbps REAL, upload_mbps REAL)")
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("insert into entry (ts, download_mbps, upload_mbps) values (100, 50.0, 5.0), (200, 0.0, 0.0)")
+		return err
+	}))
+
+	var pending []sqlite_setup.Migration
+	assert.NoError(t, db.Do(func(tx *sql.Tx) (err error) {
+		pending, err = sqlite_setup.Pending(tx)
+		return
+	}))
+	assert.Len(t, pending, len(sqlite_setup.Migrations()))
+
+	var applied []sqlite_setup.Migration
+	assert.NoError(t, db.Do(func(tx *sql.Tx) (err error) {
+		applied, err = sqlite_setup.Migrate(tx)
+		return
+	}))
+	assert.Equal(t, versions(pending), versions(applied))
+
+	var entries []stl.Entry
+	assert.NoError(t, for_sqlite.New(db).Entries(
+		nil, 0, 1000, consume2.AppendTo(&entries)))
+	assert.Equal(
+		t,
+		[]stl.Entry{
+			{
+				Id:         2,
+				Ts:         200,
+				Status:     stl.StatusOutage,
+				Unmeasured: kNoLatency,
+			},
+			{
+				Id:           1,
+				Ts:           100,
+				DownloadMbps: 50.0,
+				UploadMbps:   5.0,
+				Unmeasured:   kNoLatency,
+			},
+		},
+		entries)
+
+	// Migrating again does nothing
+	assert.NoError(t, db.Do(func(tx *sql.Tx) (err error) {
+		applied, err = sqlite_setup.Migrate(tx)
+		return
+	}))
+	assert.Empty(t, applied)
+	assertVersion(t, db, len(sqlite_setup.Migrations()))
+}
+
+func TestMigrateRollsBack(t *testing.T) {
+	db := openDb(t)
+	defer db.Close()
+
+	// A failure later in the same transaction undoes the migrations.
+	err := db.Do(func(tx *sql.Tx) error {
+		if _, err := sqlite_setup.Migrate(tx); err != nil {
+			return err
+		}
+		_, err := tx.Exec("insert into no_such_table values (1)")
+		return err
+	})
+	assert.Error(t, err)
+	assertVersion(t, db, 0)
+}
+
+func TestPendingChangesNothing(t *testing.T) {
+	db := openDb(t)
+	defer db.Close()
+	var pending []sqlite_setup.Migration
+	assert.NoError(t, db.Do(func(tx *sql.Tx) (err error) {
+		pending, err = sqlite_setup.Pending(tx)
+		return
+	}))
+	assert.Len(t, pending, len(sqlite_setup.Migrations()))
+	var tables int
+	assert.NoError(t, db.Do(func(tx *sql.Tx) error {
+		return tx.QueryRow("select count(*) from sqlite_master").Scan(&tables)
+	}))
+	assert.Zero(t, tables)
+	assertVersion(t, db, 0)
+}
+
+func TestCheckCurrent(t *testing.T) {
+	db := openDb(t)
+	defer db.Close()
+	assert.ErrorIs(t, db.Do(sqlite_setup.CheckCurrent), sqlite_setup.ErrNotCurrent)
+	assert.NoError(t, db.Do(sqlite_setup.SetUpTables))
+	assert.NoError(t, db.Do(sqlite_setup.CheckCurrent))
+}
+
+func assertVersion(t *testing.T, db *sqlite3_db.Db, expected int) {
+	t.Helper()
+	var version int
+	assert.NoError(t, db.Do(func(tx *sql.Tx) (err error) {
+		version, err = sqlite_setup.CurrentVersion(tx)
+		return
+	}))
+	assert.Equal(t, expected, version)
+}
+
+func versions(migrations []sqlite_setup.Migration) []int {
+	var result []int
+	for _, migration := range migrations {
+		result = append(result, migration.Version)
+	}
+	return result
+}
+
+func openDb(t *testing.T) *sqlite3_db.Db {
+	rawdb, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Error opening database: %v", err)
+	}
+	return sqlite3_db.New(rawdb)
+}
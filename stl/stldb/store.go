@@ -3,8 +3,11 @@
 package stldb
 
 import (
+	"time"
+
 	"github.com/keep94/consume2"
 	"github.com/keep94/speedtestlogger/stl"
+	"github.com/keep94/speedtestlogger/stl/aggregators"
 	"github.com/keep94/toolbox/db"
 )
 
@@ -17,17 +20,108 @@ type AddEntryRunner interface {
 type EntriesRunner interface {
 
 	// Entries returns all entries (most recent to least recent) within a
-	// given time range. startTime and endTime are seconds since Jan 1, 1970.
+	// given time range. startTime and endTime are seconds since Jan 1, 1970;
+	// startTime is inclusive and endTime is exclusive. Entries with the same
+	// timestamp come most recently added first. Entries stops as soon as
+	// consumer can consume no more.
 	Entries(
 		t db.Transaction,
 		startTime,
 		endTime int64,
 		consumer consume2.Consumer[stl.Entry]) error
+
+	// ProbeEntries works like Entries except that it returns only the
+	// entries from probe. An empty probe means the default probe.
+	ProbeEntries(
+		t db.Transaction,
+		probe string,
+		startTime,
+		endTime int64,
+		consumer consume2.Consumer[stl.Entry]) error
+}
+
+type ProbesRunner interface {
+
+	// Probes returns the distinct probes of all entries and day summaries
+	// in ascending order. The empty string stands for the default probe.
+	Probes(t db.Transaction) ([]string, error)
 }
 
 type RemoveEntriesRunner interface {
 
 	// RemoveEntries removes entries within a given time range.
-	// startTime and endTime are seconds since Jan 1, 1970.
+	// startTime and endTime are seconds since Jan 1, 1970; startTime is
+	// inclusive and endTime is exclusive.
 	RemoveEntries(t db.Transaction, startTime, endTime int64) error
 }
+
+type AddPlanRunner interface {
+
+	// AddPlan adds a new plan to persistent storage.
+	AddPlan(t db.Transaction, plan *stl.Plan) error
+}
+
+type PlansRunner interface {
+
+	// Plans returns all plans as stl.Plans, most recently effective first.
+	Plans(t db.Transaction) (stl.Plans, error)
+}
+
+type RemovePlanRunner interface {
+
+	// RemovePlan removes the plan with the given id.
+	RemovePlan(t db.Transaction, id int64) error
+}
+
+type AddDaySummaryRunner interface {
+
+	// AddDaySummary adds a new day summary to persistent storage.
+	AddDaySummary(t db.Transaction, summary *stl.DaySummary) error
+}
+
+type DaySummariesRunner interface {
+
+	// DaySummaries returns all day summaries (most recent to least recent)
+	// whose Date is within a given range. startDate and endDate are
+	// seconds since Jan 1, 1970 at midnight GMT as in stl.DaySummary.
+	DaySummaries(
+		t db.Transaction,
+		startDate,
+		endDate int64,
+		consumer consume2.Consumer[stl.DaySummary]) error
+
+	// ProbeDaySummaries works like DaySummaries except that it returns
+	// only the day summaries of probe. An empty probe means the default
+	// probe.
+	ProbeDaySummaries(
+		t db.Transaction,
+		probe string,
+		startDate,
+		endDate int64,
+		consumer consume2.Consumer[stl.DaySummary]) error
+}
+
+type DatedSummariesRunner interface {
+
+	// DatedSummaries returns the summary of each period from start up to
+	// but not including end, most recent first, like
+	// aggregators.ByPeriodTotaler does for the same entries. Summaries
+	// include stored day summaries. recurring must be aggregators.Daily()
+	// or aggregators.Monthly(). start and end are dates. The summaries
+	// have no speed percentiles. Compliance checks tests against the
+	// plans in the store at the SLA percent the store was set up with.
+	DatedSummaries(
+		t db.Transaction,
+		recurring aggregators.Recurring,
+		start,
+		end time.Time) ([]*aggregators.DatedSummary, error)
+
+	// ProbeDatedSummaries works like DatedSummaries except that it
+	// summarises only probe. An empty probe means the default probe.
+	ProbeDatedSummaries(
+		t db.Transaction,
+		probe string,
+		recurring aggregators.Recurring,
+		start,
+		end time.Time) ([]*aggregators.DatedSummary, error)
+}